@@ -4,40 +4,156 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/jvitoroc/b2w-star-wars/resources"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	resourceHandlers "github.com/jvitoroc/b2w-star-wars/resources/handlers"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
 	"github.com/jvitoroc/b2w-star-wars/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"google.golang.org/grpc"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 type App struct {
 	Router *mux.Router
 	DB     *mongo.Client
 
 	HttpHandler http.Handler
+	GrpcServer  *grpc.Server
 }
 
-func (a *App) Initialize(mongoURI string, databaseName string) {
-	_, err := a._ConnectMongoDB(mongoURI)
-	if err != nil {
-		log.Fatal(errors.New("Could not connect to the database server: " + err.Error()))
+// etapas da inicializacao, para que os comandos escolham o codigo de saida
+const (
+	InitConfig = iota
+	InitDatabase
+	InitMigrations
+)
+
+type InitializeError struct {
+	Step int
+	// a falha pode passar sozinha, como o lock de migracao ocupado por outra instancia
+	Temporary bool
+	Err       error
+}
+
+func (e *InitializeError) Error() string {
+	return e.Err.Error()
+}
+
+func (a *App) Initialize(mongoURI string, databaseName string) error {
+	// a configuracao e conferida antes de conectar, como nos comandos
+	if err := resourceHandlers.Configure(); err != nil {
+		return &InitializeError{Step: InitConfig, Err: errors.New("Invalid configuration: " + err.Error())}
+	}
+
+	if _, err := a._ConnectMongoDB(mongoURI); err != nil {
+		return &InitializeError{Step: InitDatabase, Err: errors.New("Could not connect to the database server: " + err.Error())}
 	}
 
-	a._ConfigureRouter(databaseName)
+	if err := repo.Initialize(a.DB, databaseName); err != nil {
+		return &InitializeError{Step: InitDatabase, Err: errors.New("Could not initialize the repositories: " + err.Error())}
+	}
+
+	// com MIGRATE_ON_START=true as migracoes pendentes sao aplicadas antes de preparar o banco e as rotas
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		if err := a._Migrate(); err != nil {
+			return &InitializeError{
+				Step:      InitMigrations,
+				Temporary: err.Code == common.ECONFLICT,
+				Err:       errors.New("Could not apply the migrations: " + migrationErrorMessage(err)),
+			}
+		}
+	}
+
+	if err := a._ConfigureRouter(); err != nil {
+		return &InitializeError{Step: InitDatabase, Err: errors.New("Could not initialize the resources: " + err.Error())}
+	}
+
+	return nil
+}
+
+// conecta ao banco e inicializa os repositorios sem configurar o router;
+// usado pelos comandos que nao sobem o servidor. O validador dos planetas nao e aplicado
+// aqui: o migrate up precisa rodar antes dele, e os comandos que gravam planetas o aplicam
+// com ensurePlanetsValidator
+func (a *App) InitializeCLI(mongoURI string, databaseName string) error {
+	if err := resourceHandlers.Configure(); err != nil {
+		return &InitializeError{Step: InitConfig, Err: errors.New("Invalid configuration: " + err.Error())}
+	}
+
+	if _, err := a._ConnectMongoDB(mongoURI); err != nil {
+		return &InitializeError{Step: InitDatabase, Err: errors.New("Could not connect to the database server: " + err.Error())}
+	}
+
+	if err := repo.Initialize(a.DB, databaseName); err != nil {
+		return &InitializeError{Step: InitDatabase, Err: errors.New("Could not initialize the repositories: " + err.Error())}
+	}
+
+	return nil
+}
+
+func (a *App) Close() {
+	if a.DB != nil {
+		a.DB.Disconnect(context.Background())
+	}
 }
 
-func (a *App) Run(addr string) {
+// grpcAddr vazio nao sobe o servidor gRPC. As portas sao abertas antes de atender, entao uma
+// porta ocupada retorna erro sem que nenhum dos servidores tenha comecado
+func (a *App) Run(addr string, grpcAddr string) error {
 	defer a.DB.Disconnect(context.Background())
 
-	// inicializa o server
-	err := a._Listen(addr)
+	httpListener, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	var grpcListener net.Listener
+	if grpcAddr != "" {
+		if grpcListener, err = net.Listen("tcp", grpcAddr); err != nil {
+			httpListener.Close()
+			return err
+		}
+	}
+
+	// inicializa o server
+	server := &http.Server{Handler: a.HttpHandler}
+	stopped := make(chan struct{})
+	go a._WaitForShutdown(server, stopped)
+
+	if grpcListener != nil {
+		go func() {
+			if err := a.GrpcServer.Serve(grpcListener); err != nil {
+				log.Printf("grpc: %s", err)
+			}
+		}()
+	}
+
+	if err := server.Serve(httpListener); err != nil && err != http.ErrServerClosed {
+		return err
 	}
+	<-stopped
+
+	return nil
+}
+
+func migrationErrorMessage(err *common.Error) string {
+	if err.Detail != "" {
+		return err.Message + " " + err.Detail
+	}
+
+	return err.Message
 }
 
 // funcoes que iniciam com _ sao "privadas"
@@ -62,28 +178,71 @@ func (a *App) _TestMongoDBConnection() error {
 	return a.DB.Ping(ctx, readpref.PrimaryPreferred())
 }
 
-func (a *App) _ConfigureRouter(databaseName string) {
+func (a *App) _ConfigureRouter() error {
 	allowedOrigins := handlers.AllowedOrigins([]string{"*"})
 	allowedHeaders := handlers.AllowedHeaders([]string{"*"})
-	allowedMethods := handlers.AllowedMethods([]string{"POST, GET, PATCH, DELETE"})
+	allowedMethods := handlers.AllowedMethods([]string{"POST, GET, PUT, PATCH, DELETE"})
+	// o aviso de filtro sem indice precisa ser visivel para os clientes no navegador
+	exposedHeaders := handlers.ExposedHeaders([]string{"Warning"})
 
 	a.Router = mux.NewRouter()
 	a.Router.StrictSlash(false)
 	a.Router.Use(setBasicsMiddleware)
 
-	resources.Initialize(a.Router, a.DB, databaseName)
+	if err := resources.Initialize(a.Router); err != nil {
+		return err
+	}
 
-	a.HttpHandler = handlers.CORS(allowedOrigins, allowedHeaders, allowedMethods)(a.Router)
+	a.HttpHandler = handlers.CORS(allowedOrigins, allowedHeaders, allowedMethods, exposedHeaders)(a.Router)
+	a.GrpcServer = resourceHandlers.NewGRPCServer()
+	return nil
 }
 
-func (a *App) _Listen(addr string) error {
-	return http.ListenAndServe(addr, a.HttpHandler)
+func (a *App) _Migrate() *common.Error {
+	applied, err := repo.MigrateUp()
+	for _, migration := range applied {
+		log.Printf("migration %d (%s) applied", migration.Version, migration.Name)
+	}
+
+	return err
+}
+
+// com SIGINT ou SIGTERM para de aceitar requisicoes e espera as importacoes em andamento
+func (a *App) _WaitForShutdown(server *http.Server, stopped chan struct{}) {
+	defer close(stopped)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	server.Shutdown(ctx)
+	a._StopGRPC(ctx)
+	resourceHandlers.StopImports(ctx)
+}
+
+// espera as chamadas em andamento, como os streams do List, ate o fim do ctx
+func (a *App) _StopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		a.GrpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		a.GrpcServer.Stop()
+	}
 }
 
-// middleware para configurar os headers basicos
+// middleware para configurar os headers basicos; o Content-Type e definido na resposta,
+// conforme o formato negociado
 func setBasicsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Vary", "Accept")
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	resourceHandlers "github.com/jvitoroc/b2w-star-wars/resources/handlers"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+// codigos de saida, seguindo o sysexits.h
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 64
+	exitDataError   = 65
+	exitNoInput     = 66
+	exitUnavailable = 69
+	exitTempFail    = 75
+	exitConfig      = 78
+)
+
+const defaultFixture = "fixtures/planets.json"
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "serve\n\tStarts the HTTP server (default) and, with GRPC_PORT set, the gRPC server.", runServe},
+		{"seed", "seed [--from-fixture FILE]\n\tInserts the planets of a JSON fixture (default " + defaultFixture + ").", runSeed},
+		{"migrate", "migrate up|down|status\n\tApplies, reverts or lists the schema migrations.", runMigrate},
+		{"export", "export [--format csv|ndjson|json] [--columns LIST] [--search NAME] [--tag TAG,...] [--all-tags] [--out FILE]\n\tExports the planets to a file or to the standard output.", runExport},
+		{"import", "import [--format csv|ndjson|json] [--dry-run] FILE\n\tImports planets from a file (- reads the standard input).", runImport},
+		{"resync-films", "resync-films\n\tQueries SWAPI again for the films of every planet.", runResyncFilms},
+		{"create-indexes", "create-indexes\n\tCreates the database indexes.", runCreateIndexes},
+	}
+}
+
+// executa o comando informado em args e retorna o codigo de saida
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		return runServe(args)
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n", name)
+	printUsage(os.Stderr)
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: b2w-star-wars <command> [flags]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\n", c.usage)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// conecta ao banco sem subir o servidor; o chamador deve fechar a conexao
+func connectCLI() (*App, int) {
+	app := App{}
+	if err := app.InitializeCLI(os.Getenv("MONGODB_URI"), os.Getenv("MONGODB_DBNAME_PROD")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		app.Close()
+		return nil, initializeExitCode(err)
+	}
+
+	return &app, exitOK
+}
+
+func initializeExitCode(err error) int {
+	initErr, ok := err.(*InitializeError)
+	if !ok {
+		return exitFailure
+	}
+
+	switch {
+	case initErr.Step == InitConfig:
+		return exitConfig
+	case initErr.Temporary:
+		return exitTempFail
+	case initErr.Step == InitDatabase:
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+// aplica o validador da colecao de planetas; chamado pelos comandos que gravam planetas,
+// depois das migracoes
+func ensurePlanetsValidator() int {
+	if err := repo.EnsurePlanetsValidator(); err != nil {
+		fmt.Fprintln(os.Stderr, "Could not initialize the repositories: "+err.Error())
+		return exitUnavailable
+	}
+
+	return exitOK
+}
+
+func runServe(args []string) int {
+	if err := newFlagSet("serve").Parse(args); err != nil {
+		return exitUsage
+	}
+
+	app := App{}
+	if err := app.Initialize(os.Getenv("MONGODB_URI"), os.Getenv("MONGODB_DBNAME_PROD")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		app.Close()
+		return initializeExitCode(err)
+	}
+	grpcAddr := ""
+	if port := os.Getenv("GRPC_PORT"); port != "" {
+		grpcAddr = ":" + port
+	}
+	if err := app.Run(":"+os.Getenv("API_PORT"), grpcAddr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUnavailable
+	}
+
+	return exitOK
+}
+
+func runSeed(args []string) int {
+	fs := newFlagSet("seed")
+	fixture := fs.String("from-fixture", defaultFixture, "JSON file with an array of planets")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	body, readErr := ioutil.ReadFile(*fixture)
+	if readErr != nil {
+		fmt.Fprintln(os.Stderr, readErr)
+		return exitNoInput
+	}
+
+	app, code := connectCLI()
+	if app == nil {
+		return code
+	}
+	defer app.Close()
+
+	if code := ensurePlanetsValidator(); code != exitOK {
+		return code
+	}
+
+	result, err := resourceHandlers.ImportPlanets(resourceHandlers.ImportFormatJSON, body, false, false)
+	return reportImportResult(result, err)
+}
+
+func runMigrate(args []string) int {
+	if len(args) != 1 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, "usage: migrate up|down|status")
+		return exitUsage
+	}
+
+	app, code := connectCLI()
+	if app == nil {
+		return code
+	}
+	defer app.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := repo.MigrateUp()
+		for _, migration := range applied {
+			fmt.Printf("applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return migrationExitCode(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations.")
+		}
+		// o validador descreve os documentos ja migrados
+		if code := ensurePlanetsValidator(); code != exitOK {
+			return code
+		}
+	case "down":
+		reverted, err := repo.MigrateDown()
+		if err != nil {
+			return migrationExitCode(err)
+		}
+		if reverted == nil {
+			fmt.Println("No applied migrations.")
+		} else {
+			fmt.Printf("reverted %d %s\n", reverted.Version, reverted.Name)
+		}
+	default:
+		statuses, err := repo.GetMigrationsStatus()
+		if err != nil {
+			return migrationExitCode(err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-30s  %s\n", status.Version, status.Name, appliedAt)
+		}
+	}
+
+	return exitOK
+}
+
+// lock ocupado por outra instancia e temporario; vale tentar de novo
+func migrationExitCode(err *common.Error) int {
+	printError(err)
+	if err.Code == common.ECONFLICT {
+		return exitTempFail
+	}
+
+	return exitFailure
+}
+
+func runExport(args []string) int {
+	fs := newFlagSet("export")
+	format := fs.String("format", resourceHandlers.ExportFormatJSON, "csv, ndjson or json")
+	columns := fs.String("columns", "", "CSV columns, separated by commas")
+	search := fs.String("search", "", "only planets whose name matches")
+	match := fs.String("match", repo.SearchContains, "how the search is matched: contains, prefix, exact or regex")
+	tags := fs.String("tag", "", "only planets with these tags, separated by commas")
+	allTags := fs.Bool("all-tags", false, "require every tag instead of any of them")
+	out := fs.String("out", "", "output file (default: standard output)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	opts := resourceHandlers.ExportOptions{
+		Format: *format,
+		Filter: repo.PlanetFilter{Search: *search, Match: *match, AllTags: *allTags},
+	}
+
+	if err := repo.CheckSearch(*search, *match); err != nil {
+		printError(err)
+		return exitUsage
+	}
+	if *tags != "" {
+		for _, tag := range strings.Split(*tags, ",") {
+			opts.Filter.Tags = append(opts.Filter.Tags, strings.ToLower(strings.TrimSpace(tag)))
+		}
+	}
+
+	var err *common.Error
+	if opts.Columns, err = resourceHandlers.ParseCSVColumns(*columns); err != nil {
+		printError(err)
+		return exitUsage
+	}
+
+	app, code := connectCLI()
+	if app == nil {
+		return code
+	}
+	defer app.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, createErr := os.Create(*out)
+		if createErr != nil {
+			fmt.Fprintln(os.Stderr, createErr)
+			return exitFailure
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count, exportErr := resourceHandlers.ExportPlanets(context.Background(), w, opts)
+	if exportErr != nil {
+		fmt.Fprintf(os.Stderr, "export interrupted after %d planets: %s\n", count, exportErr)
+		return exitFailure
+	}
+
+	fmt.Fprintf(os.Stderr, "%d planets exported.\n", count)
+	return exitOK
+}
+
+func runImport(args []string) int {
+	fs := newFlagSet("import")
+	format := fs.String("format", "", "csv, ndjson or json (default: from the file extension)")
+	dryRun := fs.Bool("dry-run", false, "only validate, nothing is written")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import [--format csv|ndjson|json] [--dry-run] FILE")
+		return exitUsage
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	if *format != resourceHandlers.ImportFormatCSV && *format != resourceHandlers.ImportFormatNDJSON && *format != resourceHandlers.ImportFormatJSON {
+		fmt.Fprintln(os.Stderr, "the format must be csv, ndjson or json")
+		return exitUsage
+	}
+
+	var body []byte
+	var readErr error
+	if path == "-" {
+		body, readErr = ioutil.ReadAll(os.Stdin)
+	} else {
+		body, readErr = ioutil.ReadFile(path)
+	}
+	if readErr != nil {
+		fmt.Fprintln(os.Stderr, readErr)
+		return exitNoInput
+	}
+
+	app, code := connectCLI()
+	if app == nil {
+		return code
+	}
+	defer app.Close()
+
+	if !*dryRun {
+		if code := ensurePlanetsValidator(); code != exitOK {
+			return code
+		}
+	}
+
+	result, err := resourceHandlers.ImportPlanets(*format, body, *dryRun, false)
+	return reportImportResult(result, err)
+}
+
+func runResyncFilms(args []string) int {
+	if err := newFlagSet("resync-films").Parse(args); err != nil {
+		return exitUsage
+	}
+
+	app, code := connectCLI()
+	if app == nil {
+		return code
+	}
+	defer app.Close()
+
+	if code := ensurePlanetsValidator(); code != exitOK {
+		return code
+	}
+
+	summary, err := resourceHandlers.ResyncFilms()
+	if err != nil {
+		printError(err)
+		return exitFailure
+	}
+
+	fmt.Printf("%d planets checked, %d updated, %d errors.\n", summary.Total, summary.Updated, summary.Errors)
+	if summary.Errors > 0 {
+		return exitUnavailable
+	}
+
+	return exitOK
+}
+
+func runCreateIndexes(args []string) int {
+	if err := newFlagSet("create-indexes").Parse(args); err != nil {
+		return exitUsage
+	}
+
+	app, code := connectCLI()
+	if app == nil {
+		return code
+	}
+	defer app.Close()
+
+	if err := repo.CreateIndexes(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	fmt.Println("Indexes created.")
+	return exitOK
+}
+
+// imprime o relatorio da importacao; linhas rejeitadas resultam em exitDataError
+func reportImportResult(result *resourceHandlers.ImportResult, err *common.Error) int {
+	if err != nil {
+		printError(err)
+		if err.Code == common.EINTERNAL {
+			return exitFailure
+		}
+		return exitDataError
+	}
+
+	for _, row := range result.Rows {
+		if row.Error != nil {
+			fmt.Fprintf(os.Stderr, "row %d (%s): %s\n", row.Row, row.Name, describeError(row.Error))
+		}
+	}
+
+	s := result.Summary
+	fmt.Printf("%d rows: %d inserted, %d updated, %d skipped, %d errors.\n", s.Total, s.Inserts, s.Updates, s.Skips, s.Errors)
+	if result.DryRun {
+		fmt.Println("Dry run, nothing was written.")
+	}
+
+	if s.Errors > 0 {
+		return exitDataError
+	}
+
+	return exitOK
+}
+
+func printError(err *common.Error) {
+	fmt.Fprintln(os.Stderr, describeError(err))
+}
+
+func describeError(err *common.Error) string {
+	b, _ := json.Marshal(err)
+	return string(b)
+}
@@ -14,7 +14,6 @@ func main() {
 	}
 	// >>
 
-	app := App{}
-	app.Initialize(os.Getenv("MONGODB_URI"), os.Getenv("MONGODB_DBNAME_PROD"))
-	app.Run(":" + os.Getenv("API_PORT"))
+	// sem argumentos sobe o servidor, como antes
+	os.Exit(runCLI(os.Args[1:]))
 }
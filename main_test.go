@@ -3,25 +3,51 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/jvitoroc/b2w-star-wars/resources/autocomplete"
 	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/fuzzy"
+	resourceHandlers "github.com/jvitoroc/b2w-star-wars/resources/handlers"
+	"github.com/jvitoroc/b2w-star-wars/resources/planetpb"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 type TestPlanet struct {
 	ID              string `json:"id"`
 	Name            string `json:"name"`
+	DisplayName     string `json:"displayName"`
 	Climate         string `json:"climate"`
 	Terrain         string `json:"terrain"`
 	FilmsAppearedIn int    `json:"filmsAppearedIn"`
+
+	Grid     string   `json:"grid"`
+	Distance *float64 `json:"distance"`
+
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
 }
 
 type TestSinglePlanetResponse struct {
@@ -39,6 +65,29 @@ type TestMatchedPlanetResponse struct {
 	Results []TestPlanet `json:"results"`
 }
 
+type TestBulkResponse struct {
+	Summary struct {
+		Total   int `json:"total"`
+		Created int `json:"created"`
+		Failed  int `json:"failed"`
+		Skipped int `json:"skipped"`
+	} `json:"summary"`
+	Items []struct {
+		Index  int `json:"index"`
+		Status int `json:"status"`
+	} `json:"items"`
+}
+
+type TestImportResponse struct {
+	Summary struct {
+		Inserts int `json:"inserts"`
+		Updates int `json:"updates"`
+		Skips   int `json:"skips"`
+		Errors  int `json:"errors"`
+	} `json:"summary"`
+	Links map[string]string `json:"links"`
+}
+
 var databaseName string
 var a App = App{}
 
@@ -51,7 +100,13 @@ func TestMain(m *testing.M) {
 	}
 
 	databaseName = os.Getenv("MONGODB_DBNAME_DEV")
-	a.Initialize(os.Getenv("MONGODB_URI"), databaseName)
+	// o .env nao define um token de administrador
+	if os.Getenv("ADMIN_TOKEN") == "" {
+		os.Setenv("ADMIN_TOKEN", "test-admin-token")
+	}
+	if err := a.Initialize(os.Getenv("MONGODB_URI"), databaseName); err != nil {
+		log.Fatal(err)
+	}
 
 	code := m.Run()
 	clearDatabase()
@@ -273,21 +328,1736 @@ func TestDeleteNonExistingPlanet(t *testing.T) {
 	checkResponseCode(t, http.StatusNotFound, response.Code)
 }
 
-func clearDatabase() {
-	if _, err := a.DB.Database(databaseName).Collection("planets").DeleteMany(context.TODO(), bson.D{}); err != nil {
-		panic(err)
+func TestSearchPlanetByAliasAndLocalizedName(t *testing.T) {
+	clearDatabase()
+
+	response := sendRequest("POST", "/planet/", []byte(`{"name": "Coruscant", "aliases": ["Imperial Center"], "names": {"pt-BR": "Corusca"}, "climate": "temperate", "terrain": "cityscape"}`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	for _, search := range []string{"imperial", "corusca"} {
+		response = sendRequest("GET", "/planet/?search="+search, nil)
+		if !checkResponseCode(t, http.StatusOK, response.Code) {
+			return
+		}
+
+		res := TestMatchedPlanetResponse{}
+		if !parseReponse(t, response, &res) {
+			return
+		}
+
+		if len(res.Results) != 1 || res.Results[0].Name != "Coruscant" {
+			t.Errorf("Expected Coruscant when searching for '%s', but got %d result(s).", search, len(res.Results))
+		}
 	}
 }
 
-func executeRequest(req *http.Request) *httptest.ResponseRecorder {
-	rr := httptest.NewRecorder()
-	a.Router.ServeHTTP(rr, req)
+func TestPlanetDisplayNameFromAcceptLanguage(t *testing.T) {
+	clearDatabase()
 
-	return rr
+	response := sendRequest("POST", "/planet/", []byte(`{"name": "Coruscant", "names": {"pt-BR": "Corusca"}, "climate": "temperate", "terrain": "cityscape"}`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	res := TestSinglePlanetResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	req, _ := http.NewRequest("GET", "/planet/"+res.Planet.ID, nil)
+	req.Header.Set("Accept-Language", "pt-BR,pt;q=0.9,en;q=0.8")
+	response = executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Planet.DisplayName != "Corusca" {
+		t.Errorf("Expected display name 'Corusca', but got '%s'.", res.Planet.DisplayName)
+	}
 }
 
-func sendRequest(method string, url string, body []byte) *httptest.ResponseRecorder {
-	req, _ := http.NewRequest(method, url, bytes.NewBuffer(body))
+func TestTaxonomyCanonicalizesPlanet(t *testing.T) {
+	clearDatabase()
+
+	response := sendAdminRequest("POST", "/taxonomy/terrain", []byte(`{"term": "Desert", "synonyms": ["dessert", "deserts"]}`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	response = sendRequest("POST", "/planet/", []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "Dessert"}`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	res := TestSinglePlanetResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Planet.Terrain != "desert" {
+		t.Errorf("Expected terrain 'desert', but got '%s'.", res.Planet.Terrain)
+	}
+}
+
+func TestTaxonomyRequiresAdminToken(t *testing.T) {
+	response := sendRequest("POST", "/taxonomy/climate", []byte(`{"term": "arid"}`))
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestTaxonomyConflictingSynonym(t *testing.T) {
+	clearDatabase()
+
+	response := sendAdminRequest("POST", "/taxonomy/climate", []byte(`{"term": "arid", "synonyms": ["dry"]}`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	response = sendAdminRequest("POST", "/taxonomy/climate", []byte(`{"term": "dry"}`))
+	checkResponseCode(t, http.StatusConflict, response.Code)
+}
+
+func TestUnknownTaxonomyMode(t *testing.T) {
+	mode := os.Getenv("TAXONOMY_MODE")
+	defer func() {
+		os.Setenv("TAXONOMY_MODE", mode)
+		resourceHandlers.Configure()
+	}()
+
+	os.Setenv("TAXONOMY_MODE", "stirct")
+	if err := resourceHandlers.Configure(); err == nil {
+		t.Errorf("Expected an unknown taxonomy mode to be rejected.")
+	}
+
+	if code := runCLI([]string{"serve"}); code != exitConfig {
+		t.Errorf("Expected exit code %d for an invalid configuration, but got %d.", exitConfig, code)
+	}
+}
+
+func TestRegionRollsUpPlanets(t *testing.T) {
+	clearDatabase()
+
+	regionID := createResource(t, "/region/", `{"name": "Outer Rim Territories"}`, "region")
+	sectorID := createResource(t, "/sector/", fmt.Sprintf(`{"name": "Arkanis", "regionId": "%s"}`, regionID), "sector")
+	systemID := createResource(t, "/system/", fmt.Sprintf(`{"name": "Tatoo", "sectorId": "%s"}`, sectorID), "system")
+	if systemID == "" {
+		return
+	}
+
+	response := sendRequest("POST", "/planet/", []byte(fmt.Sprintf(`{"name": "Tatooine", "climate": "arid", "terrain": "desert", "systemId": "%s"}`, systemID)))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	response = sendRequest("GET", "/region/"+regionID+"/planets", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := TestMultiplePlanetsResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Planets) != 1 {
+		t.Errorf("Expected one planet in the region, but got %d.", len(res.Planets))
+	}
+
+	response = sendRequest("DELETE", "/region/"+regionID, nil)
+	if !checkResponseCode(t, http.StatusConflict, response.Code) {
+		return
+	}
+
+	// a remocao recusada nao deixa a regiao bloqueada
+	createResource(t, "/sector/", fmt.Sprintf(`{"name": "Tatoo", "regionId": "%s"}`, regionID), "sector")
+}
+
+func TestCreateSectorInDeletingRegion(t *testing.T) {
+	clearDatabase()
+
+	regionID := createResource(t, "/region/", `{"name": "Outer Rim Territories"}`, "region")
+	if regionID == "" {
+		return
+	}
+
+	// simula uma remocao em andamento: a regiao ja foi marcada, mas ainda nao removida
+	oid, _ := primitive.ObjectIDFromHex(regionID)
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "deleting", Value: true}}}}
+	if _, err := a.DB.Database(databaseName).Collection("regions").UpdateOne(context.TODO(), bson.D{{Key: "_id", Value: oid}}, update); err != nil {
+		t.Errorf("Could not mark the region: %s.", err)
+		return
+	}
+
+	response := sendRequest("POST", "/sector/", []byte(fmt.Sprintf(`{"name": "Arkanis", "regionId": "%s"}`, regionID)))
+	if !checkResponseCode(t, http.StatusBadRequest, response.Code) {
+		return
+	}
+
+	res := common.Error{}
+	if parseReponse(t, response, &res) && res.Errors["regionId"] == "" {
+		t.Errorf("Expected the region reference to be reported, but got %v.", res.Errors)
+	}
+
+	if count, _ := a.DB.Database(databaseName).Collection("sectors").CountDocuments(context.TODO(), bson.D{}); count != 0 {
+		t.Errorf("Expected no sector to be created, but got %d.", count)
+	}
+
+	response = sendRequest("DELETE", "/region/"+regionID, nil)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+func TestCreatePlanetWithUnknownSystem(t *testing.T) {
+	clearDatabase()
+
+	response := sendRequest("POST", "/planet/", []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "desert", "systemId": "6016c8a5e18d9b3786d7eaf4"}`))
+	if !checkResponseCode(t, http.StatusBadRequest, response.Code) {
+		return
+	}
+
+	res := common.Error{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Errors["systemId"] == "" {
+		t.Errorf("Server did not list the unknown system reference.")
+	}
+}
+
+func TestUpdatePlanet(t *testing.T) {
+	clearDatabase()
+
+	response := sendRequest("POST", "/planet/", tatooineBytes)
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	res := TestSinglePlanetResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	response = sendRequest("PATCH", "/planet/"+res.Planet.ID, []byte(`{"climate": "arid"}`))
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	expectedPlanet := tatooine
+	expectedPlanet.Climate = "arid"
+	comparePlanet(t, expectedPlanet, res.Planet)
+}
+
+func TestUpdatePlanetKeepsConcurrentTagChanges(t *testing.T) {
+	clearDatabase()
+
+	id := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert", "tags": ["featured"]}`, "planet")
+	if id == "" {
+		return
+	}
+
+	// copia lida antes de a tag ser adicionada, como em uma atualizacao concorrente
+	oid, _ := primitive.ObjectIDFromHex(id)
+	stale, err := repo.GetPlanetByID(oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := sendRequest("POST", "/planet/"+id+"/tags/quiz-pool", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	stale.Climate = "temperate"
+	if err := repo.UpdatePlanet(stale, []string{"climate"}); err != nil {
+		t.Fatal(err)
+	}
+
+	response = sendRequest("GET", "/planet/"+id, nil)
+	res := TestSinglePlanetResponse{}
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Planet.Climate != "temperate" || len(res.Planet.Tags) != 2 {
+		t.Errorf("Expected the new climate and both tags, but got '%s' and %v.", res.Planet.Climate, res.Planet.Tags)
+	}
+}
+
+func TestGetPlanetsNear(t *testing.T) {
+	clearDatabase()
+
+	response := sendRequest("POST", "/planet/", []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "desert", "grid": "R-16"}`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	response = sendRequest("POST", "/planet/", []byte(`{"name": "Coruscant", "climate": "temperate", "terrain": "cityscape", "location": {"x": 12.2, "y": 9.7}}`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	created := TestSinglePlanetResponse{}
+	if !parseReponse(t, response, &created) {
+		return
+	}
+
+	if created.Planet.Grid != "M-10" {
+		t.Errorf("Expected grid square M-10, but got '%s'.", created.Planet.Grid)
+	}
+
+	response = sendRequest("GET", "/planet/near?x=17&y=15&radius=5", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := TestMatchedPlanetResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Results) != 1 || res.Results[0].Name != "Tatooine" || res.Results[0].Distance == nil {
+		t.Errorf("Expected only Tatooine with its distance, but got %d result(s).", len(res.Results))
+		return
+	}
+
+	response = sendRequest("GET", "/planet/"+created.Planet.ID+"/neighbors?k=5&format=geojson", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	collection := map[string]interface{}{}
+	if !parseReponse(t, response, &collection) {
+		return
+	}
+
+	if features, _ := collection["features"].([]interface{}); collection["type"] != "FeatureCollection" || len(features) != 1 {
+		t.Errorf("Expected a FeatureCollection with one neighbor.")
+	}
+}
+
+func TestPlanetLocationOutsideDefaultIndexBounds(t *testing.T) {
+	clearDatabase()
+
+	// fora dos limites padrao do indice 2d, mas dentro da galaxia
+	id := createResource(t, "/planet/", `{"name": "Ilum", "climate": "frozen", "terrain": "ice canyons", "location": {"x": 500, "y": 500}}`, "planet")
+	if id == "" {
+		return
+	}
+
+	response := sendRequest("PATCH", "/planet/"+id, []byte(`{"location": {"x": -500, "y": 500}}`))
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	response = sendRequest("GET", "/planet/near?x=-490&y=490&radius=20", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := TestMatchedPlanetResponse{}
+	if parseReponse(t, response, &res) && (len(res.Results) != 1 || res.Results[0].Name != "Ilum") {
+		t.Errorf("Expected Ilum near (-490, 490), but got %d result(s).", len(res.Results))
+	}
+
+	response = sendRequest("POST", "/planet/", []byte(`{"name": "Nowhere", "climate": "arid", "terrain": "desert", "location": {"x": 2000000, "y": 0}}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestBadRequestInvalidGrid(t *testing.T) {
+	response := sendRequest("POST", "/planet/", []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "desert", "grid": "16-R"}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestBadRequestNonFiniteRadius(t *testing.T) {
+	for _, query := range []string{"x=0&y=0&radius=NaN", "x=0&y=0&radius=Inf", "x=-Inf&y=0&radius=5"} {
+		response := sendRequest("GET", "/planet/near?"+query, nil)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+}
+
+func TestPlanHyperspaceRoute(t *testing.T) {
+	clearDatabase()
+
+	corellia := createResource(t, "/planet/", `{"name": "Corellia", "climate": "temperate", "terrain": "plains"}`, "planet")
+	coruscant := createResource(t, "/planet/", `{"name": "Coruscant", "climate": "temperate", "terrain": "cityscape"}`, "planet")
+	tatooine := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	if tatooine == "" {
+		return
+	}
+
+	createResource(t, "/lane/", fmt.Sprintf(`{"name": "Corellian Run", "from": "%s", "to": "%s", "distance": 4}`, corellia, coruscant), "lane")
+	createResource(t, "/lane/", fmt.Sprintf(`{"name": "Corellian Run", "from": "%s", "to": "%s", "distance": 6}`, coruscant, tatooine), "lane")
+	createResource(t, "/lane/", fmt.Sprintf(`{"name": "Long Haul", "from": "%s", "to": "%s", "distance": 15}`, corellia, tatooine), "lane")
+
+	response := sendRequest("GET", fmt.Sprintf("/route?from=%s&to=%s&class=0.5", corellia, tatooine), nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := struct {
+		Route struct {
+			Hops                 []interface{} `json:"hops"`
+			TotalDistance        float64       `json:"totalDistance"`
+			EstimatedTravelHours float64       `json:"estimatedTravelHours"`
+		} `json:"route"`
+	}{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Route.Hops) != 3 || res.Route.TotalDistance != 10 || res.Route.EstimatedTravelHours != 5 {
+		t.Errorf("Expected a route through Coruscant with distance 10, but got %d hop(s) and distance %f.", len(res.Route.Hops), res.Route.TotalDistance)
+	}
+
+	response = sendRequest("DELETE", "/planet/"+coruscant, nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	response = sendRequest("GET", fmt.Sprintf("/route?from=%s&to=%s", corellia, tatooine), nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Route.TotalDistance != 15 {
+		t.Errorf("Expected the route to be replanned after the lane removal, but got distance %f.", res.Route.TotalDistance)
+	}
+}
+
+func TestLaneDistanceFollowsLocation(t *testing.T) {
+	clearDatabase()
+
+	corellia := createResource(t, "/planet/", `{"name": "Corellia", "climate": "temperate", "terrain": "plains", "location": {"x": 0, "y": 0}}`, "planet")
+	tatooine := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert", "location": {"x": 3, "y": 4}}`, "planet")
+	if tatooine == "" {
+		return
+	}
+
+	measured := createResource(t, "/lane/", fmt.Sprintf(`{"name": "Corellian Run", "from": "%s", "to": "%s"}`, corellia, tatooine), "lane")
+	fixed := createResource(t, "/lane/", fmt.Sprintf(`{"name": "Long Haul", "from": "%s", "to": "%s", "distance": 50}`, corellia, tatooine), "lane")
+	if fixed == "" {
+		return
+	}
+
+	response := sendRequest("PATCH", "/planet/"+tatooine, []byte(`{"location": {"x": 6, "y": 8}}`))
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	// so a rota medida acompanha a nova localizacao
+	for id, expected := range map[string]float64{measured: 10, fixed: 50} {
+		response = sendRequest("GET", "/lane/"+id, nil)
+		if !checkResponseCode(t, http.StatusOK, response.Code) {
+			return
+		}
+
+		res := struct {
+			Lane repo.Lane `json:"lane"`
+		}{}
+		if parseReponse(t, response, &res) && res.Lane.Distance != expected {
+			t.Errorf("Expected lane %s to have distance %f, but got %f.", id, expected, res.Lane.Distance)
+		}
+	}
+
+	response = sendRequest("GET", fmt.Sprintf("/route?from=%s&to=%s", corellia, tatooine), nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := struct {
+		Route struct {
+			TotalDistance float64 `json:"totalDistance"`
+		} `json:"route"`
+	}{}
+	if parseReponse(t, response, &res) && res.Route.TotalDistance != 10 {
+		t.Errorf("Expected the route to use the recomputed distance 10, but got %f.", res.Route.TotalDistance)
+	}
+}
+
+func TestPlanetTags(t *testing.T) {
+	clearDatabase()
+
+	tatooineID := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert", "tags": ["featured"], "metadata": {"owner": "quiz-team"}}`, "planet")
+	alderaanID := createResource(t, "/planet/", `{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands"}`, "planet")
+	if alderaanID == "" {
+		return
+	}
+
+	for _, path := range []string{"/planet/" + tatooineID + "/tags/quiz-pool", "/planet/" + alderaanID + "/tags/quiz-pool"} {
+		response := sendRequest("POST", path, nil)
+		if !checkResponseCode(t, http.StatusOK, response.Code) {
+			return
+		}
+	}
+
+	response := sendRequest("GET", "/planet/?tag=featured&tag=quiz-pool&tagMatch=all", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := TestMultiplePlanetsResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Planets) != 1 || res.Planets[0].Metadata["owner"] != "quiz-team" {
+		t.Errorf("Expected only Tatooine with its metadata, but got %d planet(s).", len(res.Planets))
+	}
+
+	response = sendRequest("DELETE", "/planet/"+tatooineID+"/tags/featured", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	response = sendRequest("GET", "/tags", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	usage := struct {
+		Tags []struct {
+			Tag   string `json:"tag"`
+			Count int    `json:"count"`
+		} `json:"tags"`
+	}{}
+	if !parseReponse(t, response, &usage) {
+		return
+	}
+
+	if len(usage.Tags) != 1 || usage.Tags[0].Tag != "quiz-pool" || usage.Tags[0].Count != 2 {
+		t.Errorf("Expected only quiz-pool used twice, but got %v.", usage.Tags)
+	}
+}
+
+func TestPlanetTagLimit(t *testing.T) {
+	clearDatabase()
+
+	id := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	if id == "" {
+		return
+	}
+
+	for i := 0; i < 50; i++ {
+		if !checkResponseCode(t, http.StatusOK, sendRequest("POST", fmt.Sprintf("/planet/%s/tags/tag-%d", id, i), nil).Code) {
+			return
+		}
+	}
+
+	response := sendRequest("POST", "/planet/"+id+"/tags/one-too-many", nil)
+	res := common.Error{}
+	if checkResponseCode(t, http.StatusBadRequest, response.Code) && parseReponse(t, response, &res) && res.Errors["tags"] == "" {
+		t.Errorf("Expected a tags error, but got %v.", res)
+	}
+
+	// uma tag que o planeta ja tem nao passa do limite
+	checkResponseCode(t, http.StatusOK, sendRequest("POST", "/planet/"+id+"/tags/tag-0", nil).Code)
+	checkResponseCode(t, http.StatusNotFound, sendRequest("POST", "/planet/"+primitive.NewObjectID().Hex()+"/tags/tag-0", nil).Code)
+}
+
+func TestUploadPlanetImage(t *testing.T) {
+	clearDatabase()
+
+	id := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	if id == "" {
+		return
+	}
+
+	buffer := bytes.Buffer{}
+	png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 800, 400)))
+
+	req, _ := http.NewRequest("PUT", "/planet/"+id+"/image", bytes.NewReader(buffer.Bytes()))
+	req.Header.Set("Content-Type", "image/png")
+	response := executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	response = sendRequest("GET", "/planet/"+id+"/image?size=thumb", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	thumb, err := png.DecodeConfig(response.Body)
+	if err != nil || thumb.Width != 256 || thumb.Height != 128 {
+		t.Errorf("Expected a 256x128 PNG thumbnail, but got %dx%d.", thumb.Width, thumb.Height)
+	}
+
+	req, _ = http.NewRequest("GET", "/planet/"+id+"/image?size=thumb", nil)
+	req.Header.Set("If-None-Match", response.Header().Get("ETag"))
+	response = executeRequest(req)
+	if !checkResponseCode(t, http.StatusNotModified, response.Code) {
+		return
+	}
+
+	// a nova imagem e gravada em arquivos novos e os anteriores sao removidos
+	req, _ = http.NewRequest("PUT", "/planet/"+id+"/image", bytes.NewReader(buffer.Bytes()))
+	req.Header.Set("Content-Type", "image/png")
+	response = executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	files, _ := a.DB.Database(databaseName).Collection("images.files").CountDocuments(context.TODO(), bson.D{})
+	if files != 2 {
+		t.Errorf("Expected only the original and thumbnail of the new image, but found %d files.", files)
+	}
+
+	response = sendRequest("GET", "/planet/"+id+"/image", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	response = sendRequest("DELETE", "/planet/"+id, nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	count, _ := a.DB.Database(databaseName).Collection("images.files").CountDocuments(context.TODO(), bson.D{})
+	if count != 0 {
+		t.Errorf("Expected the image files to be deleted with the planet, but found %d.", count)
+	}
+}
+
+func TestUploadPlanetImageUnsupportedType(t *testing.T) {
+	clearDatabase()
+
+	id := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	if id == "" {
+		return
+	}
+
+	req, _ := http.NewRequest("PUT", "/planet/"+id+"/image", bytes.NewBufferString("not an image"))
+	req.Header.Set("Content-Type", "text/plain")
+	response := executeRequest(req)
+	checkResponseCode(t, http.StatusUnsupportedMediaType, response.Code)
+}
+
+func TestBulkCreatePlanets(t *testing.T) {
+	clearDatabase()
+
+	body := []byte(`[
+		{"name": "Tatooine", "climate": "arid", "terrain": "desert"},
+		{"name": "Alderaan"},
+		{"name": "Hoth", "climate": "frozen", "terrain": "tundra"}
+	]`)
+
+	response := sendRequest("POST", "/planet/_bulk", body)
+	if !checkResponseCode(t, http.StatusMultiStatus, response.Code) {
+		return
+	}
+
+	res := TestBulkResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Summary.Created != 2 || res.Summary.Failed != 1 || res.Items[1].Status != http.StatusBadRequest {
+		t.Errorf("Expected two created planets and one failure, but got %+v.", res.Summary)
+	}
+}
+
+func TestBulkCreatePlanetsOrderedNDJSON(t *testing.T) {
+	clearDatabase()
+
+	body := []byte("{\"name\": \"Tatooine\", \"climate\": \"arid\", \"terrain\": \"desert\"}\nINVALID\n{\"name\": \"Hoth\", \"climate\": \"frozen\", \"terrain\": \"tundra\"}\n")
+
+	req, _ := http.NewRequest("POST", "/planet/_bulk?ordered=true", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	response := executeRequest(req)
+	if !checkResponseCode(t, http.StatusMultiStatus, response.Code) {
+		return
+	}
+
+	res := TestBulkResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Summary.Created != 1 || res.Summary.Failed != 1 || res.Summary.Skipped != 1 {
+		t.Errorf("Expected one created, one failed and one skipped planet, but got %+v.", res.Summary)
+	}
+}
+
+func TestExportPlanets(t *testing.T) {
+	clearDatabase()
+
+	response := sendRequest("POST", "/planet/_bulk", []byte(`[
+		{"name": "Tatooine", "climate": "arid", "terrain": "desert", "tags": ["featured"]},
+		{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands, mountains"}
+	]`))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	response = sendRequest("GET", "/planet/export?format=csv&columns=name,terrain", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	records, err := csv.NewReader(response.Body).ReadAll()
+	if err != nil || len(records) != 3 || records[0][1] != "terrain" || records[2][1] != "grasslands, mountains" {
+		t.Errorf("Expected a header and two CSV rows, but got %v.", records)
+	}
+
+	response = sendRequest("GET", "/planet/export?format=ndjson&tag=featured", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	if lines := strings.Count(response.Body.String(), "\n"); lines != 1 {
+		t.Errorf("Expected one NDJSON line, but got %d.", lines)
+	}
+
+	response = sendRequest("GET", "/planet/export?format=json", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	planets := []TestPlanet{}
+	if parseReponse(t, response, &planets) && len(planets) != 2 {
+		t.Errorf("Expected two planets in the JSON export, but got %d.", len(planets))
+	}
+}
+
+func TestImportPlanetsDryRun(t *testing.T) {
+	clearDatabase()
+
+	response := sendRequest("POST", "/planet/", tatooineBytes)
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	body := "name,climate,terrain\n" +
+		"Tatooine,temperate,\"grasslands, mountains\"\n" +
+		"Alderaan,arid,desert\n" +
+		"Hoth,,tundra\n" +
+		"alderaan,frozen,tundra\n"
+
+	req, _ := http.NewRequest("POST", "/planet/import?dryRun=true", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "text/csv")
+	response = executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := TestImportResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Summary.Skips != 1 || res.Summary.Inserts != 1 || res.Summary.Errors != 2 {
+		t.Errorf("Expected one skip, one insert and two errors, but got %+v.", res.Summary)
+	}
+
+	response = sendRequest("GET", "/planet/", nil)
+	planets := TestMultiplePlanetsResponse{}
+	if parseReponse(t, response, &planets) && len(planets.Planets) != 1 {
+		t.Errorf("Expected the dry run not to write anything, but found %d planets.", len(planets.Planets))
+	}
+}
+
+func TestImportPlanets(t *testing.T) {
+	clearDatabase()
+
+	body := `{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands"}` + "\n" + `{"name": "Hoth"}` + "\n"
+
+	req, _ := http.NewRequest("POST", "/planet/import", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	response := executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := TestImportResponse{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Summary.Inserts != 1 || res.Summary.Errors != 1 {
+		t.Errorf("Expected one insert and one error, but got %+v.", res.Summary)
+		return
+	}
+
+	response = sendRequest("GET", res.Links["errors"], nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	records, err := csv.NewReader(response.Body).ReadAll()
+	if err != nil || len(records) != 3 || records[1][0] != "2" {
+		t.Errorf("Expected the missing fields of row 2 in the error CSV, but got %v.", records)
+	}
+}
+
+func TestFailStaleImportJobs(t *testing.T) {
+	clearDatabase()
+
+	running := repo.ImportJob{Status: repo.ImportJobRunning, Format: "csv"}
+	completed := repo.ImportJob{Status: repo.ImportJobCompleted, Format: "csv"}
+	repo.CreateImportJob(&running)
+	repo.CreateImportJob(&completed)
+
+	// as duas ficaram sem sinal, mas so a que estava rodando foi interrompida
+	failed, err := repo.FailStaleImportJobs(time.Now().UTC().Add(time.Minute), "interrupted")
+	if err != nil || failed != 1 {
+		t.Errorf("Expected one interrupted job to be failed, but got %d (%v).", failed, err)
+		return
+	}
+
+	response := sendRequest("GET", "/planet/import/"+running.ObjectID.Hex(), nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := struct {
+		Job repo.ImportJob `json:"job"`
+	}{}
+	if parseReponse(t, response, &res) && (res.Job.Status != repo.ImportJobFailed || res.Job.FinishedAt == nil) {
+		t.Errorf("Expected the interrupted job to be failed, but got %+v.", res.Job)
+	}
+}
+
+func TestStrictBodyDecoding(t *testing.T) {
+	clearDatabase()
+
+	req, _ := http.NewRequest("POST", "/planet/", bytes.NewBuffer(tatooineBytes))
+	req.Header.Set("Content-Type", "text/plain")
+	if !checkResponseCode(t, http.StatusUnsupportedMediaType, executeRequest(req).Code) {
+		return
+	}
+
+	response := sendRequest("POST", "/planet/", []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "desert", "population": 200000}`))
+	res := common.Error{}
+	if checkResponseCode(t, http.StatusBadRequest, response.Code) && parseReponse(t, response, &res) && res.Errors["population"] == "" {
+		t.Errorf("Expected the unknown field to be reported, but got %v.", res.Errors)
+	}
+
+	response = sendRequest("POST", "/planet/", []byte(`{"name": "Tatooine", "climate": ["arid"], "terrain": "desert"}`))
+	res = common.Error{}
+	if checkResponseCode(t, http.StatusBadRequest, response.Code) && parseReponse(t, response, &res) && res.Errors["climate"] == "" {
+		t.Errorf("Expected the type error to be reported on the climate field, but got %v.", res.Errors)
+	}
+
+	response = sendRequest("POST", "/planet/", []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "desert"} {}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	response = sendRequest("POST", "/planet/", []byte(`{"name": "`+strings.Repeat("a", 2<<20)+`"}`))
+	checkResponseCode(t, http.StatusRequestEntityTooLarge, response.Code)
+
+	// um corpo interrompido no meio nao e um corpo grande demais
+	req, _ = http.NewRequest("POST", "/planet/", io.MultiReader(strings.NewReader(`{"name": "Tat`), failingReader{}))
+	req.Header.Set("Content-Type", "application/json")
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+}
+
+func TestContentNegotiation(t *testing.T) {
+	clearDatabase()
+
+	req, _ := http.NewRequest("POST", "/planet/", bytes.NewBufferString("name: Tatooine\nclimate: arid\nterrain: desert\n"))
+	req.Header.Set("Content-Type", "application/yaml")
+	req.Header.Set("Accept", "application/xml")
+	response := executeRequest(req)
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return
+	}
+
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/xml" {
+		t.Errorf("Expected an XML response, but got %s.", contentType)
+	}
+
+	if !strings.Contains(response.Body.String(), "<name>Tatooine</name>") {
+		t.Errorf("Expected the planet name in the XML response, but got %s.", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/planet/", nil)
+	req.Header.Set("Accept", "text/html")
+	checkResponseCode(t, http.StatusNotAcceptable, executeRequest(req).Code)
+
+	// os tipos produzidos diretamente valem apenas nas rotas que os produzem
+	for url, accept := range map[string]string{
+		"/planet/":                  "text/csv",
+		"/planet/near?x=0&y=0":      "image/png",
+		"/planet/export":            "application/geo+json",
+		"/planet/export?format=csv": "text/csv",
+	} {
+		req, _ = http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", accept)
+		expected := http.StatusNotAcceptable
+		if accept == "text/csv" && strings.HasPrefix(url, "/planet/export") {
+			expected = http.StatusOK
+		}
+		if code := executeRequest(req).Code; code != expected {
+			t.Errorf("Expected %d for %s with Accept %s, but got %d.", expected, url, accept, code)
+		}
+	}
+}
+
+func TestHypermediaFormats(t *testing.T) {
+	clearDatabase()
+	id := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	if id == "" {
+		return
+	}
+
+	req, _ := http.NewRequest("GET", "/planet/"+id, nil)
+	req.Header.Set("Accept", "application/vnd.api+json")
+	response := executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	document := struct {
+		Data struct {
+			Type  string            `json:"type"`
+			ID    string            `json:"id"`
+			Links map[string]string `json:"links"`
+		} `json:"data"`
+	}{}
+	if !parseReponse(t, response, &document) {
+		return
+	}
+
+	if document.Data.Type != "planets" || document.Data.ID != id || document.Data.Links["self"] != "/planet/"+id {
+		t.Errorf("Expected a JSON:API resource for planet %s, but got %s.", id, response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/planet/"+id, nil)
+	req.Header.Set("Accept", "application/hal+json")
+	response = executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	if !strings.Contains(response.Body.String(), `"films":{"href":"/planet/`+id+`/films"}`) {
+		t.Errorf("Expected a HAL link to the planet films, but got %s.", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/planet/"+id+"?include=bogus", nil)
+	req.Header.Set("Accept", "application/vnd.api+json")
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code)
+
+	// include invalido e rejeitado antes de o planeta ser criado
+	req = newJSONRequest("POST", "/planet/?include=bogus", []byte(`{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands"}`))
+	req.Header.Set("Accept", "application/vnd.api+json")
+	if !checkResponseCode(t, http.StatusBadRequest, executeRequest(req).Code) {
+		return
+	}
+
+	response = sendRequest("GET", "/planet/?search=Alderaan", nil)
+	res := TestMatchedPlanetResponse{}
+	if checkResponseCode(t, http.StatusOK, response.Code) && parseReponse(t, response, &res) && len(res.Results) != 0 {
+		t.Errorf("Expected no planet to be created with an invalid include, but got %d.", len(res.Results))
+	}
+}
+
+func TestCreatePlanetFromJSONAPI(t *testing.T) {
+	clearDatabase()
+
+	body := `{"data": {"type": "films", "attributes": {"name": "Tatooine", "climate": "arid", "terrain": "desert"}}}`
+	req := newJSONRequest("POST", "/planet/", []byte(body))
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	if !checkResponseCode(t, http.StatusConflict, executeRequest(req).Code) {
+		return
+	}
+
+	req = newJSONRequest("POST", "/planet/", []byte(strings.Replace(body, "films", "planets", 1)))
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	checkResponseCode(t, http.StatusCreated, executeRequest(req).Code)
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	clearDatabase()
+	id := createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	if id == "" {
+		return
+	}
+
+	response := sendRequest("GET", "/planet/?fields=name", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	list := struct {
+		Planets []map[string]interface{} `json:"planets"`
+	}{}
+	if !parseReponse(t, response, &list) {
+		return
+	}
+
+	if len(list.Planets) != 1 || len(list.Planets[0]) != 2 || list.Planets[0]["id"] != id || list.Planets[0]["name"] != "Tatooine" {
+		t.Errorf("Expected only the id and name of the planet, but got %v.", list.Planets)
+	}
+
+	response = sendRequest("GET", "/planet/"+id+"?exclude=climate,terrain", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := struct {
+		Planet map[string]interface{} `json:"planet"`
+	}{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if _, ok := res.Planet["climate"]; ok || res.Planet["name"] != "Tatooine" {
+		t.Errorf("Expected the planet without climate and terrain, but got %v.", res.Planet)
+	}
+
+	checkResponseCode(t, http.StatusBadRequest, sendRequest("GET", "/planet/?fields=population", nil).Code)
+	checkResponseCode(t, http.StatusBadRequest, sendRequest("GET", "/planet/?fields=name&exclude=climate", nil).Code)
+}
+
+func TestPlanetFilterQuery(t *testing.T) {
+	clearDatabase()
+	createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Naboo", "climate": "temperate", "terrain": "grassy hills"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Hoth", "climate": "frozen", "terrain": "tundra", "tags": ["cold"]}`, "planet")
+
+	response := sendRequest("GET", "/planet/?climate[in]=arid,temperate&name[prefix]=ta", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := struct {
+		Planets []TestPlanet `json:"planets"`
+	}{}
+	if !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Planets) != 1 || res.Planets[0].Name != "Tatooine" {
+		t.Errorf("Expected only Tatooine, but got %v.", res.Planets)
+	}
+
+	if warning := response.Header().Get("Warning"); !strings.Contains(warning, "climate") {
+		t.Errorf("Expected an index coverage warning, but got '%s'.", warning)
+	}
+
+	// cada termo do clima e comparado separadamente
+	createResource(t, "/planet/", `{"name": "Bespin", "climate": "Arid, temperate", "terrain": "gas giant"}`, "planet")
+	response = sendRequest("GET", "/planet/?climate[in]=temperate,murky", nil)
+	res.Planets = nil
+	if checkResponseCode(t, http.StatusOK, response.Code) && parseReponse(t, response, &res) && len(res.Planets) != 2 {
+		t.Errorf("Expected Naboo and Bespin, but got %v.", res.Planets)
+	}
+
+	response = sendRequest("GET", "/planet/?climate[nin]=arid", nil)
+	res.Planets = nil
+	if checkResponseCode(t, http.StatusOK, response.Code) && parseReponse(t, response, &res) && len(res.Planets) != 2 {
+		t.Errorf("Expected Naboo and Hoth, but got %v.", res.Planets)
+	}
+
+	response = sendRequest("GET", "/planet/?tags[eq]=cold&filmsAppearedIn[gte]=0", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	if warning := response.Header().Get("Warning"); warning != "" {
+		t.Errorf("Expected no warning for a filter on an indexed field, but got '%s'.", warning)
+	}
+
+	// as tags sao gravadas em minusculas, entao o prefixo usa o indice mesmo em maiusculas
+	response = sendRequest("GET", "/planet/?tags[prefix]=CO", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Planets) != 1 || res.Planets[0].Name != "Hoth" || response.Header().Get("Warning") != "" {
+		t.Errorf("Expected only Hoth without a warning, but got %v and '%s'.", res.Planets, response.Header().Get("Warning"))
+	}
+
+	response = sendRequest("GET", "/planet/?population[gt]=10&filmsAppearedIn[gte]=many", nil)
+	if !checkResponseCode(t, http.StatusBadRequest, response.Code) {
+		return
+	}
+
+	errs := struct {
+		Errors map[string]string `json:"errors"`
+	}{}
+	if parseReponse(t, response, &errs) && (errs.Errors["population[gt]"] == "" || errs.Errors["filmsAppearedIn[gte]"] == "") {
+		t.Errorf("Expected errors for both filters, but got %v.", errs.Errors)
+	}
+}
+
+func TestSearchModes(t *testing.T) {
+	clearDatabase()
+	createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Naboo", "climate": "temperate", "terrain": "grassy hills"}`, "planet")
+
+	cases := []struct {
+		query    string
+		expected int
+	}{
+		{"search=.*", 0},
+		{"search=atoo", 1},
+		{"search=tat&match=prefix", 1},
+		{"search=atoo&match=prefix", 0},
+		{"search=TATOOINE&match=exact", 1},
+		{"search=tatoo&match=exact", 0},
+	}
+
+	for _, c := range cases {
+		response := sendRequest("GET", "/planet/?"+c.query, nil)
+		if !checkResponseCode(t, http.StatusOK, response.Code) {
+			return
+		}
+
+		res := TestMatchedPlanetResponse{}
+		if parseReponse(t, response, &res) && len(res.Results) != c.expected {
+			t.Errorf("Expected %d result(s) for '%s', but got %d.", c.expected, c.query, len(res.Results))
+		}
+	}
+
+	checkResponseCode(t, http.StatusUnauthorized, sendRequest("GET", "/planet/?search=^t.*e$&match=regex", nil).Code)
+	checkResponseCode(t, http.StatusBadRequest, sendRequest("GET", "/planet/?search=tat&match=fuzzy", nil).Code)
+	checkResponseCode(t, http.StatusBadRequest, sendAdminRequest("GET", "/planet/?search=(a%2B)%2B&match=regex", nil).Code)
+
+	response := sendAdminRequest("GET", "/planet/?search=^t.*e$&match=regex", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	res := TestMatchedPlanetResponse{}
+	if parseReponse(t, response, &res) && (len(res.Results) != 1 || res.Results[0].Name != "Tatooine") {
+		t.Errorf("Expected Tatooine for the admin regex search, but got %v.", res.Results)
+	}
+}
+
+func TestFullTextSearch(t *testing.T) {
+	clearDatabase()
+	createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert", "description": "A desert world orbiting twin suns."}`, "planet")
+	createResource(t, "/planet/", `{"name": "Jakku", "climate": "arid", "terrain": "deserts", "description": "A remote planet with a graveyard of ships."}`, "planet")
+	createResource(t, "/planet/", `{"name": "Hoth", "climate": "frozen", "terrain": "tundra", "description": "Um planeta gelado coberto de geleiras.", "language": "pt"}`, "planet")
+
+	res := struct {
+		Results []struct {
+			Planet     TestPlanet          `json:"planet"`
+			Score      float64             `json:"score"`
+			Highlights map[string][]string `json:"highlights"`
+		} `json:"results"`
+	}{}
+
+	response := sendRequest("GET", "/planet/search?q=desert", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Results) != 2 || res.Results[0].Planet.Name != "Tatooine" || res.Results[0].Score < res.Results[1].Score {
+		t.Errorf("Expected Tatooine and Jakku ranked by score, but got %v.", res.Results)
+		return
+	}
+
+	if highlights := res.Results[0].Highlights["description"]; len(highlights) != 1 || !strings.Contains(highlights[0], "<em>desert</em>") {
+		t.Errorf("Expected the description to be highlighted, but got %v.", res.Results[0].Highlights)
+	}
+
+	response = sendRequest("GET", `/planet/search?q=%22twin+suns%22+-jakku`, nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Results) != 1 || res.Results[0].Planet.Name != "Tatooine" {
+		t.Errorf("Expected only Tatooine for the phrase search, but got %v.", res.Results)
+	}
+
+	response = sendRequest("GET", "/planet/search?q=geleira&lang=pt", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Results) != 1 || res.Results[0].Planet.Name != "Hoth" {
+		t.Errorf("Expected Hoth for the Portuguese search, but got %v.", res.Results)
+	}
+
+	checkResponseCode(t, http.StatusBadRequest, sendRequest("GET", "/planet/search?q=-desert", nil).Code)
+	checkResponseCode(t, http.StatusBadRequest, sendRequest("GET", "/planet/search?q=desert&lang=fr", nil).Code)
+}
+
+func TestFuzzySearchAndSuggestions(t *testing.T) {
+	clearDatabase()
+	createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands, mountains"}`, "planet")
+
+	res := struct {
+		Results     []TestPlanet `json:"results"`
+		Suggestions []struct {
+			Name     string `json:"name"`
+			Distance int    `json:"distance"`
+		} `json:"suggestions"`
+	}{}
+
+	response := sendRequest("GET", "/planet/?search=Alderan", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Results) != 0 || len(res.Suggestions) != 1 || res.Suggestions[0].Name != "Alderaan" || res.Suggestions[0].Distance != 1 {
+		t.Errorf("Expected Alderaan as the only suggestion, but got %v.", res.Suggestions)
+	}
+
+	response = sendRequest("GET", "/planet/?search=Tatuine&match=fuzzy", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Results) != 1 || res.Results[0].Name != "Tatooine" {
+		t.Errorf("Expected Tatooine for the fuzzy search, but got %v.", res.Results)
+	}
+
+	// o indice acompanha as alteracoes feitas pela API
+	createResource(t, "/planet/", `{"name": "Naboo", "climate": "temperate", "terrain": "grassy hills"}`, "planet")
+	response = sendRequest("GET", "/planet/?search=Nabu&match=fuzzy", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Results) != 1 || res.Results[0].Name != "Naboo" {
+		t.Errorf("Expected the new planet in the fuzzy search, but got %v.", res.Results)
+	}
+}
+
+func TestPlanetSuggest(t *testing.T) {
+	clearDatabase()
+	createResource(t, "/planet/", `{"name": "Taris", "climate": "temperate", "terrain": "cityscape"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands, mountains"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Coruscant", "aliases": ["Imperial Center"], "climate": "temperate", "terrain": "cityscape"}`, "planet")
+
+	res := struct {
+		Suggestions []struct {
+			Name    string `json:"name"`
+			Matched string `json:"matched"`
+		} `json:"suggestions"`
+	}{}
+
+	response := sendRequest("GET", "/planet/suggest?prefix=TA", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Suggestions) != 1 || res.Suggestions[0].Name != "Taris" {
+		t.Errorf("Expected Taris as the only suggestion, but got %v.", res.Suggestions)
+	}
+
+	// palavras no meio do nome tambem sao encontradas
+	response = sendRequest("GET", "/planet/suggest?prefix=cen", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Suggestions) != 1 || res.Suggestions[0].Name != "Coruscant" || res.Suggestions[0].Matched != "Imperial Center" {
+		t.Errorf("Expected Coruscant by its alias, but got %v.", res.Suggestions)
+	}
+
+	// a arvore acompanha as alteracoes feitas pela API
+	id := createResource(t, "/planet/", `{"name": "Takodana", "climate": "temperate", "terrain": "forests, lakes"}`, "planet")
+	response = sendRequest("GET", "/planet/suggest?prefix=ta&limit=1", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Suggestions) != 1 || res.Suggestions[0].Name != "Takodana" {
+		t.Errorf("Expected Takodana as the first suggestion, but got %v.", res.Suggestions)
+	}
+
+	sendRequest("DELETE", "/planet/"+id, nil)
+	response = sendRequest("GET", "/planet/suggest?prefix=tak", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if len(res.Suggestions) != 0 {
+		t.Errorf("Expected no suggestions after the removal, but got %v.", res.Suggestions)
+	}
+
+	response = sendRequest("GET", "/planet/suggest", nil)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	response = sendRequest("GET", "/planet/suggest?prefix=ta&limit=21", nil)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestPlanetStats(t *testing.T) {
+	clearDatabase()
+	createResource(t, "/planet/", `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands, mountains"}`, "planet")
+	createResource(t, "/planet/", `{"name": "Naboo", "climate": "temperate", "terrain": "grassy hills"}`, "planet")
+
+	type count struct {
+		Term  string `json:"term"`
+		Count int64  `json:"count"`
+	}
+	res := struct {
+		Stats struct {
+			Total    int64   `json:"total"`
+			Climates []count `json:"climates"`
+			Terrains []count `json:"terrains"`
+			Films    []struct {
+				Count int64 `json:"count"`
+			} `json:"filmsAppearedIn"`
+			TopByFilms    []TestPlanet `json:"topByFilms"`
+			CreatedPerDay []struct {
+				Day   string `json:"day"`
+				Count int64  `json:"count"`
+			} `json:"createdPerDay"`
+		} `json:"stats"`
+	}{}
+
+	response := sendRequest("GET", "/planet/stats?top=2", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	stats := res.Stats
+	if stats.Total != 3 {
+		t.Errorf("Expected 3 planets, but got %d.", stats.Total)
+	}
+
+	if len(stats.Climates) != 2 || stats.Climates[0] != (count{"temperate", 2}) || stats.Climates[1] != (count{"arid", 1}) {
+		t.Errorf("Expected temperate and arid climates, but got %v.", stats.Climates)
+	}
+
+	// os termos separados por virgula sao contados um a um
+	if len(stats.Terrains) != 4 {
+		t.Errorf("Expected 4 terrains, but got %v.", stats.Terrains)
+	}
+
+	var films, created int64
+	for _, bucket := range stats.Films {
+		films += bucket.Count
+	}
+	for _, day := range stats.CreatedPerDay {
+		created += day.Count
+	}
+
+	if films != 3 || created != 3 {
+		t.Errorf("Expected every planet in the films and creation distributions, but got %d and %d.", films, created)
+	}
+
+	if len(stats.TopByFilms) != 2 {
+		t.Errorf("Expected the top 2 planets, but got %v.", stats.TopByFilms)
+	}
+
+	// os mesmos filtros da listagem restringem as estatisticas
+	response = sendRequest("GET", "/planet/stats?climate[eq]=temperate", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) || !parseReponse(t, response, &res) {
+		return
+	}
+
+	if res.Stats.Total != 2 || len(res.Stats.Climates) != 1 {
+		t.Errorf("Expected only the temperate planets, but got %v.", res.Stats)
+	}
+
+	response = sendRequest("GET", "/planet/stats?top=0", nil)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestGraphQL(t *testing.T) {
+	clearDatabase()
+
+	// o GraphiQL so existe com APP_ENV=development
+	if os.Getenv("APP_ENV") != "development" {
+		response := sendRequest("GET", "/graphql", nil)
+		if response.Code == http.StatusOK {
+			t.Errorf("Expected GraphiQL to be disabled outside development mode.")
+		}
+	}
+
+	type graphqlPlanet struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		Climate string `json:"climate"`
+		Films   []struct {
+			Title string `json:"title"`
+		} `json:"films"`
+	}
+	res := struct {
+		Data struct {
+			CreatePlanet *graphqlPlanet `json:"createPlanet"`
+			UpdatePlanet *graphqlPlanet `json:"updatePlanet"`
+			DeletePlanet string         `json:"deletePlanet"`
+			Planet       *graphqlPlanet `json:"planet"`
+			Planets      struct {
+				TotalCount  int             `json:"totalCount"`
+				HasNextPage bool            `json:"hasNextPage"`
+				Items       []graphqlPlanet `json:"items"`
+			} `json:"planets"`
+		} `json:"data"`
+		Errors []struct {
+			Message    string `json:"message"`
+			Extensions struct {
+				Status int               `json:"status"`
+				Errors map[string]string `json:"errors"`
+			} `json:"extensions"`
+		} `json:"errors"`
+	}{}
+
+	execute := func(query string, variables map[string]interface{}) bool {
+		res.Errors = nil
+		body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+		response := sendRequest("POST", "/graphql", body)
+		return checkResponseCode(t, http.StatusOK, response.Code) && parseReponse(t, response, &res)
+	}
+
+	create := `mutation($input: PlanetInput!) { createPlanet(input: $input) { id name climate } }`
+	for _, name := range []string{"Tatooine", "Taris", "Hoth"} {
+		if !execute(create, map[string]interface{}{"input": map[string]interface{}{"name": name, "climate": "arid", "terrain": "desert"}}) {
+			return
+		}
+		if len(res.Errors) > 0 || res.Data.CreatePlanet == nil || res.Data.CreatePlanet.Name != name {
+			t.Errorf("Expected %s to be created, but got %v.", name, res.Errors)
+			return
+		}
+	}
+	id := res.Data.CreatePlanet.ID
+
+	// as validacoes sao as mesmas das rotas REST
+	if !execute(create, map[string]interface{}{"input": map[string]interface{}{"name": "Naboo"}}) {
+		return
+	}
+	if len(res.Errors) != 1 || res.Errors[0].Extensions.Status != http.StatusBadRequest || res.Errors[0].Extensions.Errors["climate"] == "" {
+		t.Errorf("Expected the missing climate to be reported, but got %v.", res.Errors)
+	}
+
+	query := `{ planets(filter: {search: "ta", match: "prefix"}, first: 1) { totalCount hasNextPage items { name films { title } } } }`
+	if !execute(query, nil) {
+		return
+	}
+	planets := res.Data.Planets
+	if len(res.Errors) > 0 || planets.TotalCount != 2 || !planets.HasNextPage || len(planets.Items) != 1 || planets.Items[0].Name != "Tatooine" {
+		t.Errorf("Expected the first of two planets, but got %v (%v).", planets, res.Errors)
+	}
+
+	update := `mutation($id: ID!) { updatePlanet(id: $id, input: {climate: "frozen"}) { climate } }`
+	if !execute(update, map[string]interface{}{"id": id}) {
+		return
+	}
+	if len(res.Errors) > 0 || res.Data.UpdatePlanet == nil || res.Data.UpdatePlanet.Climate != "frozen" {
+		t.Errorf("Expected the climate to be updated, but got %v.", res.Errors)
+	}
+
+	if !execute(`mutation($id: ID!) { deletePlanet(id: $id) }`, map[string]interface{}{"id": id}) {
+		return
+	}
+	if len(res.Errors) > 0 || res.Data.DeletePlanet != id {
+		t.Errorf("Expected the planet to be deleted, but got %v.", res.Errors)
+	}
+
+	if !execute(`query($id: ID!) { planet(id: $id) { name } }`, map[string]interface{}{"id": id}) {
+		return
+	}
+	if len(res.Errors) > 0 || res.Data.Planet != nil {
+		t.Errorf("Expected no planet after the removal, but got %v.", res.Data.Planet)
+	}
+
+	response := sendRequest("POST", "/graphql", []byte(`{"query": ""}`))
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func TestGRPCPlanetService(t *testing.T) {
+	clearDatabase()
+
+	// o servidor da aplicacao em uma conexao em memoria
+	listener := bufconn.Listen(1 << 20)
+	go a.GrpcServer.Serve(listener)
+	defer listener.Close()
+
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.Dial() })
+	conn, err := grpc.DialContext(context.Background(), "bufnet", dialer, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Could not connect to the gRPC server: %s.", err)
+	}
+	defer conn.Close()
+
+	client := planetpb.NewPlanetServiceClient(conn)
+	ctx := context.Background()
+
+	created, err := client.Create(ctx, &planetpb.CreatePlanetRequest{Name: "Tatooine", Climate: "arid", Terrain: "desert"})
+	if err != nil {
+		t.Fatalf("Expected the planet to be created, but got %s.", err)
+	}
+	client.Create(ctx, &planetpb.CreatePlanetRequest{Name: "Hoth", Climate: "frozen", Terrain: "tundra"})
+
+	planet, err := client.Get(ctx, &planetpb.GetPlanetRequest{Id: created.Id})
+	if err != nil || planet.Name != "Tatooine" || planet.DisplayName != "Tatooine" {
+		t.Errorf("Expected Tatooine, but got %v (%v).", planet, err)
+	}
+
+	// os erros de validacao trazem os campos nos detalhes
+	_, err = client.Create(ctx, &planetpb.CreatePlanetRequest{Name: "Naboo"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, but got %s.", st.Code())
+	}
+
+	fields := map[string]bool{}
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.FieldViolations {
+				fields[violation.Field] = true
+			}
+		}
+	}
+	if !fields["climate"] || !fields["terrain"] {
+		t.Errorf("Expected climate and terrain violations, but got %v.", fields)
+	}
+
+	stream, err := client.List(ctx, &planetpb.ListPlanetsRequest{
+		Conditions: []*planetpb.Condition{{Field: "climate", Operator: "eq", Value: "frozen"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected the planets to be listed, but got %s.", err)
+	}
+
+	names := []string{}
+	for {
+		planet, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		names = append(names, planet.Name)
+	}
+	if len(names) != 1 || names[0] != "Hoth" {
+		t.Errorf("Expected only Hoth in the stream, but got %v.", names)
+	}
+
+	if _, err := client.Delete(ctx, &planetpb.DeletePlanetRequest{Id: created.Id}); err != nil {
+		t.Errorf("Expected the planet to be deleted, but got %s.", err)
+	}
+
+	if _, err := client.Get(ctx, &planetpb.GetPlanetRequest{Id: created.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound after the removal, but got %v.", err)
+	}
+
+	if _, err := client.Search(ctx, &planetpb.SearchPlanetsRequest{Query: "desert", Language: "fr"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown language, but got %v.", err)
+	}
+}
+
+func TestPlanetSchemaValidator(t *testing.T) {
+	clearDatabase()
+
+	body := fmt.Sprintf(`{"name": "%s", "climate": "arid", "terrain": "desert"}`, strings.Repeat("a", 101))
+	response := sendRequest("POST", "/planet/", []byte(body))
+	if !checkResponseCode(t, http.StatusBadRequest, response.Code) {
+		return
+	}
+
+	res := common.Error{}
+	if parseReponse(t, response, &res) && res.Errors["name"] == "" {
+		t.Errorf("Expected the name length to be reported, but got %v.", res.Errors)
+	}
+
+	// escritas fora da API tambem passam pelo validador
+	invalid := bson.D{{Key: "name", Value: "Hoth"}, {Key: "climate", Value: 42}}
+	if _, err := a.DB.Database(databaseName).Collection("planets").InsertOne(context.TODO(), invalid); err == nil {
+		t.Errorf("Expected the validator to reject a planet without terrain and with a numeric climate.")
+	}
+
+	unsupported := bson.D{{Key: "name", Value: "Hoth"}, {Key: "climate", Value: "frozen"}, {Key: "terrain", Value: "tundra"}, {Key: "language", Value: "xx"}}
+	if _, err := a.DB.Database(databaseName).Collection("planets").InsertOne(context.TODO(), unsupported); err == nil {
+		t.Errorf("Expected the validator to reject a planet with an unsupported language.")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	clearDatabase()
+
+	response := sendRequest("GET", "/readyz", nil)
+	if !checkResponseCode(t, http.StatusServiceUnavailable, response.Code) {
+		return
+	}
+
+	if applied, err := repo.MigrateUp(); err != nil || len(applied) == 0 {
+		t.Errorf("Expected the pending migrations to be applied, but got %v (%v).", applied, err)
+		return
+	}
+
+	response = sendRequest("GET", "/readyz", nil)
+	if !checkResponseCode(t, http.StatusOK, response.Code) {
+		return
+	}
+
+	reverted, err := repo.MigrateDown()
+	if err != nil || reverted == nil {
+		t.Errorf("Expected the last migration to be reverted, but got %v.", err)
+		return
+	}
+
+	state, err := repo.GetMigrationState()
+	if err != nil || state.Pending != 1 || state.Current != reverted.Version-1 {
+		t.Errorf("Expected one pending migration after reverting, but got %+v.", state)
+	}
+
+	// desfaz ate chegar na planets_search_keys, que e irreversivel
+	for {
+		reverted, err = repo.MigrateDown()
+		if err != nil || reverted == nil {
+			break
+		}
+	}
+	if err == nil || err.Code != common.EINVALID {
+		t.Errorf("Expected an irreversible migration to stop the revert, but got %v.", err)
+	}
+	if state, _ := repo.GetMigrationState(); state == nil || state.Current != 3 {
+		t.Errorf("Expected migration 3 to stay applied, but got %+v.", state)
+	}
+
+	// outra instancia segurando o lock
+	lock := bson.D{{Key: "_id", Value: "lock"}, {Key: "owner", Value: "other"}, {Key: "lockedAt", Value: time.Now().UTC()}}
+	if _, err := a.DB.Database(databaseName).Collection("schema_migrations").InsertOne(context.TODO(), lock); err != nil {
+		panic(err)
+	}
+
+	if _, err := repo.MigrateUp(); err == nil || err.Code != common.ECONFLICT {
+		t.Errorf("Expected the migrations to be locked, but got %v.", err)
+	}
+}
+
+func TestCLIUnknownCommand(t *testing.T) {
+	if code := runCLI([]string{"bogus"}); code != exitUsage {
+		t.Errorf("Expected exit code %d for an unknown command, but got %d.", exitUsage, code)
+	}
+}
+
+func TestInitializeExitCode(t *testing.T) {
+	cause := errors.New("cause")
+	cases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"config", &InitializeError{Step: InitConfig, Err: cause}, exitConfig},
+		{"database", &InitializeError{Step: InitDatabase, Err: cause}, exitUnavailable},
+		{"migrations", &InitializeError{Step: InitMigrations, Err: cause}, exitFailure},
+		{"locked migrations", &InitializeError{Step: InitMigrations, Temporary: true, Err: cause}, exitTempFail},
+		{"other error", cause, exitFailure},
+	}
+
+	for _, c := range cases {
+		if code := initializeExitCode(c.err); code != c.expected {
+			t.Errorf("Expected exit code %d for %s, but got %d.", c.expected, c.name, code)
+		}
+	}
+}
+
+func TestMigrationExitCode(t *testing.T) {
+	cases := []struct {
+		err      *common.Error
+		expected int
+	}{
+		{common.CreateConflictError("The migrations are locked by another instance."), exitTempFail},
+		{common.CreateBadRequestError("Migration 3 (planets_search_keys) is irreversible and cannot be reverted."), exitFailure},
+		{common.CreateGenericInternalError(errors.New("cause")), exitFailure},
+	}
+
+	for _, c := range cases {
+		if code := migrationExitCode(c.err); code != c.expected {
+			t.Errorf("Expected exit code %d for '%s', but got %d.", c.expected, c.err.Message, code)
+		}
+	}
+}
+
+func TestCLIExitStatus(t *testing.T) {
+	clearDatabase()
+
+	// os comandos usam o banco de producao e fecham a propria conexao; os repositorios voltam
+	// para a conexao dos testes no fim
+	dbName := os.Getenv("MONGODB_DBNAME_PROD")
+	os.Setenv("MONGODB_DBNAME_PROD", databaseName)
+	defer func() {
+		os.Setenv("MONGODB_DBNAME_PROD", dbName)
+		repo.Initialize(a.DB, databaseName)
+	}()
+
+	cases := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"migrate", "sideways"}, exitUsage},
+		{[]string{"seed", "--from-fixture", "does-not-exist.json"}, exitNoInput},
+		{[]string{"import", "--format", "xml", "planets.xml"}, exitUsage},
+		{[]string{"migrate", "status"}, exitOK},
+	}
+
+	for _, c := range cases {
+		if code := runCLI(c.args); code != c.expected {
+			t.Errorf("Expected exit code %d for %v, but got %d.", c.expected, c.args, code)
+		}
+	}
+}
+
+func clearDatabase() {
+	for _, collection := range []string{"planets", "taxonomy", "regions", "sectors", "systems", "lanes", "images.files", "images.chunks", "importJobs", "importErrors", "schema_migrations"} {
+		if _, err := a.DB.Database(databaseName).Collection(collection).DeleteMany(context.TODO(), bson.D{}); err != nil {
+			panic(err)
+		}
+	}
+	// os dados em memoria refletiam os planetas removidos
+	fuzzy.Invalidate()
+	autocomplete.Invalidate()
+}
+
+// leitor que falha, como um corpo interrompido pelo cliente
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func executeRequest(req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func sendRequest(method string, url string, body []byte) *httptest.ResponseRecorder {
+	return executeRequest(newJSONRequest(method, url, body))
+}
+
+// cria um recurso e retorna o seu id
+func createResource(t *testing.T, url string, body string, key string) string {
+	response := sendRequest("POST", url, []byte(body))
+	if !checkResponseCode(t, http.StatusCreated, response.Code) {
+		return ""
+	}
+
+	res := map[string]interface{}{}
+	if !parseReponse(t, response, &res) {
+		return ""
+	}
+
+	resource, _ := res[key].(map[string]interface{})
+	id, _ := resource["id"].(string)
+	return id
+}
+
+func newJSONRequest(method string, url string, body []byte) *http.Request {
+	req, _ := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req
+}
+
+func sendAdminRequest(method string, url string, body []byte) *httptest.ResponseRecorder {
+	req := newJSONRequest(method, url, body)
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("ADMIN_TOKEN"))
 	return executeRequest(req)
 }
 
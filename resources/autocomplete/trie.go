@@ -0,0 +1,275 @@
+package autocomplete
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/memindex"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// quantidade de planetas guardados em cada no; tambem e o limite de uma consulta
+const MaxLimit = 20
+
+// a arvore e recarregada depois desse tempo, para incluir os planetas alterados por outras
+// instancias; a recarga acontece em segundo plano e a arvore antiga continua respondendo
+const maxTrieAge = 5 * time.Minute
+
+type Suggestion struct {
+	PlanetID primitive.ObjectID `json:"id"`
+	Name     string             `json:"name"`
+	// nome, apelido ou nome localizado que comeca com o prefixo
+	Matched         string `json:"matched"`
+	FilmsAppearedIn int    `json:"filmsAppearedIn"`
+}
+
+type node struct {
+	children map[rune]*node
+	// nomes que terminam neste no
+	items []*Suggestion
+	// os planetas mais populares da subarvore, um por planeta, ja ordenados
+	top []*Suggestion
+}
+
+// arvore de prefixos dos nomes dos planetas; cada no guarda os planetas mais populares
+// abaixo dele, entao uma consulta so percorre o prefixo
+type Trie struct {
+	mu       sync.RWMutex
+	root     *node
+	byPlanet map[primitive.ObjectID][]string
+}
+
+var tries = memindex.NewHolder("autocomplete", maxTrieAge, true, func() (memindex.Index, *common.Error) {
+	return loadTrie()
+})
+
+func NewTrie(planets []*repo.Planet) *Trie {
+	t := &Trie{root: newNode(), byPlanet: map[primitive.ObjectID][]string{}}
+	for _, planet := range planets {
+		t.insert(planet)
+	}
+
+	return t
+}
+
+func newNode() *node {
+	return &node{children: map[rune]*node{}}
+}
+
+// carrega a arvore do banco; chamado na inicializacao do servidor, para que a primeira
+// sugestao nao espere a leitura de todos os planetas
+func Load() error {
+	err := tries.Load()
+	if err != nil && err.Detail != "" {
+		return errors.New(err.Message + " " + err.Detail)
+	} else if err != nil {
+		return errors.New(err.Message)
+	}
+
+	return nil
+}
+
+func loadTrie() (*Trie, *common.Error) {
+	projection, err := repo.NewPlanetProjection([]string{"name", "aliases", "names", "filmsAppearedIn"}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	planets, err := repo.GetMatchedPlanets(repo.PlanetFilter{Projection: projection})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTrie(planets), nil
+}
+
+func Current() (*Trie, *common.Error) {
+	t, err := tries.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.(*Trie), nil
+}
+
+// descarta a arvore depois de importacoes e limpezas; a proxima sugestao a monta de novo
+func Invalidate() {
+	tries.Invalidate()
+}
+
+// as sugestoes refletem os nomes e a contagem de filmes gravados por esta instancia na hora
+func Update(planet *repo.Planet) {
+	tries.Update(planet)
+}
+
+func Remove(id primitive.ObjectID) {
+	tries.Remove(id)
+}
+
+func (t *Trie) Update(planet *repo.Planet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.remove(planet.ObjectID)
+	t.insert(planet)
+}
+
+func (t *Trie) Remove(id primitive.ObjectID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.remove(id)
+}
+
+// ate limit planetas com algum nome comecando pelo prefixo, dos que aparecem em mais filmes
+// para os que aparecem em menos
+func (t *Trie) Suggest(prefix string, limit int) []Suggestion {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := t.root
+	for _, c := range utils.NormalizeTerm(prefix) {
+		if n = n.children[c]; n == nil {
+			return []Suggestion{}
+		}
+	}
+
+	if limit > len(n.top) {
+		limit = len(n.top)
+	}
+
+	suggestions := make([]Suggestion, limit)
+	for i := range suggestions {
+		suggestions[i] = *n.top[i]
+	}
+
+	return suggestions
+}
+
+// chaves de um nome: o nome inteiro e o trecho a partir de cada palavra seguinte,
+// para que "Imperial Center" tambem seja encontrado por "cen"
+func nameKeys(name string) []string {
+	key := utils.NormalizeTerm(name)
+	keys := []string{key}
+
+	for i, c := range key {
+		if c == ' ' && i+1 < len(key) && key[i+1] != ' ' {
+			keys = append(keys, key[i+1:])
+		}
+	}
+
+	return keys
+}
+
+func (t *Trie) insert(planet *repo.Planet) {
+	for _, name := range planet.AllNames() {
+		item := &Suggestion{PlanetID: planet.ObjectID, Name: planet.Name, Matched: name, FilmsAppearedIn: planet.FilmsAppearedIn}
+
+		for _, key := range nameKeys(name) {
+			if key == "" {
+				continue
+			}
+			t.byPlanet[planet.ObjectID] = append(t.byPlanet[planet.ObjectID], key)
+
+			n := t.root
+			addTop(n, item)
+			for _, c := range key {
+				child := n.children[c]
+				if child == nil {
+					child = newNode()
+					n.children[c] = child
+				}
+				n = child
+				addTop(n, item)
+			}
+			n.items = append(n.items, item)
+		}
+	}
+}
+
+func (t *Trie) remove(planetID primitive.ObjectID) {
+	for _, key := range t.byPlanet[planetID] {
+		path := []*node{t.root}
+		n := t.root
+		for _, c := range key {
+			if n = n.children[c]; n == nil {
+				break
+			}
+			path = append(path, n)
+		}
+		if n == nil {
+			continue
+		}
+
+		n.items = withoutPlanet(n.items, planetID)
+
+		// refaz os mais populares de baixo para cima e remove os nos que ficaram vazios
+		runes := []rune(key)
+		for i := len(path) - 1; i >= 0; i-- {
+			recomputeTop(path[i])
+			if i > 0 && len(path[i].top) == 0 {
+				delete(path[i-1].children, runes[i-1])
+			}
+		}
+	}
+
+	delete(t.byPlanet, planetID)
+}
+
+func addTop(n *node, item *Suggestion) {
+	for _, s := range n.top {
+		if s.PlanetID == item.PlanetID {
+			return
+		}
+	}
+
+	i := sort.Search(len(n.top), func(i int) bool { return ranksBefore(item, n.top[i]) })
+	if i >= MaxLimit {
+		return
+	}
+
+	n.top = append(n.top, nil)
+	copy(n.top[i+1:], n.top[i:])
+	n.top[i] = item
+	if len(n.top) > MaxLimit {
+		n.top = n.top[:MaxLimit]
+	}
+}
+
+func recomputeTop(n *node) {
+	n.top = nil
+	for _, item := range n.items {
+		addTop(n, item)
+	}
+	for _, child := range n.children {
+		for _, item := range child.top {
+			addTop(n, item)
+		}
+	}
+}
+
+// mais filmes primeiro; empates pelo nome
+func ranksBefore(a *Suggestion, b *Suggestion) bool {
+	if a.FilmsAppearedIn != b.FilmsAppearedIn {
+		return a.FilmsAppearedIn > b.FilmsAppearedIn
+	}
+
+	return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+}
+
+func withoutPlanet(items []*Suggestion, planetID primitive.ObjectID) []*Suggestion {
+	result := items[:0]
+	for _, item := range items {
+		if item.PlanetID != planetID {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,180 @@
+package autocomplete
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newPlanet(name string, films int, aliases ...string) *repo.Planet {
+	return &repo.Planet{ObjectID: primitive.NewObjectID(), Name: name, Aliases: aliases, FilmsAppearedIn: films}
+}
+
+func suggestedNames(suggestions []Suggestion) []string {
+	names := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		names[i] = suggestion.Name
+	}
+
+	return names
+}
+
+func TestSuggestOrdersByFilms(t *testing.T) {
+	trie := NewTrie([]*repo.Planet{
+		newPlanet("Tatooine", 5),
+		newPlanet("Taris", 0),
+		newPlanet("Takodana", 1),
+		newPlanet("Hoth", 1),
+		newPlanet("Imperial Center", 4),
+	})
+
+	if names := suggestedNames(trie.Suggest("TA", MaxLimit)); !reflect.DeepEqual(names, []string{"Tatooine", "Takodana", "Taris"}) {
+		t.Errorf("Expected the planets ordered by films, but got %v.", names)
+	}
+
+	if names := suggestedNames(trie.Suggest("ta", 2)); !reflect.DeepEqual(names, []string{"Tatooine", "Takodana"}) {
+		t.Errorf("Expected the limit to be respected, but got %v.", names)
+	}
+
+	if names := suggestedNames(trie.Suggest("cen", MaxLimit)); !reflect.DeepEqual(names, []string{"Imperial Center"}) {
+		t.Errorf("Expected a later word of the name to match, but got %v.", names)
+	}
+
+	if suggestions := trie.Suggest("x", MaxLimit); len(suggestions) != 0 {
+		t.Errorf("Expected no suggestions for an unknown prefix, but got %v.", suggestedNames(suggestions))
+	}
+}
+
+func TestRemovePlanetWithSharedPrefixes(t *testing.T) {
+	tatooine := newPlanet("Tatooine", 5, "Tatoo")
+	hoth := newPlanet("Hoth", 1)
+	trie := NewTrie([]*repo.Planet{tatooine, hoth})
+
+	// o nome e o apelido passam pelos mesmos nos, mas o planeta aparece uma vez so
+	suggestions := trie.Suggest("tat", MaxLimit)
+	if len(suggestions) != 1 || suggestions[0].Name != "Tatooine" {
+		t.Errorf("Expected Tatooine once, but got %v.", suggestedNames(suggestions))
+	}
+
+	if suggestions := trie.Suggest("tatoo", MaxLimit); len(suggestions) != 1 {
+		t.Errorf("Expected Tatooine once at the end of the alias, but got %v.", suggestedNames(suggestions))
+	}
+
+	trie.Remove(tatooine.ObjectID)
+
+	if suggestions := trie.Suggest("t", MaxLimit); len(suggestions) != 0 {
+		t.Errorf("Expected no suggestions after the removal, but got %v.", suggestedNames(suggestions))
+	}
+
+	if _, ok := trie.root.children['t']; ok {
+		t.Errorf("Expected the empty nodes to be pruned.")
+	}
+
+	if names := suggestedNames(trie.Suggest("", MaxLimit)); !reflect.DeepEqual(names, []string{"Hoth"}) {
+		t.Errorf("Expected only Hoth at the root, but got %v.", names)
+	}
+
+	if _, ok := trie.byPlanet[tatooine.ObjectID]; ok {
+		t.Errorf("Expected the keys of the removed planet to be forgotten.")
+	}
+}
+
+func TestUpdateRenamesPlanet(t *testing.T) {
+	planet := newPlanet("Hoth", 1)
+	trie := NewTrie([]*repo.Planet{planet, newPlanet("Ilum", 0)})
+
+	renamed := *planet
+	renamed.Name = "Ilum Prime"
+	renamed.FilmsAppearedIn = 2
+	trie.Update(&renamed)
+
+	if suggestions := trie.Suggest("ho", MaxLimit); len(suggestions) != 0 {
+		t.Errorf("Expected the old name to be gone, but got %v.", suggestedNames(suggestions))
+	}
+
+	if _, ok := trie.root.children['h']; ok {
+		t.Errorf("Expected the nodes of the old name to be pruned.")
+	}
+
+	suggestions := trie.Suggest("ilum", MaxLimit)
+	if names := suggestedNames(suggestions); !reflect.DeepEqual(names, []string{"Ilum Prime", "Ilum"}) {
+		t.Errorf("Expected the renamed planet first, but got %v.", names)
+		return
+	}
+
+	if suggestions[0].PlanetID != planet.ObjectID || suggestions[0].FilmsAppearedIn != 2 {
+		t.Errorf("Expected the renamed planet to keep its id and carry the new film count, but got %+v.", suggestions[0])
+	}
+
+	if names := suggestedNames(trie.Suggest("prime", MaxLimit)); !reflect.DeepEqual(names, []string{"Ilum Prime"}) {
+		t.Errorf("Expected the new later word to match, but got %v.", names)
+	}
+}
+
+// os MaxLimit planetas mais populares, na ordem esperada das sugestoes
+func expectedTop(planets []*repo.Planet) []string {
+	items := make([]*Suggestion, len(planets))
+	for i, planet := range planets {
+		items[i] = &Suggestion{Name: planet.Name, FilmsAppearedIn: planet.FilmsAppearedIn}
+	}
+	sort.Slice(items, func(i, j int) bool { return ranksBefore(items[i], items[j]) })
+
+	names := []string{}
+	for i := 0; i < len(items) && i < MaxLimit; i++ {
+		names = append(names, items[i].Name)
+	}
+
+	return names
+}
+
+func TestRemoveBelowFullNode(t *testing.T) {
+	planets := []*repo.Planet{}
+	for i := 0; i < MaxLimit+5; i++ {
+		planets = append(planets, newPlanet(fmt.Sprintf("Kamino %02d", i), i%7))
+	}
+	trie := NewTrie(planets)
+
+	if names := suggestedNames(trie.Suggest("kamino", MaxLimit)); !reflect.DeepEqual(names, expectedTop(planets)) {
+		t.Errorf("Expected %v, but got %v.", expectedTop(planets), names)
+		return
+	}
+
+	// remove um planeta da lista cheia; o primeiro que tinha ficado de fora deve subir
+	removed := trie.Suggest("k", 1)[0]
+	trie.Remove(removed.PlanetID)
+
+	remaining := []*repo.Planet{}
+	for _, planet := range planets {
+		if planet.ObjectID != removed.PlanetID {
+			remaining = append(remaining, planet)
+		}
+	}
+
+	for _, prefix := range []string{"", "k", "kamino"} {
+		if names := suggestedNames(trie.Suggest(prefix, MaxLimit)); !reflect.DeepEqual(names, expectedTop(remaining)) {
+			t.Errorf("Expected %v for '%s' after the removal, but got %v.", expectedTop(remaining), prefix, names)
+		}
+	}
+
+	// abaixo do no cheio, so os planetas do prefixo
+	if names := suggestedNames(trie.Suggest("kamino 2", MaxLimit)); !reflect.DeepEqual(names, expectedTop(planets[20:])) {
+		t.Errorf("Expected %v under 'kamino 2', but got %v.", expectedTop(planets[20:]), names)
+	}
+
+	// um planeta que nao estava na lista cheia sai sem altera-la
+	last := planets[len(planets)-1]
+	for _, planet := range remaining {
+		if ranksBefore(&Suggestion{Name: last.Name, FilmsAppearedIn: last.FilmsAppearedIn}, &Suggestion{Name: planet.Name, FilmsAppearedIn: planet.FilmsAppearedIn}) {
+			last = planet
+		}
+	}
+	trie.Remove(last.ObjectID)
+
+	if names := suggestedNames(trie.Suggest("kamino", MaxLimit)); !reflect.DeepEqual(names, expectedTop(remaining)) {
+		t.Errorf("Expected %v after removing the least popular planet, but got %v.", expectedTop(remaining), names)
+	}
+}
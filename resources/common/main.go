@@ -1,16 +1,24 @@
 package common
 
 const (
-	ECONFLICT     = 409
-	EINTERNAL     = 500
-	EINVALID      = 400
-	EUNAUTHORIZED = 401
-	EFORBIDDEN    = 403
-	ENOTFOUND     = 404
+	ECONFLICT      = 409
+	EINTERNAL      = 500
+	EINVALID       = 400
+	EUNAUTHORIZED  = 401
+	EFORBIDDEN     = 403
+	ENOTFOUND      = 404
+	ENOTACCEPTABLE = 406
+	ETOOLARGE      = 413
+
+	EUNSUPPORTEDMEDIA = 415
+	EFAILEDDEPENDENCY = 424
+	EUNAVAILABLE      = 503
 
 	EMINTERNAL = "An internal error occurred."
 	EMINVALID  = "Found something invalid in the request parameters."
 	EMSEVERAL  = "One or more errors ocurred while processing the request."
+
+	EMNOTPROCESSED = "Not processed because a previous item failed."
 )
 
 type Error struct {
@@ -45,3 +53,43 @@ func CreateFormError(errors map[string]string) *Error {
 func CreateNotFoundError(message string) *Error {
 	return &Error{Code: ENOTFOUND, Message: message}
 }
+
+func CreateUnauthorizedError(message string) *Error {
+	return &Error{Code: EUNAUTHORIZED, Message: message}
+}
+
+func CreateForbiddenError(message string) *Error {
+	return &Error{Code: EFORBIDDEN, Message: message}
+}
+
+func CreateNotAcceptableError(message string) *Error {
+	return &Error{Code: ENOTACCEPTABLE, Message: message}
+}
+
+func CreateRequestTooLargeError(message string) *Error {
+	return &Error{Code: ETOOLARGE, Message: message}
+}
+
+func CreateUnsupportedMediaTypeError(message string) *Error {
+	return &Error{Code: EUNSUPPORTEDMEDIA, Message: message}
+}
+
+func CreateFailedDependencyError(message string) *Error {
+	return &Error{Code: EFAILEDDEPENDENCY, Message: message}
+}
+
+func CreateServiceUnavailableError(message string) *Error {
+	return &Error{Code: EUNAVAILABLE, Message: message}
+}
+
+// em operacoes em lote ordenadas, marca os itens seguintes ao primeiro erro como nao processados
+func SkipAfterFirstError(errs []*Error) {
+	failed := false
+
+	for i, err := range errs {
+		if failed && err == nil {
+			errs[i] = CreateFailedDependencyError(EMNOTPROCESSED)
+		}
+		failed = failed || err != nil
+	}
+}
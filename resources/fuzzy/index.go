@@ -0,0 +1,233 @@
+package fuzzy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/memindex"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// o indice guarda poucos dados por nome e e refeito na propria consulta depois desse tempo,
+// para que as sugestoes incluam os planetas criados por outras instancias
+const maxIndexAge = 5 * time.Minute
+
+// proporcao minima de trigramas em comum para um nome ser comparado pela distancia
+const minSimilarity = 0.2
+
+// planeta sugerido para um termo digitado com erro
+type Suggestion struct {
+	PlanetID primitive.ObjectID `json:"id"`
+	Name     string             `json:"name"`
+	// nome, apelido ou nome localizado mais proximo do termo
+	Matched  string `json:"matched"`
+	Distance int    `json:"distance"`
+}
+
+type entry struct {
+	planetID   primitive.ObjectID
+	planetName string
+	term       string
+	key        string
+	trigrams   []string
+}
+
+// indice de trigramas dos nomes, apelidos e nomes localizados dos planetas
+type Index struct {
+	mu       sync.RWMutex
+	entries  map[int]*entry
+	trigrams map[string]map[int]bool
+	byPlanet map[primitive.ObjectID][]int
+	nextID   int
+}
+
+var indexes = memindex.NewHolder("fuzzy", maxIndexAge, false, func() (memindex.Index, *common.Error) {
+	projection, err := repo.NewPlanetProjection([]string{"name", "aliases", "names"}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	planets, err := repo.GetMatchedPlanets(repo.PlanetFilter{Projection: projection})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIndex(planets), nil
+})
+
+func NewIndex(planets []*repo.Planet) *Index {
+	ix := &Index{
+		entries:  map[int]*entry{},
+		trigrams: map[string]map[int]bool{},
+		byPlanet: map[primitive.ObjectID][]int{},
+	}
+
+	for _, planet := range planets {
+		ix.add(planet)
+	}
+
+	return ix
+}
+
+// indice em memoria, montado na primeira busca aproximada e nao na inicializacao
+func Current() (*Index, *common.Error) {
+	ix, err := indexes.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	return ix.(*Index), nil
+}
+
+// descarta o indice depois de importacoes e limpezas
+func Invalidate() {
+	indexes.Invalidate()
+}
+
+// mantem os trigramas de um planeta criado ou renomeado nesta instancia
+func Update(planet *repo.Planet) {
+	indexes.Update(planet)
+}
+
+func Remove(id primitive.ObjectID) {
+	indexes.Remove(id)
+}
+
+func (ix *Index) Update(planet *repo.Planet) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(planet.ObjectID)
+	ix.add(planet)
+}
+
+func (ix *Index) Remove(id primitive.ObjectID) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+func (ix *Index) add(planet *repo.Planet) {
+	for _, name := range planet.AllNames() {
+		key := utils.NormalizeTerm(name)
+		e := &entry{planetID: planet.ObjectID, planetName: planet.Name, term: name, key: key, trigrams: trigrams(key)}
+
+		id := ix.nextID
+		ix.nextID++
+		ix.entries[id] = e
+		ix.byPlanet[planet.ObjectID] = append(ix.byPlanet[planet.ObjectID], id)
+
+		for _, trigram := range e.trigrams {
+			if ix.trigrams[trigram] == nil {
+				ix.trigrams[trigram] = map[int]bool{}
+			}
+			ix.trigrams[trigram][id] = true
+		}
+	}
+}
+
+func (ix *Index) remove(planetID primitive.ObjectID) {
+	for _, id := range ix.byPlanet[planetID] {
+		for _, trigram := range ix.entries[id].trigrams {
+			delete(ix.trigrams[trigram], id)
+			if len(ix.trigrams[trigram]) == 0 {
+				delete(ix.trigrams, trigram)
+			}
+		}
+		delete(ix.entries, id)
+	}
+	delete(ix.byPlanet, planetID)
+}
+
+// planetas com algum nome a uma distancia de edicao tolerada do termo, dos mais proximos
+// para os mais distantes; cada planeta aparece uma vez, pelo seu nome mais proximo
+func (ix *Index) Search(term string, limit int) []Suggestion {
+	key := utils.NormalizeTerm(term)
+	if key == "" {
+		return []Suggestion{}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	// candidatos pelos trigramas em comum, antes do calculo da distancia
+	queryTrigrams := trigrams(key)
+	shared := map[int]int{}
+	for _, trigram := range queryTrigrams {
+		for id := range ix.trigrams[trigram] {
+			shared[id]++
+		}
+	}
+
+	maxDistance := MaxDistance(key)
+	best := map[primitive.ObjectID]Suggestion{}
+
+	for id, count := range shared {
+		e := ix.entries[id]
+		similarity := float64(2*count) / float64(len(queryTrigrams)+len(e.trigrams))
+		if similarity < minSimilarity {
+			continue
+		}
+
+		distance := utils.Levenshtein(key, e.key)
+		if distance > maxDistance {
+			continue
+		}
+
+		if previous, ok := best[e.planetID]; !ok || distance < previous.Distance {
+			best[e.planetID] = Suggestion{PlanetID: e.planetID, Name: e.planetName, Matched: e.term, Distance: distance}
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(best))
+	for _, suggestion := range best {
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Distance != suggestions[j].Distance {
+			return suggestions[i].Distance < suggestions[j].Distance
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions
+}
+
+// distancia tolerada conforme o tamanho do termo: 1 ate 4 letras, 2 ate 8 e 3 acima disso
+func MaxDistance(key string) int {
+	switch n := len([]rune(key)); {
+	case n <= 4:
+		return 1
+	case n <= 8:
+		return 2
+	}
+
+	return 3
+}
+
+// trigramas do termo com espacos nas bordas, para que o inicio e o fim das palavras pesem mais
+func trigrams(key string) []string {
+	runes := []rune("  " + key + " ")
+	seen := map[string]bool{}
+	result := []string{}
+
+	for i := 0; i+3 <= len(runes); i++ {
+		trigram := string(runes[i : i+3])
+		if !seen[trigram] {
+			seen[trigram] = true
+			result = append(result, trigram)
+		}
+	}
+
+	return result
+}
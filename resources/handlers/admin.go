@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+)
+
+var adminToken string
+
+// permite a execucao do handler apenas com o token de administrador no header Authorization
+func adminOnly(fn appHandler) appHandler {
+	return func(w http.ResponseWriter, r *http.Request) *common.Error {
+		if err := checkAdmin(r); err != nil {
+			return err
+		}
+
+		return fn(w, r)
+	}
+}
+
+func checkAdmin(r *http.Request) *common.Error {
+	return checkAdminAuthorization(r.Header.Get("Authorization"))
+}
+
+// valida o valor do header Authorization; usado tambem pelo gRPC, com o metadado authorization
+func checkAdminAuthorization(header string) *common.Error {
+	if !strings.HasPrefix(header, "Bearer ") {
+		return common.CreateUnauthorizedError("An admin token is required to perform this operation.")
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		return common.CreateForbiddenError("The given admin token is not valid.")
+	}
+
+	return nil
+}
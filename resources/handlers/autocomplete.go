@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/autocomplete"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxPrefixLength     = 100
+)
+
+func suggestPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	errors := map[string]string{}
+	prefix := strings.TrimSpace(r.URL.Query().Get("prefix"))
+	limit := parseIntQuery("limit", r, defaultSuggestLimit, autocomplete.MaxLimit, errors)
+
+	if prefix == "" {
+		errors["prefix"] = "Prefix field is empty or missing."
+	} else if len([]rune(prefix)) > maxPrefixLength {
+		errors["prefix"] = fmt.Sprintf("Prefix must be at most %d characters long.", maxPrefixLength)
+	}
+
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	trie, err := autocomplete.Current()
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message":     "The suggestions were successfully retrieved.",
+			"suggestions": trie.Suggest(prefix, limit),
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+)
+
+const jsonMediaType = "application/json"
+
+// tamanho maximo dos corpos JSON; configuravel por MAX_BODY_SIZE
+var maxBodySize int64 = 1 << 20
+
+// decodifica o corpo da requisicao em v no formato do Content-Type (JSON, XML, YAML ou
+// MessagePack); limita o tamanho, rejeita campos desconhecidos e mais de um valor
+func extractBody(v interface{}, w http.ResponseWriter, r *http.Request) *common.Error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	encoder := encoderForContentType(mediaType)
+	if encoder == nil {
+		return common.CreateUnsupportedMediaTypeError(fmt.Sprintf("The request body must be sent as %s.", strings.Join(supportedMediaTypes(), ", ")))
+	}
+
+	body, err := readBody(w, r, maxBodySize)
+	if err != nil {
+		return err
+	}
+
+	return encoder.Decode(body, v)
+}
+
+// 415 quando o Content-Type nao e um dos tipos aceitos
+func checkContentType(r *http.Request, accepted ...string) *common.Error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	for _, a := range accepted {
+		if mediaType == a {
+			return nil
+		}
+	}
+
+	return common.CreateUnsupportedMediaTypeError(fmt.Sprintf("The request body must be sent as %s.", strings.Join(accepted, " or ")))
+}
+
+// mensagem do erro do http.MaxBytesReader; o tipo http.MaxBytesError so existe a partir do Go 1.19
+const errBodyTooLarge = "http: request body too large"
+
+// 413 quando o corpo passa de limit bytes; outras falhas de leitura, como o cliente desconectar
+// ou um corpo chunked mal formado, sao 400
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, *common.Error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil && err.Error() == errBodyTooLarge {
+		return nil, common.CreateRequestTooLargeError(fmt.Sprintf("The request body must not be larger than %d bytes.", limit))
+	} else if err != nil {
+		return nil, common.CreateBadRequestError("The request body could not be read.")
+	}
+
+	return body, nil
+}
+
+func decodeJSON(data []byte, v interface{}) *common.Error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return jsonDecodeError(err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return common.CreateBadRequestError("The request body must contain a single JSON value.")
+	}
+
+	return nil
+}
+
+// traduz os erros do encoding/json em erros por campo quando possivel
+func jsonDecodeError(err error) *common.Error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return common.CreateBadRequestError("The request body is empty.")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return common.CreateFormError(map[string]string{
+			typeErr.Field: fmt.Sprintf("Expected %s, but got %s.", describeJSONType(typeErr.Type), typeErr.Value),
+		})
+	case errors.As(err, &syntaxErr):
+		return common.CreateBadRequestError(fmt.Sprintf("The request body is not valid JSON (offset %d): %s.", syntaxErr.Offset, syntaxErr.Error()))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// o encoding/json nao tem um tipo para esse erro
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return common.CreateFormError(map[string]string{field: "Unknown field."})
+	}
+
+	return common.CreateGenericBadRequestError(err)
+}
+
+func describeJSONType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	}
+
+	return t.String()
+}
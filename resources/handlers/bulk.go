@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+const (
+	maxBulkItems     = 1000
+	maxBulkBodySize  = 10 << 20
+	maxNDJSONLineLen = 1 << 20
+	bulkConcurrency  = 8
+	ndjsonMediaType  = "application/x-ndjson"
+
+	bulkItemCreated = "created"
+	bulkItemFailed  = "failed"
+	bulkItemSkipped = "skipped"
+)
+
+type BulkItemResult struct {
+	Index  int           `json:"index"`
+	Status int           `json:"status"`
+	Result string        `json:"result"`
+	Planet *repo.Planet  `json:"planet,omitempty"`
+	Error  *common.Error `json:"error,omitempty"`
+}
+
+type BulkSummary struct {
+	Total   int `json:"total"`
+	Created int `json:"created"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// cria varios planetas de uma vez a partir de um array JSON ou de NDJSON (um planeta por linha);
+// ?ordered=true interrompe no primeiro erro
+func bulkCreatePlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	ordered, parseErr := strconv.ParseBool(defaultString(r.URL.Query().Get("ordered"), "false"))
+	if parseErr != nil {
+		return common.CreateFormError(map[string]string{"ordered": "Ordered must be either 'true' or 'false'."})
+	}
+
+	items, err := extractBulkItems(w, r)
+	if err != nil {
+		return err
+	}
+
+	planets := make([]*repo.Planet, len(items))
+	errs := make([]*common.Error, len(items))
+	vocabularies := vocabularies{}
+
+	for i, item := range items {
+		planets[i], errs[i] = buildBulkPlanet(item, vocabularies)
+	}
+
+	if ordered {
+		common.SkipAfterFirstError(errs)
+	}
+
+	enrichBulkPlanets(planets, errs)
+
+	if ordered {
+		common.SkipAfterFirstError(errs)
+	}
+
+	// apenas os planetas validos e enriquecidos seguem para o banco
+	pending := []*repo.Planet{}
+	indexes := []int{}
+	for i, planet := range planets {
+		if errs[i] == nil {
+			pending = append(pending, planet)
+			indexes = append(indexes, i)
+		}
+	}
+
+	var writeConcernErr *common.Error
+	if len(pending) > 0 {
+		var insertErrs []*common.Error
+		insertErrs, writeConcernErr = repo.CreatePlanets(pending, ordered)
+		for j, insertErr := range insertErrs {
+			errs[indexes[j]] = insertErr
+		}
+		planetsReloaded()
+	}
+
+	if ordered {
+		common.SkipAfterFirstError(errs)
+	}
+
+	results, summary := summarizeBulk(planets, errs, r)
+
+	status := http.StatusCreated
+	if summary.Created != summary.Total {
+		status = http.StatusMultiStatus
+	}
+
+	response := map[string]interface{}{
+		"message": fmt.Sprintf("%d of %d planets were successfully created.", summary.Created, summary.Total),
+		"summary": summary,
+		"items":   results,
+	}
+
+	// os itens criados foram gravados; repetir a requisicao criaria duplicatas
+	if writeConcernErr != nil {
+		response["writeConcernError"] = writeConcernErr
+		w.Header().Set("Warning", `299 - "The planets were written, but the write concern was not satisfied."`)
+	}
+
+	respond(response, status, w)
+
+	return nil
+}
+
+func extractBulkItems(w http.ResponseWriter, r *http.Request) ([]json.RawMessage, *common.Error) {
+	if err := checkContentType(r, jsonMediaType, ndjsonMediaType); err != nil {
+		return nil, err
+	}
+
+	body, err := readBody(w, r, maxBulkBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	trimmed := bytes.TrimSpace(body)
+	items := []json.RawMessage{}
+
+	if mediaType != ndjsonMediaType && len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, common.CreateGenericBadRequestError(err)
+		}
+	} else {
+		// cada linha e um item; linhas invalidas viram erros do proprio item
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 64*1024), maxNDJSONLineLen)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				items = append(items, json.RawMessage(append([]byte{}, line...)))
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, common.CreateGenericBadRequestError(err)
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, common.CreateBadRequestError("The request body has no planets.")
+	}
+
+	if len(items) > maxBulkItems {
+		return nil, common.CreateRequestTooLargeError(fmt.Sprintf("A bulk request can have at most %d planets.", maxBulkItems))
+	}
+
+	return items, nil
+}
+
+func buildBulkPlanet(item json.RawMessage, vocabularies vocabularies) (*repo.Planet, *common.Error) {
+	requestBody := PlanetRequestBody{}
+
+	if err := decodeJSON(item, &requestBody); err != nil {
+		return nil, err
+	}
+
+	if err := validatePlanet(&requestBody); err != nil {
+		return nil, err
+	}
+
+	if err := vocabularies.canonicalizePlanet(&requestBody); err != nil {
+		return nil, err
+	}
+
+	planet := repo.Planet{}
+	applyPlanetRequestBody(&planet, &requestBody)
+
+	return &planet, nil
+}
+
+// consulta a SWAPI com no maximo bulkConcurrency requisicoes simultaneas
+func enrichBulkPlanets(planets []*repo.Planet, errs []*common.Error) {
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, bulkConcurrency)
+
+	for i := range planets {
+		if errs[i] != nil {
+			continue
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			filmsAppearedIn, err := getFilmsAppearedIn(planets[i].AllNames())
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			planets[i].FilmsAppearedIn = filmsAppearedIn
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func summarizeBulk(planets []*repo.Planet, errs []*common.Error, r *http.Request) ([]BulkItemResult, BulkSummary) {
+	results := make([]BulkItemResult, len(planets))
+	summary := BulkSummary{Total: len(planets)}
+
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			localizePlanet(planets[i], r)
+			results[i] = BulkItemResult{Index: i, Status: http.StatusCreated, Result: bulkItemCreated, Planet: planets[i]}
+			summary.Created++
+		case err.Code == common.EFAILEDDEPENDENCY:
+			results[i] = BulkItemResult{Index: i, Status: err.Code, Result: bulkItemSkipped, Error: err}
+			summary.Skipped++
+		default:
+			results[i] = BulkItemResult{Index: i, Status: err.Code, Result: bulkItemFailed, Error: err}
+			summary.Failed++
+		}
+	}
+
+	return results, summary
+}
+
+func defaultString(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
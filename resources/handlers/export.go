@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatJSON   = "json"
+
+	// quantidade de planetas escritos entre cada flush da resposta
+	exportFlushEvery = 100
+	// separador de valores multiplos (aliases, tags) dentro de uma celula CSV
+	csvListSeparator = "|"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:    "text/csv; charset=utf-8",
+	ExportFormatNDJSON: ndjsonMediaType,
+	ExportFormatJSON:   "application/json",
+}
+
+var csvColumns = []string{"id", "name", "aliases", "climate", "terrain", "filmsAppearedIn", "systemId", "x", "y", "grid", "tags"}
+var defaultCSVColumns = []string{"id", "name", "climate", "terrain", "filmsAppearedIn"}
+
+type planetExporter interface {
+	begin() error
+	write(planet *repo.Planet) error
+	end() error
+}
+
+// opcoes de uma exportacao; Prepare e Flush sao opcionais
+type ExportOptions struct {
+	Format  string
+	Filter  repo.PlanetFilter
+	Columns []string
+	// chamado antes de cada planeta ser escrito
+	Prepare func(planet *repo.Planet)
+	// chamado a cada exportFlushEvery planetas
+	Flush func()
+}
+
+// exporta os planetas direto do cursor para a resposta; aceita os mesmos filtros da listagem
+func exportPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	format := defaultString(r.URL.Query().Get("format"), ExportFormatJSON)
+	if _, ok := exportContentTypes[format]; !ok {
+		return common.CreateFormError(map[string]string{"format": "Format must be one of csv, ndjson or json."})
+	}
+
+	filter, err := extractPlanetFilter(r)
+	if err != nil {
+		return err
+	}
+	// a exportacao escolhe os campos pelo parametro columns
+	filter.Projection = nil
+
+	columns, err := ParseCSVColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="planets.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+
+	opts := ExportOptions{
+		Format:  format,
+		Filter:  filter,
+		Columns: columns,
+		Prepare: func(planet *repo.Planet) { localizePlanet(planet, r) },
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		opts.Flush = flusher.Flush
+	}
+
+	// o status ja foi enviado, entao um erro no meio da exportacao so pode ser registrado
+	if count, exportErr := ExportPlanets(r.Context(), w, opts); exportErr != nil {
+		log.Printf("planet export interrupted after %d planets: %s", count, exportErr)
+	}
+
+	return nil
+}
+
+// escreve os planetas que passam pelo filtro em w e retorna quantos foram escritos
+func ExportPlanets(ctx context.Context, w io.Writer, opts ExportOptions) (int, error) {
+	var exporter planetExporter
+	switch opts.Format {
+	case ExportFormatCSV:
+		columns := opts.Columns
+		if len(columns) == 0 {
+			columns = defaultCSVColumns
+		}
+		exporter = &csvExporter{writer: csv.NewWriter(w), columns: columns}
+	case ExportFormatNDJSON:
+		exporter = &ndjsonExporter{encoder: json.NewEncoder(w)}
+	case ExportFormatJSON:
+		exporter = &jsonExporter{writer: w, encoder: json.NewEncoder(w)}
+	default:
+		return 0, fmt.Errorf("unknown export format '%s'", opts.Format)
+	}
+
+	if err := exporter.begin(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	streamErr := repo.StreamPlanets(ctx, opts.Filter, func(planet *repo.Planet) error {
+		if opts.Prepare != nil {
+			opts.Prepare(planet)
+		}
+		if err := exporter.write(planet); err != nil {
+			return err
+		}
+
+		if count++; count%exportFlushEvery == 0 {
+			if csvExporter, ok := exporter.(*csvExporter); ok {
+				csvExporter.writer.Flush()
+			}
+			if opts.Flush != nil {
+				opts.Flush()
+			}
+		}
+
+		return nil
+	})
+
+	if streamErr != nil {
+		return count, errors.New(streamErr.Detail)
+	}
+
+	return count, exporter.end()
+}
+
+// colunas do CSV separadas por virgula; vazio usa as colunas padrao
+func ParseCSVColumns(param string) ([]string, *common.Error) {
+	if param == "" {
+		return defaultCSVColumns, nil
+	}
+
+	columns := []string{}
+	for _, column := range strings.Split(param, ",") {
+		column = strings.TrimSpace(column)
+		if !containsString(csvColumns, column) {
+			return nil, common.CreateFormError(map[string]string{
+				"columns": fmt.Sprintf("Unknown column '%s'. Available columns: %s.", column, strings.Join(csvColumns, ", ")),
+			})
+		}
+		columns = appendUnique(columns, column)
+	}
+
+	return columns, nil
+}
+
+type csvExporter struct {
+	writer  *csv.Writer
+	columns []string
+}
+
+func (e *csvExporter) begin() error {
+	return e.writer.Write(e.columns)
+}
+
+func (e *csvExporter) write(planet *repo.Planet) error {
+	record := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		record[i] = planetCSVValue(planet, column)
+	}
+
+	return e.writer.Write(record)
+}
+
+func (e *csvExporter) end() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type ndjsonExporter struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonExporter) begin() error {
+	return nil
+}
+
+func (e *ndjsonExporter) write(planet *repo.Planet) error {
+	return e.encoder.Encode(planet)
+}
+
+func (e *ndjsonExporter) end() error {
+	return nil
+}
+
+type jsonExporter struct {
+	writer  io.Writer
+	encoder *json.Encoder
+	written bool
+}
+
+func (e *jsonExporter) begin() error {
+	_, err := io.WriteString(e.writer, "[")
+	return err
+}
+
+func (e *jsonExporter) write(planet *repo.Planet) error {
+	if e.written {
+		if _, err := io.WriteString(e.writer, ","); err != nil {
+			return err
+		}
+	}
+	e.written = true
+
+	return e.encoder.Encode(planet)
+}
+
+func (e *jsonExporter) end() error {
+	_, err := io.WriteString(e.writer, "]\n")
+	return err
+}
+
+func planetCSVValue(planet *repo.Planet, column string) string {
+	switch column {
+	case "id":
+		return planet.ObjectID.Hex()
+	case "name":
+		return planet.Name
+	case "aliases":
+		return strings.Join(planet.Aliases, csvListSeparator)
+	case "climate":
+		return planet.Climate
+	case "terrain":
+		return planet.Terrain
+	case "filmsAppearedIn":
+		return strconv.Itoa(planet.FilmsAppearedIn)
+	case "systemId":
+		if planet.SystemID != nil {
+			return planet.SystemID.Hex()
+		}
+	case "x":
+		if planet.Location != nil {
+			return strconv.FormatFloat(planet.Location.X, 'f', -1, 64)
+		}
+	case "y":
+		if planet.Location != nil {
+			return strconv.FormatFloat(planet.Location.Y, 'f', -1, 64)
+		}
+	case "grid":
+		return planet.Grid
+	case "tags":
+		return strings.Join(planet.Tags, csvListSeparator)
+	}
+
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
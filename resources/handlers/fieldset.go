@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+// campos pedidos pelo cliente em fields ou exclude, separados por virgula
+func requestedPlanetProjection(r *http.Request) (*repo.PlanetProjection, *common.Error) {
+	query := r.URL.Query()
+	return repo.NewPlanetProjection(splitFieldList(query["fields"]), splitFieldList(query["exclude"]))
+}
+
+// projecao usada na consulta; o include precisa dos nomes e do sistema do planeta
+// mesmo quando eles nao fazem parte da resposta
+func extractPlanetProjection(r *http.Request) (*repo.PlanetProjection, *common.Error) {
+	projection, err := requestedPlanetProjection(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.URL.Query().Get("include") != "" {
+		projection = projection.With("name", "aliases", "names", "systemId")
+	}
+
+	return projection, nil
+}
+
+func splitFieldList(params []string) []string {
+	fields := []string{}
+	for _, param := range params {
+		for _, field := range strings.Split(param, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = appendUnique(fields, field)
+			}
+		}
+	}
+
+	return fields
+}
+
+// o planeta apenas com os campos pedidos; sem projecao o planeta e retornado como esta
+func sparsePlanet(planet *repo.Planet, projection *repo.PlanetProjection) interface{} {
+	if projection == nil {
+		return planet
+	}
+
+	return filterPlanetFields(planet, projection)
+}
+
+func sparsePlanets(planets []*repo.Planet, projection *repo.PlanetProjection) interface{} {
+	if projection == nil {
+		return planets
+	}
+
+	sparse := make([]map[string]interface{}, len(planets))
+	for i, planet := range planets {
+		sparse[i] = filterPlanetFields(planet, projection)
+	}
+
+	return sparse
+}
+
+func filterPlanetFields(planet *repo.Planet, projection *repo.PlanetProjection) map[string]interface{} {
+	generic, _ := toGeneric(planet)
+	fields, _ := generic.(map[string]interface{})
+	for field := range fields {
+		if !projection.Has(field) {
+			delete(fields, field)
+		}
+	}
+
+	return fields
+}
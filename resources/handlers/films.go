@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+// resultado de uma ressincronizacao dos filmes com a SWAPI
+type ResyncSummary struct {
+	Total   int `json:"total"`
+	Updated int `json:"updated"`
+	Errors  int `json:"errors"`
+}
+
+// consulta de novo a quantidade de filmes de todos os planetas e grava as que mudaram;
+// falhas individuais sao contadas e nao interrompem o processo
+func ResyncFilms() (ResyncSummary, *common.Error) {
+	planets, err := repo.GetAllPlanets()
+	if err != nil {
+		return ResyncSummary{}, err
+	}
+
+	previous := make([]int, len(planets))
+	for i, planet := range planets {
+		previous[i] = planet.FilmsAppearedIn
+	}
+
+	errs := make([]*common.Error, len(planets))
+	enrichBulkPlanets(planets, errs)
+
+	summary := ResyncSummary{Total: len(planets)}
+	for i, planet := range planets {
+		if errs[i] == nil && planet.FilmsAppearedIn != previous[i] {
+			errs[i] = repo.SetPlanetFilms(planet.ObjectID, planet.FilmsAppearedIn)
+			if errs[i] == nil {
+				summary.Updated++
+			}
+		}
+
+		if errs[i] != nil {
+			summary.Errors++
+		}
+	}
+
+	return summary, nil
+}
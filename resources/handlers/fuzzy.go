@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"sort"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/fuzzy"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxFuzzyResults = 50
+	maxSuggestions  = 5
+)
+
+// planetas com nomes proximos do termo, usados pela busca com match=fuzzy
+func fuzzyPlanetIDs(term string) ([]primitive.ObjectID, *common.Error) {
+	index, err := fuzzy.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, suggestion := range index.Search(term, maxFuzzyResults) {
+		ids = append(ids, suggestion.PlanetID)
+	}
+
+	return ids, nil
+}
+
+// sugestoes quando a busca nao encontra nada; expressoes regulares nao sao comparadas
+func searchSuggestions(filter repo.PlanetFilter) ([]fuzzy.Suggestion, *common.Error) {
+	if filter.Search == "" || filter.Match == repo.SearchRegex || filter.Match == repo.SearchFuzzy {
+		return nil, nil
+	}
+
+	index, err := fuzzy.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.Search(filter.Search, maxSuggestions), nil
+}
+
+// ordena pelo nome mais proximo do termo
+func sortByFuzzyDistance(planets []*repo.Planet, term string) {
+	key := utils.NormalizeTerm(term)
+	distances := map[primitive.ObjectID]int{}
+
+	for _, planet := range planets {
+		distance := -1
+		for _, name := range planet.AllNames() {
+			if d := utils.Levenshtein(key, utils.NormalizeTerm(name)); distance < 0 || d < distance {
+				distance = d
+			}
+		}
+		distances[planet.ObjectID] = distance
+	}
+
+	sort.SliceStable(planets, func(i, j int) bool {
+		return distances[planets[i].ObjectID] < distances[planets[j].ObjectID]
+	})
+}
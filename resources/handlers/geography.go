@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RegionRequestBody struct {
+	Name *string `json:"name"`
+}
+
+type SectorRequestBody struct {
+	Name     *string `json:"name"`
+	RegionID *string `json:"regionId"`
+}
+
+type SystemRequestBody struct {
+	Name     *string `json:"name"`
+	SectorID *string `json:"sectorId"`
+}
+
+func initializeGeography(r *mux.Router) {
+	sr := r.PathPrefix("/region").Subrouter()
+	sr.Handle("/", appHandler(createRegionHandler)).Methods("POST")
+	sr.Handle("/", appHandler(getRegionsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(getRegionByIDHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/sectors", appHandler(getRegionSectorsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/planets", appHandler(getRegionPlanetsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(deleteRegionHandler)).Methods("DELETE")
+
+	sr = r.PathPrefix("/sector").Subrouter()
+	sr.Handle("/", appHandler(createSectorHandler)).Methods("POST")
+	sr.Handle("/", appHandler(getSectorsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(getSectorByIDHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/systems", appHandler(getSectorSystemsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/planets", appHandler(getSectorPlanetsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(deleteSectorHandler)).Methods("DELETE")
+
+	sr = r.PathPrefix("/system").Subrouter()
+	sr.Handle("/", appHandler(createSystemHandler)).Methods("POST")
+	sr.Handle("/", appHandler(getSystemsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(getSystemByIDHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/planets", appHandler(getSystemPlanetsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(deleteSystemHandler)).Methods("DELETE")
+}
+
+func createRegionHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	requestBody := RegionRequestBody{}
+
+	if err := extractBody(&requestBody, w, r); err != nil {
+		return err
+	}
+
+	if requestBody.Name == nil || *requestBody.Name == "" {
+		return common.CreateFormError(map[string]string{"name": "Name field is empty or missing."})
+	}
+
+	id, err := repo.CreateRegion(&repo.Region{Name: *requestBody.Name})
+	if err != nil {
+		return err
+	}
+
+	region, err := repo.GetRegionByID(id)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The region was successfully created.",
+			"region":  region,
+		},
+		http.StatusCreated,
+		w,
+	)
+
+	return nil
+}
+
+func getRegionsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	regions, err := repo.GetAllRegions()
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The regions were successfully retrieved.",
+			"regions": regions,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getRegionByIDHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	region, err := repo.GetRegionByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The region was successfully retrieved.",
+			"region":  region,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getRegionSectorsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := repo.GetRegionByID(*oid); err != nil {
+		return err
+	}
+
+	sectors, err := repo.GetSectors(oid)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The sectors were successfully retrieved.",
+			"sectors": sectors,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getRegionPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	planets, err := repo.GetPlanetsInRegion(*oid)
+	if err != nil {
+		return err
+	}
+
+	return respondWithPlanets(planets, w, r)
+}
+
+func deleteRegionHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DeleteRegion(*oid); err != nil {
+		return err
+	}
+
+	respondWithMessage("The region was successfully deleted.", http.StatusOK, w)
+
+	return nil
+}
+
+func createSectorHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	requestBody := SectorRequestBody{}
+
+	if err := extractBody(&requestBody, w, r); err != nil {
+		return err
+	}
+
+	errors := map[string]string{}
+	if requestBody.Name == nil || *requestBody.Name == "" {
+		errors["name"] = "Name field is empty or missing."
+	}
+	regionID := validateReference("regionId", requestBody.RegionID, errors)
+
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	id, err := repo.CreateSector(&repo.Sector{Name: *requestBody.Name, RegionID: regionID})
+	if err != nil {
+		return err
+	}
+
+	sector, err := repo.GetSectorByID(id)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The sector was successfully created.",
+			"sector":  sector,
+		},
+		http.StatusCreated,
+		w,
+	)
+
+	return nil
+}
+
+func getSectorsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	sectors, err := repo.GetSectors(nil)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The sectors were successfully retrieved.",
+			"sectors": sectors,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getSectorByIDHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	sector, err := repo.GetSectorByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The sector was successfully retrieved.",
+			"sector":  sector,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getSectorSystemsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := repo.GetSectorByID(*oid); err != nil {
+		return err
+	}
+
+	systems, err := repo.GetSystems(oid)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The systems were successfully retrieved.",
+			"systems": systems,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getSectorPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	planets, err := repo.GetPlanetsInSector(*oid)
+	if err != nil {
+		return err
+	}
+
+	return respondWithPlanets(planets, w, r)
+}
+
+func deleteSectorHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DeleteSector(*oid); err != nil {
+		return err
+	}
+
+	respondWithMessage("The sector was successfully deleted.", http.StatusOK, w)
+
+	return nil
+}
+
+func createSystemHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	requestBody := SystemRequestBody{}
+
+	if err := extractBody(&requestBody, w, r); err != nil {
+		return err
+	}
+
+	errors := map[string]string{}
+	if requestBody.Name == nil || *requestBody.Name == "" {
+		errors["name"] = "Name field is empty or missing."
+	}
+	sectorID := validateReference("sectorId", requestBody.SectorID, errors)
+
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	id, err := repo.CreateSystem(&repo.System{Name: *requestBody.Name, SectorID: sectorID})
+	if err != nil {
+		return err
+	}
+
+	system, err := repo.GetSystemByID(id)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The system was successfully created.",
+			"system":  system,
+		},
+		http.StatusCreated,
+		w,
+	)
+
+	return nil
+}
+
+func getSystemsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	systems, err := repo.GetSystems(nil)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The systems were successfully retrieved.",
+			"systems": systems,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getSystemByIDHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	system, err := repo.GetSystemByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The system was successfully retrieved.",
+			"system":  system,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getSystemPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	planets, err := repo.GetPlanetsInSystem(*oid)
+	if err != nil {
+		return err
+	}
+
+	return respondWithPlanets(planets, w, r)
+}
+
+func deleteSystemHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DeleteSystem(*oid); err != nil {
+		return err
+	}
+
+	respondWithMessage("The system was successfully deleted.", http.StatusOK, w)
+
+	return nil
+}
+
+// valida uma referencia obrigatoria a outro recurso
+func validateReference(field string, value *string, errors map[string]string) primitive.ObjectID {
+	if value == nil || *value == "" {
+		errors[field] = "Reference field is empty or missing."
+		return primitive.NilObjectID
+	}
+
+	oid, err := primitive.ObjectIDFromHex(*value)
+	if err != nil {
+		errors[field] = "Reference is not a valid id."
+	}
+
+	return oid
+}
+
+func respondWithPlanets(planets []*repo.Planet, w http.ResponseWriter, r *http.Request) *common.Error {
+	localizePlanets(planets, r)
+
+	return respondWithPlanetList(planets, "planets", "The planets were successfully retrieved.", w, r)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// a interface do GraphiQL so e servida em desenvolvimento (APP_ENV=development)
+var graphiqlEnabled = false
+
+const graphiqlPage = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>GraphiQL</title>
+	<link rel="stylesheet" href="https://unpkg.com/graphiql@1.4.7/graphiql.min.css">
+</head>
+<body style="margin: 0; height: 100vh;">
+	<div id="graphiql" style="height: 100vh;"></div>
+	<script src="https://unpkg.com/react@17/umd/react.production.min.js"></script>
+	<script src="https://unpkg.com/react-dom@17/umd/react-dom.production.min.js"></script>
+	<script src="https://unpkg.com/graphiql@1.4.7/graphiql.min.js"></script>
+	<script>
+		function fetcher(params) {
+			return fetch("/graphql", {
+				method: "POST",
+				headers: {"Content-Type": "application/json", "Accept": "application/json"},
+				body: JSON.stringify(params)
+			}).then(function (response) { return response.json(); });
+		}
+
+		ReactDOM.render(React.createElement(GraphiQL, {fetcher: fetcher}), document.getElementById("graphiql"));
+	</script>
+</body>
+</html>
+`
+
+func graphiqlHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(graphiqlPage))
+}
@@ -0,0 +1,693 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+const (
+	maxGraphQLFirst = 100
+	maxGraphQLDepth = 10
+)
+
+const graphqlSchemaString = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	planet(id: ID!): Planet
+	planets(filter: PlanetFilter, first: Int = 20, offset: Int = 0): PlanetList!
+}
+
+type Mutation {
+	createPlanet(input: PlanetInput!): Planet!
+	updatePlanet(id: ID!, input: PlanetInput!): Planet!
+	deletePlanet(id: ID!): ID!
+}
+
+type Planet {
+	id: ID!
+	name: String!
+	displayName: String!
+	aliases: [String!]!
+	names: [LocalizedName!]!
+	climate: String!
+	terrain: String!
+	description: String
+	language: String
+	filmsAppearedIn: Int!
+	location: Location
+	grid: String
+	tags: [String!]!
+	metadata: [MetadataEntry!]!
+	system: System
+	films: [Film!]!
+	residents: [Resident!]!
+}
+
+type PlanetList {
+	totalCount: Int!
+	hasNextPage: Boolean!
+	items: [Planet!]!
+}
+
+type LocalizedName {
+	language: String!
+	name: String!
+}
+
+type MetadataEntry {
+	key: String!
+	value: String!
+}
+
+type Location {
+	x: Float!
+	y: Float!
+}
+
+type System {
+	id: ID!
+	name: String!
+	sectorId: ID!
+}
+
+type Film {
+	id: ID!
+	title: String!
+	episodeId: Int!
+	director: String!
+	releaseDate: String!
+}
+
+type Resident {
+	id: ID!
+	name: String!
+	birthYear: String!
+	gender: String!
+}
+
+input PlanetFilter {
+	search: String
+	match: String
+	tags: [String!]
+	allTags: Boolean
+	conditions: [PlanetCondition!]
+}
+
+input PlanetCondition {
+	field: String!
+	operator: String!
+	value: String!
+}
+
+input PlanetInput {
+	name: String
+	aliases: [String!]
+	names: [LocalizedNameInput!]
+	climate: String
+	terrain: String
+	description: String
+	language: String
+	systemId: ID
+	location: LocationInput
+	grid: String
+	tags: [String!]
+	metadata: [MetadataEntryInput!]
+}
+
+input LocalizedNameInput {
+	language: String!
+	name: String!
+}
+
+input MetadataEntryInput {
+	key: String!
+	value: String!
+}
+
+input LocationInput {
+	x: Float
+	y: Float
+}
+`
+
+var graphqlSchema *graphql.Schema
+
+type graphqlContextKey struct{}
+
+// dados de uma requisicao GraphQL disponiveis para os resolvers
+type graphqlRequestContext struct {
+	request *http.Request
+	loaders *planetLoaders
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// erro com o status e os erros por campo das respostas REST em extensions
+type graphqlError struct {
+	err *common.Error
+}
+
+func (e *graphqlError) Error() string {
+	return e.err.Message
+}
+
+func (e *graphqlError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"status": e.err.Code}
+	if e.err.Detail != "" {
+		extensions["detail"] = e.err.Detail
+	}
+	if len(e.err.Errors) > 0 {
+		extensions["errors"] = e.err.Errors
+	}
+
+	return extensions
+}
+
+// evita que um *common.Error nil vire um error diferente de nil
+func toGraphQLError(err *common.Error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &graphqlError{err: err}
+}
+
+func initializeGraphQL(r *mux.Router) {
+	graphqlSchema = graphql.MustParseSchema(graphqlSchemaString, &graphqlResolver{}, graphql.MaxDepth(maxGraphQLDepth))
+
+	r.Handle("/graphql", appHandler(graphqlHandler)).Methods("POST")
+	if graphiqlEnabled {
+		r.HandleFunc("/graphql", graphiqlHandler).Methods("GET")
+	}
+}
+
+func graphqlHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	if err := checkContentType(r, jsonMediaType); err != nil {
+		return err
+	}
+
+	body, err := readBody(w, r, maxBodySize)
+	if err != nil {
+		return err
+	}
+
+	params := graphqlRequest{}
+	if err := decodeJSON(body, &params); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(params.Query) == "" {
+		return common.CreateFormError(map[string]string{"query": "Query field is empty or missing."})
+	}
+
+	ctx := context.WithValue(r.Context(), graphqlContextKey{}, &graphqlRequestContext{request: r, loaders: newPlanetLoaders()})
+	response := graphqlSchema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+
+	// erros de execucao tambem sao respondidos com 200, como manda a especificacao
+	w.Header().Set("Content-Type", jsonMediaType)
+	respond(response, http.StatusOK, w)
+	return nil
+}
+
+func graphqlContext(ctx context.Context) *graphqlRequestContext {
+	return ctx.Value(graphqlContextKey{}).(*graphqlRequestContext)
+}
+
+type graphqlResolver struct{}
+
+func (*graphqlResolver) Planet(ctx context.Context, args struct{ ID graphql.ID }) (*planetResolver, error) {
+	oid, err := stringToObjectID(string(args.ID))
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	planet, err := repo.GetPlanetByID(*oid)
+	if err != nil && err.Code == common.ENOTFOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return newPlanetResolvers(ctx, []*repo.Planet{planet})[0], nil
+}
+
+type planetsArgs struct {
+	Filter *planetFilterInput
+	First  int32
+	Offset int32
+}
+
+type planetFilterInput struct {
+	Search     *string
+	Match      *string
+	Tags       *[]string
+	AllTags    *bool
+	Conditions *[]planetConditionInput
+}
+
+func (*graphqlResolver) Planets(ctx context.Context, args planetsArgs) (*planetListResolver, error) {
+	errors := map[string]string{}
+	if args.First < 1 || args.First > maxGraphQLFirst {
+		errors["first"] = fmt.Sprintf("The first argument must be a number between 1 and %d.", maxGraphQLFirst)
+	}
+	if args.Offset < 0 {
+		errors["offset"] = "The offset argument must not be negative."
+	}
+	if len(errors) > 0 {
+		return nil, toGraphQLError(common.CreateFormError(errors))
+	}
+
+	filter, err := graphqlPlanetFilter(args.Filter, graphqlContext(ctx).request)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	total, err := repo.CountPlanets(filter)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	filter.Skip, filter.Limit = int64(args.Offset), int64(args.First)
+	planets, err := repo.GetMatchedPlanets(filter)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return &planetListResolver{
+		total:   total,
+		hasNext: int64(args.Offset)+int64(len(planets)) < total,
+		items:   newPlanetResolvers(ctx, planets),
+	}, nil
+}
+
+// converte a entrada no filtro da listagem REST, com as mesmas validacoes
+func graphqlPlanetFilter(input *planetFilterInput, r *http.Request) (repo.PlanetFilter, *common.Error) {
+	params := planetFilterParams{}
+	if input == nil {
+		return repo.PlanetFilter{}, nil
+	}
+
+	if input.Search != nil {
+		params.Search = *input.Search
+	}
+	if input.Match != nil {
+		params.Match = *input.Match
+	}
+	if input.Tags != nil {
+		params.Tags = *input.Tags
+	}
+	params.AllTags = input.AllTags != nil && *input.AllTags
+	if input.Conditions != nil {
+		params.Conditions = *input.Conditions
+	}
+
+	return newPlanetFilter(params, r.Header.Get("Authorization"))
+}
+
+type planetInput struct {
+	Name        *string
+	Aliases     *[]string
+	Names       *[]localizedNameInput
+	Climate     *string
+	Terrain     *string
+	Description *string
+	Language    *string
+	SystemID    *graphql.ID
+	Location    *locationInput
+	Grid        *string
+	Tags        *[]string
+	Metadata    *[]metadataEntryInput
+}
+
+type localizedNameInput struct {
+	Language string
+	Name     string
+}
+
+type metadataEntryInput struct {
+	Key   string
+	Value string
+}
+
+type locationInput struct {
+	X *float64
+	Y *float64
+}
+
+// converte a entrada no corpo das rotas REST, para passar pelas mesmas validacoes
+func (input *planetInput) requestBody() *PlanetRequestBody {
+	body := &PlanetRequestBody{
+		Name:        input.Name,
+		Climate:     input.Climate,
+		Terrain:     input.Terrain,
+		Description: input.Description,
+		Language:    input.Language,
+		Grid:        input.Grid,
+	}
+
+	if input.Aliases != nil {
+		body.Aliases = *input.Aliases
+	}
+
+	if input.Names != nil {
+		body.Names = map[string]string{}
+		for _, name := range *input.Names {
+			body.Names[name.Language] = name.Name
+		}
+	}
+
+	if input.SystemID != nil {
+		system := string(*input.SystemID)
+		body.System = &system
+	}
+
+	if input.Location != nil {
+		body.Location = &LocationRequestBody{X: input.Location.X, Y: input.Location.Y}
+	}
+
+	if input.Tags != nil {
+		body.Tags = *input.Tags
+	}
+
+	if input.Metadata != nil {
+		body.Metadata = map[string]string{}
+		for _, entry := range *input.Metadata {
+			body.Metadata[entry.Key] = entry.Value
+		}
+	}
+
+	return body
+}
+
+func (*graphqlResolver) CreatePlanet(ctx context.Context, args struct{ Input planetInput }) (*planetResolver, error) {
+	planet, err := createPlanet(args.Input.requestBody())
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return newPlanetResolvers(ctx, []*repo.Planet{planet})[0], nil
+}
+
+func (*graphqlResolver) UpdatePlanet(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input planetInput
+}) (*planetResolver, error) {
+	oid, err := stringToObjectID(string(args.ID))
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	planet, err := updatePlanet(*oid, args.Input.requestBody())
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return newPlanetResolvers(ctx, []*repo.Planet{planet})[0], nil
+}
+
+func (*graphqlResolver) DeletePlanet(args struct{ ID graphql.ID }) (graphql.ID, error) {
+	oid, err := stringToObjectID(string(args.ID))
+	if err != nil {
+		return "", toGraphQLError(err)
+	}
+
+	if err := deletePlanet(*oid); err != nil {
+		return "", toGraphQLError(err)
+	}
+
+	return args.ID, nil
+}
+
+type planetListResolver struct {
+	total   int64
+	hasNext bool
+	items   []*planetResolver
+}
+
+func (l *planetListResolver) TotalCount() int32 {
+	return int32(l.total)
+}
+
+func (l *planetListResolver) HasNextPage() bool {
+	return l.hasNext
+}
+
+func (l *planetListResolver) Items() []*planetResolver {
+	return l.items
+}
+
+type planetResolver struct {
+	planet  *repo.Planet
+	loaders *planetLoaders
+}
+
+// localiza os planetas e agenda seus relacionamentos para serem carregados juntos
+func newPlanetResolvers(ctx context.Context, planets []*repo.Planet) []*planetResolver {
+	requestContext := graphqlContext(ctx)
+	localizePlanets(planets, requestContext.request)
+	requestContext.loaders.primePlanets(planets)
+
+	resolvers := make([]*planetResolver, len(planets))
+	for i, planet := range planets {
+		resolvers[i] = &planetResolver{planet: planet, loaders: requestContext.loaders}
+	}
+
+	return resolvers
+}
+
+func (p *planetResolver) ID() graphql.ID {
+	return graphql.ID(p.planet.ObjectID.Hex())
+}
+
+func (p *planetResolver) Name() string {
+	return p.planet.Name
+}
+
+func (p *planetResolver) DisplayName() string {
+	return p.planet.DisplayName
+}
+
+func (p *planetResolver) Aliases() []string {
+	return nonNilStrings(p.planet.Aliases)
+}
+
+func (p *planetResolver) Names() []*localizedNameResolver {
+	names := []*localizedNameResolver{}
+	for _, language := range sortedKeys(p.planet.Names) {
+		names = append(names, &localizedNameResolver{language: language, name: p.planet.Names[language]})
+	}
+
+	return names
+}
+
+func (p *planetResolver) Climate() string {
+	return p.planet.Climate
+}
+
+func (p *planetResolver) Terrain() string {
+	return p.planet.Terrain
+}
+
+func (p *planetResolver) Description() *string {
+	return optionalString(p.planet.Description)
+}
+
+func (p *planetResolver) Language() *string {
+	return optionalString(p.planet.Language)
+}
+
+func (p *planetResolver) FilmsAppearedIn() int32 {
+	return int32(p.planet.FilmsAppearedIn)
+}
+
+func (p *planetResolver) Location() *locationResolver {
+	if p.planet.Location == nil {
+		return nil
+	}
+
+	return &locationResolver{location: p.planet.Location}
+}
+
+func (p *planetResolver) Grid() *string {
+	return optionalString(p.planet.Grid)
+}
+
+func (p *planetResolver) Tags() []string {
+	return nonNilStrings(p.planet.Tags)
+}
+
+func (p *planetResolver) Metadata() []*metadataEntryResolver {
+	entries := []*metadataEntryResolver{}
+	for _, key := range sortedKeys(p.planet.Metadata) {
+		entries = append(entries, &metadataEntryResolver{key: key, value: p.planet.Metadata[key]})
+	}
+
+	return entries
+}
+
+func (p *planetResolver) System() (*systemResolver, error) {
+	system, err := p.loaders.system(p.planet)
+	if err != nil || system == nil {
+		return nil, toGraphQLError(err)
+	}
+
+	return &systemResolver{system: system}, nil
+}
+
+func (p *planetResolver) Films() ([]*filmResolver, error) {
+	films, err := p.loaders.planetFilms(p.planet)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	resolvers := make([]*filmResolver, len(films))
+	for i, film := range films {
+		resolvers[i] = &filmResolver{film: film}
+	}
+
+	return resolvers, nil
+}
+
+func (p *planetResolver) Residents() ([]*residentResolver, error) {
+	residents, err := p.loaders.planetResidents(p.planet)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+
+	resolvers := make([]*residentResolver, len(residents))
+	for i, resident := range residents {
+		resolvers[i] = &residentResolver{resident: resident}
+	}
+
+	return resolvers, nil
+}
+
+type localizedNameResolver struct {
+	language string
+	name     string
+}
+
+func (n *localizedNameResolver) Language() string {
+	return n.language
+}
+
+func (n *localizedNameResolver) Name() string {
+	return n.name
+}
+
+type metadataEntryResolver struct {
+	key   string
+	value string
+}
+
+func (e *metadataEntryResolver) Key() string {
+	return e.key
+}
+
+func (e *metadataEntryResolver) Value() string {
+	return e.value
+}
+
+type locationResolver struct {
+	location *repo.Location
+}
+
+func (l *locationResolver) X() float64 {
+	return l.location.X
+}
+
+func (l *locationResolver) Y() float64 {
+	return l.location.Y
+}
+
+type systemResolver struct {
+	system *repo.System
+}
+
+func (s *systemResolver) ID() graphql.ID {
+	return graphql.ID(s.system.ObjectID.Hex())
+}
+
+func (s *systemResolver) Name() string {
+	return s.system.Name
+}
+
+func (s *systemResolver) SectorID() graphql.ID {
+	return graphql.ID(s.system.SectorID.Hex())
+}
+
+type filmResolver struct {
+	film *Film
+}
+
+func (f *filmResolver) ID() graphql.ID {
+	return graphql.ID(f.film.ID)
+}
+
+func (f *filmResolver) Title() string {
+	return f.film.Title
+}
+
+func (f *filmResolver) EpisodeID() int32 {
+	return int32(f.film.EpisodeID)
+}
+
+func (f *filmResolver) Director() string {
+	return f.film.Director
+}
+
+func (f *filmResolver) ReleaseDate() string {
+	return f.film.ReleaseDate
+}
+
+type residentResolver struct {
+	resident *Resident
+}
+
+func (r *residentResolver) ID() graphql.ID {
+	return graphql.ID(r.resident.ID)
+}
+
+func (r *residentResolver) Name() string {
+	return r.resident.Name
+}
+
+func (r *residentResolver) BirthYear() string {
+	return r.resident.BirthYear
+}
+
+func (r *residentResolver) Gender() string {
+	return r.resident.Gender
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/planetpb"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// status gRPC equivalente a cada codigo de common.Error
+var grpcCodes = map[int]codes.Code{
+	common.EINVALID:          codes.InvalidArgument,
+	common.EUNAUTHORIZED:     codes.Unauthenticated,
+	common.EFORBIDDEN:        codes.PermissionDenied,
+	common.ENOTFOUND:         codes.NotFound,
+	common.ECONFLICT:         codes.AlreadyExists,
+	common.ENOTACCEPTABLE:    codes.InvalidArgument,
+	common.ETOOLARGE:         codes.ResourceExhausted,
+	common.EUNSUPPORTEDMEDIA: codes.InvalidArgument,
+	common.EFAILEDDEPENDENCY: codes.Unavailable,
+	common.EINTERNAL:         codes.Internal,
+}
+
+// os nomes dos campos da busca textual nas rotas REST e nas mensagens gRPC
+var grpcSearchFields = map[string]string{"q": "query", "lang": "language"}
+
+// servidor gRPC dos planetas; usa as mesmas funcoes das rotas REST
+type planetServer struct {
+	planetpb.UnimplementedPlanetServiceServer
+}
+
+func NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer()
+	planetpb.RegisterPlanetServiceServer(server, &planetServer{})
+
+	return server
+}
+
+func (s *planetServer) Create(ctx context.Context, req *planetpb.CreatePlanetRequest) (*planetpb.Planet, error) {
+	planet, err := createPlanet(createRequestBody(req))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return planetToProto(ctx, planet), nil
+}
+
+func (s *planetServer) Get(ctx context.Context, req *planetpb.GetPlanetRequest) (*planetpb.Planet, error) {
+	oid, err := stringToObjectID(req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	planet, err := repo.GetPlanetByID(*oid)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return planetToProto(ctx, planet), nil
+}
+
+func (s *planetServer) List(req *planetpb.ListPlanetsRequest, stream planetpb.PlanetService_ListServer) error {
+	params := planetFilterParams{Search: req.Search, Match: req.Match, Tags: req.Tags, AllTags: req.AllTags}
+	for _, c := range req.Conditions {
+		params.Conditions = append(params.Conditions, planetConditionInput{Field: c.Field, Operator: c.Operator, Value: c.Value})
+	}
+
+	ctx := stream.Context()
+	filter, err := newPlanetFilter(params, incomingMetadata(ctx, "authorization"))
+	if err != nil {
+		return grpcError(err)
+	}
+
+	err = repo.StreamPlanets(ctx, filter, func(planet *repo.Planet) error {
+		return stream.Send(planetToProto(ctx, planet))
+	})
+
+	return grpcError(err)
+}
+
+func (s *planetServer) Search(ctx context.Context, req *planetpb.SearchPlanetsRequest) (*planetpb.SearchPlanetsResponse, error) {
+	errors := map[string]string{}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultTextLimit
+	} else if limit < 1 || limit > maxTextLimit {
+		errors["limit"] = fmt.Sprintf("The limit must be a number between 1 and %d.", maxTextLimit)
+	}
+
+	results, err := textSearchPlanets(strings.TrimSpace(req.Query), defaultString(req.Language, "en"), limit, errors)
+	if err != nil {
+		for restField, grpcField := range grpcSearchFields {
+			if message, ok := err.Errors[restField]; ok {
+				delete(err.Errors, restField)
+				err.Errors[grpcField] = message
+			}
+		}
+		return nil, grpcError(err)
+	}
+
+	response := &planetpb.SearchPlanetsResponse{Results: make([]*planetpb.SearchHit, len(results))}
+	for i, result := range results {
+		hit := &planetpb.SearchHit{Planet: planetToProto(ctx, result.Planet), Score: result.Score, Highlights: map[string]*planetpb.Snippets{}}
+		for field, snippets := range result.Highlights {
+			hit.Highlights[field] = &planetpb.Snippets{Snippets: snippets}
+		}
+		response.Results[i] = hit
+	}
+
+	return response, nil
+}
+
+func (s *planetServer) Delete(ctx context.Context, req *planetpb.DeletePlanetRequest) (*planetpb.DeletePlanetResponse, error) {
+	oid, err := stringToObjectID(req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if err := deletePlanet(*oid); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &planetpb.DeletePlanetResponse{}, nil
+}
+
+// converte o pedido no corpo das rotas REST; em proto3 os campos vazios sao tratados como ausentes,
+// exceto os obrigatorios, que chegam vazios a validacao
+func createRequestBody(req *planetpb.CreatePlanetRequest) *PlanetRequestBody {
+	body := &PlanetRequestBody{
+		Name:    &req.Name,
+		Climate: &req.Climate,
+		Terrain: &req.Terrain,
+
+		Description: optionalString(req.Description),
+		Language:    optionalString(req.Language),
+		System:      optionalString(req.SystemId),
+		Grid:        optionalString(req.Grid),
+	}
+
+	if len(req.Aliases) > 0 {
+		body.Aliases = req.Aliases
+	}
+	if len(req.Names) > 0 {
+		body.Names = req.Names
+	}
+	if len(req.Tags) > 0 {
+		body.Tags = req.Tags
+	}
+	if len(req.Metadata) > 0 {
+		body.Metadata = req.Metadata
+	}
+
+	if req.Location != nil {
+		body.Location = &LocationRequestBody{X: &req.Location.X, Y: &req.Location.Y}
+	}
+
+	return body
+}
+
+// o nome de exibicao segue o metadado accept-language, como o header nas rotas REST
+func planetToProto(ctx context.Context, planet *repo.Planet) *planetpb.Planet {
+	localizePlanetTo(planet, incomingMetadata(ctx, "accept-language"))
+
+	message := &planetpb.Planet{
+		Id:              planet.ObjectID.Hex(),
+		Name:            planet.Name,
+		DisplayName:     planet.DisplayName,
+		Aliases:         planet.Aliases,
+		Names:           planet.Names,
+		Climate:         planet.Climate,
+		Terrain:         planet.Terrain,
+		Description:     planet.Description,
+		Language:        planet.Language,
+		FilmsAppearedIn: int32(planet.FilmsAppearedIn),
+		Grid:            planet.Grid,
+		Tags:            planet.Tags,
+		Metadata:        planet.Metadata,
+	}
+
+	if planet.SystemID != nil {
+		message.SystemId = planet.SystemID.Hex()
+	}
+
+	if planet.Location != nil {
+		message.Location = &planetpb.Location{X: planet.Location.X, Y: planet.Location.Y}
+	}
+
+	return message
+}
+
+func incomingMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// status gRPC com os erros por campo em google.rpc.BadRequest e o detalhe em google.rpc.DebugInfo
+func grpcError(err *common.Error) error {
+	if err == nil {
+		return nil
+	}
+
+	code, ok := grpcCodes[err.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	st := status.New(code, err.Message)
+	details := []proto.Message{}
+
+	if len(err.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range sortedKeys(err.Errors) {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: field, Description: err.Errors[field]})
+		}
+		details = append(details, badRequest)
+	}
+
+	if err.Detail != "" {
+		details = append(details, &errdetails.DebugInfo{Detail: err.Detail})
+	}
+
+	if withDetails, detailErr := st.WithDetails(details...); detailErr == nil {
+		st = withDetails
+	}
+
+	return st.Err()
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+func initializeHealth(r *mux.Router) {
+	r.Handle("/readyz", appHandler(readyHandler)).Methods("GET")
+}
+
+// pronto para receber trafego: banco acessivel e nenhuma migracao pendente
+func readyHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	if err := repo.Ping(); err != nil {
+		respond(map[string]interface{}{
+			"message":  "The database is unavailable.",
+			"ready":    false,
+			"database": "unavailable",
+		}, http.StatusServiceUnavailable, w)
+		return nil
+	}
+
+	state, err := repo.GetMigrationState()
+	if err != nil {
+		return err
+	}
+
+	message, status := "The service is ready.", http.StatusOK
+	if state.Pending > 0 {
+		message, status = "There are pending migrations.", http.StatusServiceUnavailable
+	}
+
+	respond(map[string]interface{}{
+		"message":    message,
+		"ready":      status == http.StatusOK,
+		"database":   "ok",
+		"migrations": state,
+	}, status, w)
+
+	return nil
+}
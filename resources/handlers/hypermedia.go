@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+const (
+	jsonAPIMediaType = "application/vnd.api+json"
+	halMediaType     = "application/hal+json"
+
+	includeFilms     = "films"
+	includeResidents = "residents"
+	includeSystem    = "system"
+)
+
+var planetIncludes = []string{includeFilms, includeResidents, includeSystem}
+
+type jsonAPIDocument struct {
+	Data     interface{}            `json:"data"`
+	Included []*jsonAPIResource     `json:"included,omitempty"`
+	Links    map[string]string      `json:"links,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+type jsonAPIResource struct {
+	Type          string                          `json:"type"`
+	ID            string                          `json:"id"`
+	Attributes    map[string]interface{}          `json:"attributes,omitempty"`
+	Relationships map[string]*jsonAPIRelationship `json:"relationships,omitempty"`
+	Links         map[string]string               `json:"links,omitempty"`
+}
+
+type jsonAPIRelationship struct {
+	Links map[string]string `json:"links,omitempty"`
+	// so e preenchido quando o recurso relacionado foi incluido
+	Data interface{} `json:"data,omitempty"`
+}
+
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type jsonAPIError struct {
+	Status string            `json:"status"`
+	Title  string            `json:"title"`
+	Detail string            `json:"detail,omitempty"`
+	Source map[string]string `json:"source,omitempty"`
+}
+
+type halLink struct {
+	Href string `json:"href"`
+}
+
+// recursos relacionados carregados para o include
+type planetRelated struct {
+	films     []*Film
+	residents []*Resident
+	system    *repo.System
+}
+
+func initializeHypermedia(r *mux.Router) {
+	sr := r.PathPrefix("/planet").Subrouter()
+	sr.Handle("/{id:[a-z0-9]+}/films", appHandler(getPlanetFilmsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/residents", appHandler(getPlanetResidentsHandler)).Methods("GET")
+}
+
+func getPlanetFilmsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	planet, err := getPlanetFromParam(r)
+	if err != nil {
+		return err
+	}
+
+	films, err := getPlanetFilms(planet)
+	if err != nil {
+		return err
+	}
+
+	return respondWithRelated(filmResources(films), "films", films, "The films were successfully retrieved.", w, r)
+}
+
+func getPlanetResidentsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	planet, err := getPlanetFromParam(r)
+	if err != nil {
+		return err
+	}
+
+	residents, err := getPlanetResidents(planet)
+	if err != nil {
+		return err
+	}
+
+	return respondWithRelated(residentResources(residents), "residents", residents, "The residents were successfully retrieved.", w, r)
+}
+
+func getPlanetFromParam(r *http.Request) (*repo.Planet, *common.Error) {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetPlanetByID(*oid)
+}
+
+// formato hipermidia negociado pelo Accept, ou "" para as respostas comuns
+func hypermediaFormat(r *http.Request) string {
+	if encoder := negotiateEncoder(r); encoder != nil && (encoder.MediaType == jsonAPIMediaType || encoder.MediaType == halMediaType) {
+		return encoder.MediaType
+	}
+
+	return ""
+}
+
+// responde um planeta como {"message", "planet"}, como documento JSON:API ou como recurso HAL
+func respondWithPlanet(planet *repo.Planet, message string, statusCode int, w http.ResponseWriter, r *http.Request) *common.Error {
+	format := hypermediaFormat(r)
+	projection, _ := requestedPlanetProjection(r)
+	if format == "" {
+		respond(map[string]interface{}{"message": message, "planet": sparsePlanet(planet, projection)}, statusCode, w)
+		return nil
+	}
+
+	related, err := loadPlanetRelated([]*repo.Planet{planet}, r)
+	if err != nil && r.Method == http.MethodGet {
+		return err
+	} else if err != nil {
+		// a escrita ja aconteceu; o planeta e respondido sem os relacionamentos
+		w.Header().Set("Warning", fmt.Sprintf(`299 - "The included relationships could not be loaded: %s"`, err.Message))
+		related = []*planetRelated{{}}
+	}
+
+	if format == jsonAPIMediaType {
+		resource, included := planetResource(planet, projection, related[0])
+		respond(&jsonAPIDocument{
+			Data:     resource,
+			Included: included,
+			Links:    map[string]string{"self": r.URL.RequestURI()},
+			Meta:     map[string]interface{}{"message": message},
+		}, statusCode, w)
+		return nil
+	}
+
+	resource := halPlanet(planet, projection, related[0])
+	resource["message"] = message
+	respond(resource, statusCode, w)
+	return nil
+}
+
+// responde uma lista de planetas; key e a chave usada nas respostas comuns (planets ou results)
+func respondWithPlanetList(planets []*repo.Planet, key string, message string, w http.ResponseWriter, r *http.Request) *common.Error {
+	return respondWithPlanetListExtra(planets, key, message, nil, w, r)
+}
+
+// como respondWithPlanetList, com campos adicionais na resposta (em meta no JSON:API)
+func respondWithPlanetListExtra(planets []*repo.Planet, key string, message string, extra map[string]interface{}, w http.ResponseWriter, r *http.Request) *common.Error {
+	format := hypermediaFormat(r)
+	projection, _ := requestedPlanetProjection(r)
+	if format == "" {
+		res := map[string]interface{}{"message": message, key: sparsePlanets(planets, projection)}
+		for k, v := range extra {
+			res[k] = v
+		}
+		respond(res, http.StatusOK, w)
+		return nil
+	}
+
+	related, err := loadPlanetRelated(planets, r)
+	if err != nil {
+		return err
+	}
+
+	if format == jsonAPIMediaType {
+		data := make([]*jsonAPIResource, len(planets))
+		included := []*jsonAPIResource{}
+		seen := map[string]bool{}
+
+		for i, planet := range planets {
+			resource, planetIncluded := planetResource(planet, projection, related[i])
+			data[i] = resource
+
+			// o mesmo filme ou sistema aparece uma unica vez em included
+			for _, inc := range planetIncluded {
+				if key := inc.Type + "/" + inc.ID; !seen[key] {
+					seen[key] = true
+					included = append(included, inc)
+				}
+			}
+		}
+
+		meta := map[string]interface{}{"message": message, "count": len(planets)}
+		for k, v := range extra {
+			meta[k] = v
+		}
+
+		respond(&jsonAPIDocument{
+			Data:     data,
+			Included: included,
+			Links:    map[string]string{"self": r.URL.RequestURI()},
+			Meta:     meta,
+		}, http.StatusOK, w)
+		return nil
+	}
+
+	embedded := make([]map[string]interface{}, len(planets))
+	for i, planet := range planets {
+		embedded[i] = halPlanet(planet, projection, related[i])
+	}
+
+	res := map[string]interface{}{
+		"message":   message,
+		"count":     len(planets),
+		"_links":    map[string]halLink{"self": {Href: r.URL.RequestURI()}},
+		"_embedded": map[string]interface{}{"planets": embedded},
+	}
+	for k, v := range extra {
+		res[k] = v
+	}
+
+	respond(res, http.StatusOK, w)
+	return nil
+}
+
+// filmes e residentes da rota de relacionamento
+func respondWithRelated(resources []*jsonAPIResource, key string, items interface{}, message string, w http.ResponseWriter, r *http.Request) *common.Error {
+	switch hypermediaFormat(r) {
+	case jsonAPIMediaType:
+		respond(&jsonAPIDocument{
+			Data:  resources,
+			Links: map[string]string{"self": r.URL.RequestURI()},
+			Meta:  map[string]interface{}{"message": message},
+		}, http.StatusOK, w)
+	case halMediaType:
+		respond(map[string]interface{}{
+			"message":   message,
+			"_links":    map[string]halLink{"self": {Href: r.URL.RequestURI()}},
+			"_embedded": map[string]interface{}{key: items},
+		}, http.StatusOK, w)
+	default:
+		respond(map[string]interface{}{"message": message, key: items}, http.StatusOK, w)
+	}
+
+	return nil
+}
+
+// valida include antes de uma escrita, ja que depois dela o erro esconderia o que foi gravado;
+// nas respostas comuns include e ignorado
+func checkIncludes(r *http.Request) *common.Error {
+	if hypermediaFormat(r) == "" {
+		return nil
+	}
+
+	_, err := extractIncludes(r)
+	return err
+}
+
+func extractIncludes(r *http.Request) (map[string]bool, *common.Error) {
+	includes := map[string]bool{}
+	param := r.URL.Query().Get("include")
+	if param == "" {
+		return includes, nil
+	}
+
+	for _, include := range strings.Split(param, ",") {
+		include = strings.TrimSpace(include)
+		if !containsString(planetIncludes, include) {
+			return nil, common.CreateFormError(map[string]string{
+				"include": fmt.Sprintf("Unknown relationship '%s'. Available relationships: %s.", include, strings.Join(planetIncludes, ", ")),
+			})
+		}
+		includes[include] = true
+	}
+
+	return includes, nil
+}
+
+// carrega os relacionamentos pedidos em include; filmes e residentes vem da SWAPI
+func loadPlanetRelated(planets []*repo.Planet, r *http.Request) ([]*planetRelated, *common.Error) {
+	includes, err := extractIncludes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	related := make([]*planetRelated, len(planets))
+	errs := make([]*common.Error, len(planets))
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, swapiConcurrency)
+
+	for i, planet := range planets {
+		related[i] = &planetRelated{}
+		if len(includes) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(planet *repo.Planet, rel *planetRelated, err **common.Error) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			if includes[includeFilms] {
+				if rel.films, *err = getPlanetFilms(planet); *err != nil {
+					return
+				}
+			}
+			if includes[includeResidents] {
+				if rel.residents, *err = getPlanetResidents(planet); *err != nil {
+					return
+				}
+			}
+			if includes[includeSystem] && planet.SystemID != nil {
+				rel.system, *err = repo.GetSystemByID(*planet.SystemID)
+			}
+		}(planet, related[i], &errs[i])
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return related, nil
+}
+
+func planetLinks(planet *repo.Planet) map[string]string {
+	self := "/planet/" + planet.ObjectID.Hex()
+	links := map[string]string{
+		"self":           self,
+		includeFilms:     self + "/films",
+		includeResidents: self + "/residents",
+	}
+
+	if planet.SystemID != nil {
+		links[includeSystem] = "/system/" + planet.SystemID.Hex()
+	}
+
+	return links
+}
+
+// atributos do planeta: os mesmos campos da resposta comum, sem o id e as referencias
+func planetAttributes(planet *repo.Planet, projection *repo.PlanetProjection) map[string]interface{} {
+	attributes := filterPlanetFields(planet, projection)
+	delete(attributes, "id")
+	delete(attributes, "systemId")
+	return attributes
+}
+
+func planetResource(planet *repo.Planet, projection *repo.PlanetProjection, related *planetRelated) (*jsonAPIResource, []*jsonAPIResource) {
+	links := planetLinks(planet)
+	resource := &jsonAPIResource{
+		Type:       "planets",
+		ID:         planet.ObjectID.Hex(),
+		Attributes: planetAttributes(planet, projection),
+		Relationships: map[string]*jsonAPIRelationship{
+			includeFilms:     {Links: map[string]string{"related": links[includeFilms]}},
+			includeResidents: {Links: map[string]string{"related": links[includeResidents]}},
+		},
+		Links: map[string]string{"self": links["self"]},
+	}
+	included := []*jsonAPIResource{}
+
+	if planet.SystemID != nil {
+		resource.Relationships[includeSystem] = &jsonAPIRelationship{
+			Links: map[string]string{"related": links[includeSystem]},
+			Data:  jsonAPIIdentifier{Type: "systems", ID: planet.SystemID.Hex()},
+		}
+	}
+
+	if related.films != nil {
+		films := filmResources(related.films)
+		resource.Relationships[includeFilms].Data = identifiers(films)
+		included = append(included, films...)
+	}
+
+	if related.residents != nil {
+		residents := residentResources(related.residents)
+		resource.Relationships[includeResidents].Data = identifiers(residents)
+		included = append(included, residents...)
+	}
+
+	if related.system != nil {
+		included = append(included, &jsonAPIResource{
+			Type:       "systems",
+			ID:         related.system.ObjectID.Hex(),
+			Attributes: map[string]interface{}{"name": related.system.Name, "sectorId": related.system.SectorID.Hex()},
+			Links:      map[string]string{"self": links[includeSystem]},
+		})
+	}
+
+	return resource, included
+}
+
+func filmResources(films []*Film) []*jsonAPIResource {
+	resources := make([]*jsonAPIResource, len(films))
+	for i, film := range films {
+		resources[i] = &jsonAPIResource{
+			Type: "films",
+			ID:   film.ID,
+			Attributes: map[string]interface{}{
+				"title":       film.Title,
+				"episodeId":   film.EpisodeID,
+				"director":    film.Director,
+				"releaseDate": film.ReleaseDate,
+			},
+		}
+	}
+
+	return resources
+}
+
+func residentResources(residents []*Resident) []*jsonAPIResource {
+	resources := make([]*jsonAPIResource, len(residents))
+	for i, resident := range residents {
+		resources[i] = &jsonAPIResource{
+			Type: "people",
+			ID:   resident.ID,
+			Attributes: map[string]interface{}{
+				"name":      resident.Name,
+				"birthYear": resident.BirthYear,
+				"gender":    resident.Gender,
+			},
+		}
+	}
+
+	return resources
+}
+
+func identifiers(resources []*jsonAPIResource) []jsonAPIIdentifier {
+	ids := make([]jsonAPIIdentifier, len(resources))
+	for i, resource := range resources {
+		ids[i] = jsonAPIIdentifier{Type: resource.Type, ID: resource.ID}
+	}
+
+	return ids
+}
+
+// o planeta com os campos comuns mais _links e, quando incluidos, _embedded
+func halPlanet(planet *repo.Planet, projection *repo.PlanetProjection, related *planetRelated) map[string]interface{} {
+	resource := filterPlanetFields(planet, projection)
+
+	links := map[string]halLink{}
+	for rel, href := range planetLinks(planet) {
+		links[rel] = halLink{Href: href}
+	}
+	resource["_links"] = links
+
+	embedded := map[string]interface{}{}
+	if related.films != nil {
+		embedded[includeFilms] = related.films
+	}
+	if related.residents != nil {
+		embedded[includeResidents] = related.residents
+	}
+	if related.system != nil {
+		embedded[includeSystem] = related.system
+	}
+	if len(embedded) > 0 {
+		resource["_embedded"] = embedded
+	}
+
+	return resource
+}
+
+// documentos JSON:API prontos sao escritos como estao; erros viram o objeto errors
+// e as demais respostas ficam em meta
+func encodeJSONAPI(w io.Writer, data interface{}) error {
+	switch v := data.(type) {
+	case *jsonAPIDocument:
+		return encodeJSON(w, v)
+	case common.Error:
+		return encodeJSON(w, map[string]interface{}{"errors": jsonAPIErrors(v)})
+	}
+
+	return encodeJSON(w, map[string]interface{}{"meta": data})
+}
+
+func jsonAPIErrors(err common.Error) []jsonAPIError {
+	status := strconv.Itoa(err.Code)
+	if len(err.Errors) == 0 {
+		return []jsonAPIError{{Status: status, Title: err.Message, Detail: err.Detail}}
+	}
+
+	errs := []jsonAPIError{}
+	for _, field := range sortedKeys(err.Errors) {
+		errs = append(errs, jsonAPIError{
+			Status: status,
+			Title:  err.Message,
+			Detail: err.Errors[field],
+			Source: map[string]string{"pointer": "/data/attributes/" + strings.Replace(field, ".", "/", -1)},
+		})
+	}
+
+	return errs
+}
+
+// {"data": {"type", "attributes", "relationships"}}; o sistema pode vir como relacionamento
+func decodeJSONAPI(body []byte, v interface{}) *common.Error {
+	document := struct {
+		Data *struct {
+			Type          string                 `json:"type"`
+			ID            string                 `json:"id"`
+			Attributes    map[string]interface{} `json:"attributes"`
+			Relationships map[string]struct {
+				Data *jsonAPIIdentifier `json:"data"`
+			} `json:"relationships"`
+		} `json:"data"`
+	}{}
+
+	if err := decodeJSON(body, &document); err != nil {
+		return err
+	}
+
+	if document.Data == nil || document.Data.Type == "" {
+		return common.CreateBadRequestError("The request body must be a JSON:API document with a typed resource in data.")
+	}
+
+	// o JSON:API pede 409 quando o tipo nao corresponde a colecao do endpoint
+	if document.Data.Type != "planets" {
+		return common.CreateConflictError(fmt.Sprintf("The resource type '%s' does not match the planets collection.", document.Data.Type))
+	}
+
+	attributes := document.Data.Attributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+
+	for name, relationship := range document.Data.Relationships {
+		if name != includeSystem {
+			return common.CreateFormError(map[string]string{name: "Unknown relationship."})
+		}
+		if relationship.Data != nil {
+			attributes["systemId"] = relationship.Data.ID
+		}
+	}
+
+	return decodeGeneric(attributes, v)
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+)
+
+const (
+	maxImageSize   = 5 << 20
+	maxImagePixels = 40000000
+	thumbSize      = 256
+	imageMaxAge    = 86400
+)
+
+var allowedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// aceita multipart/form-data (campo "image") ou o arquivo direto no corpo
+func putPlanetImageHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	data, declaredType, err := readImageUpload(w, r)
+	if err != nil {
+		return err
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedImageTypes[contentType] || (declaredType != "" && declaredType != contentType) {
+		return common.CreateUnsupportedMediaTypeError("The image must be a PNG, JPEG or GIF file matching its declared content type.")
+	}
+
+	config, _, decodeErr := image.DecodeConfig(bytes.NewReader(data))
+	if decodeErr != nil {
+		return common.CreateGenericBadRequestError(decodeErr)
+	}
+
+	if config.Width*config.Height > maxImagePixels {
+		return common.CreateRequestTooLargeError("The image dimensions are too large.")
+	}
+
+	img, _, decodeErr := image.Decode(bytes.NewReader(data))
+	if decodeErr != nil {
+		return common.CreateGenericBadRequestError(decodeErr)
+	}
+
+	thumb, err := encodeThumbnail(img, contentType)
+	if err != nil {
+		return err
+	}
+
+	checksum := sha256.Sum256(data)
+	planetImage := repo.PlanetImage{
+		ContentType:      contentType,
+		ThumbContentType: thumb.ContentType,
+		Width:            config.Width,
+		Height:           config.Height,
+		Size:             int64(len(data)),
+		Checksum:         hex.EncodeToString(checksum[:]),
+		UpdatedAt:        time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := repo.SavePlanetImage(*oid, &planetImage, repo.ImageFile{Data: data, ContentType: contentType}, *thumb); err != nil {
+		return err
+	}
+
+	planet, err := repo.GetPlanetByID(*oid)
+	if err != nil {
+		return err
+	}
+	localizePlanet(planet, r)
+
+	respond(
+		map[string]interface{}{
+			"message": "The image was successfully uploaded.",
+			"planet":  planet,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getPlanetImageHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = repo.ImageOriginal
+	} else if size != repo.ImageOriginal && size != repo.ImageThumb {
+		return common.CreateFormError(map[string]string{"size": "Size must be either 'original' or 'thumb'."})
+	}
+
+	planet, err := repo.GetPlanetByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	if planet.Image == nil {
+		return common.CreateNotFoundError(fmt.Sprintf("Image not found for given planet id (%s).", oid.Hex()))
+	}
+
+	contentType, etag := planet.Image.ContentType, `"`+planet.Image.Checksum+`"`
+	if size == repo.ImageThumb {
+		contentType, etag = planet.Image.ThumbContentType, `"`+planet.Image.Checksum+`-thumb"`
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", imageMaxAge))
+	w.Header().Set("Last-Modified", planet.Image.UpdatedAt.Format(http.TimeFormat))
+
+	if imageNotModified(r, etag, planet.Image.UpdatedAt) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	stream, err := repo.OpenPlanetImage(*oid, planet.Image, size)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, stream)
+
+	return nil
+}
+
+func deletePlanetImageHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DeletePlanetImage(*oid); err != nil {
+		return err
+	}
+
+	respondWithMessage("The image was successfully deleted.", http.StatusOK, w)
+
+	return nil
+}
+
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, string, *common.Error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize+1<<20)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var source io.Reader = r.Body
+	declaredType := mediaType
+
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxImageSize); err != nil {
+			return nil, "", imageReadError(err)
+		}
+
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			return nil, "", common.CreateFormError(map[string]string{"image": "Image field is empty or missing."})
+		}
+		defer file.Close()
+
+		source = file
+		declaredType, _, _ = mime.ParseMediaType(header.Header.Get("Content-Type"))
+		if declaredType == "application/octet-stream" {
+			declaredType = ""
+		}
+	} else if !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", common.CreateUnsupportedMediaTypeError("The request must be multipart/form-data or an image content type.")
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(source, maxImageSize+1))
+	if err != nil {
+		return nil, "", imageReadError(err)
+	}
+
+	if len(data) > maxImageSize {
+		return nil, "", common.CreateRequestTooLargeError(fmt.Sprintf("The image must not be larger than %d bytes.", maxImageSize))
+	}
+
+	if len(data) == 0 {
+		return nil, "", common.CreateBadRequestError("The image is empty.")
+	}
+
+	return data, declaredType, nil
+}
+
+func imageReadError(err error) *common.Error {
+	if strings.Contains(err.Error(), "request body too large") {
+		return common.CreateRequestTooLargeError(fmt.Sprintf("The image must not be larger than %d bytes.", maxImageSize))
+	}
+
+	return common.CreateGenericBadRequestError(err)
+}
+
+// miniaturas de JPEG continuam JPEG; as demais viram PNG para manter a transparencia
+func encodeThumbnail(img image.Image, contentType string) (*repo.ImageFile, *common.Error) {
+	thumb := utils.Thumbnail(img, thumbSize)
+	buffer := bytes.Buffer{}
+
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buffer, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&buffer, thumb)
+	}
+
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return &repo.ImageFile{Data: buffer.Bytes(), ContentType: contentType}, nil
+}
+
+func imageNotModified(r *http.Request, etag string, updatedAt time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			if candidate = strings.TrimSpace(candidate); candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !updatedAt.After(since)
+	}
+
+	return false
+}
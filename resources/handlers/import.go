@@ -0,0 +1,672 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/hyperspace"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxImportBodySize = 20 << 20
+	maxImportRows     = 50000
+	// acima deste numero de linhas a importacao roda em segundo plano
+	asyncImportRows = 200
+
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+	ImportFormatJSON   = "json"
+
+	importActionInsert = "insert"
+	importActionUpdate = "update"
+	importActionSkip   = "skip"
+	importActionError  = "error"
+)
+
+var importColumns = []string{"id", "name", "aliases", "climate", "terrain", "systemId", "x", "y", "grid", "tags"}
+
+type ImportRowRequestBody struct {
+	ID *string `json:"id"`
+	PlanetRequestBody
+}
+
+type importRow struct {
+	line int
+	body ImportRowRequestBody
+	err  *common.Error
+
+	action  string
+	planet  *repo.Planet
+	refetch bool // os nomes mudaram e os filmes precisam ser consultados de novo
+}
+
+type ImportRowReport struct {
+	Row    int           `json:"row"`
+	Action string        `json:"action"`
+	ID     string        `json:"id,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Error  *common.Error `json:"error,omitempty"`
+}
+
+// resultado de uma importacao; Job e nulo no modo dry run
+type ImportResult struct {
+	DryRun  bool               `json:"dryRun"`
+	Async   bool               `json:"-"`
+	Job     *repo.ImportJob    `json:"job,omitempty"`
+	Summary repo.ImportSummary `json:"summary"`
+	Rows    []ImportRowReport  `json:"rows,omitempty"`
+}
+
+// importa planetas de CSV (colunas pelo cabecalho) ou NDJSON; linhas com id ou com o nome de
+// um planeta existente atualizam o planeta. Com ?dryRun=true nada e gravado
+func importPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	dryRun, parseErr := strconv.ParseBool(defaultString(r.URL.Query().Get("dryRun"), "false"))
+	if parseErr != nil {
+		return common.CreateFormError(map[string]string{"dryRun": "Dry run must be either 'true' or 'false'."})
+	}
+
+	format := ""
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "text/csv":
+		format = ImportFormatCSV
+	case ndjsonMediaType:
+		format = ImportFormatNDJSON
+	default:
+		return common.CreateUnsupportedMediaTypeError("The import must be sent as text/csv or " + ndjsonMediaType + ".")
+	}
+
+	body, err := readBody(w, r, maxImportBodySize)
+	if err != nil {
+		return err
+	}
+
+	result, err := ImportPlanets(format, body, dryRun, true)
+	if err != nil {
+		return err
+	}
+
+	message, status := "The import was successfully processed.", http.StatusOK
+	if result.DryRun {
+		message = "The import was successfully validated. Nothing was written."
+	} else if result.Async {
+		message, status = "The import was accepted and is being processed.", http.StatusAccepted
+	}
+
+	response := map[string]interface{}{
+		"message": message,
+		"dryRun":  result.DryRun,
+	}
+
+	if result.Job != nil {
+		response["job"] = result.Job
+		response["links"] = importJobLinks(result.Job.ObjectID)
+	}
+
+	if !result.Async {
+		response["summary"] = result.Summary
+		response["rows"] = result.Rows
+	}
+
+	respond(response, status, w)
+
+	return nil
+}
+
+// importa os planetas do conteudo informado; com allowAsync, arquivos grandes
+// sao processados em segundo plano e o resultado fica disponivel no job
+func ImportPlanets(format string, body []byte, dryRun bool, allowAsync bool) (*ImportResult, *common.Error) {
+	rows, err := parseImportRows(format, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := planImport(rows); err != nil {
+		return nil, err
+	}
+
+	result := ImportResult{DryRun: dryRun}
+	if dryRun {
+		result.Summary, result.Rows = reportImport(rows)
+		return &result, nil
+	}
+
+	job := repo.ImportJob{Status: repo.ImportJobPending, Format: format}
+	if _, err := repo.CreateImportJob(&job); err != nil {
+		return nil, err
+	}
+	result.Job = &job
+
+	if allowAsync && len(rows) > asyncImportRows {
+		result.Async = true
+		task := importTask{job: &repo.ImportJob{ObjectID: job.ObjectID, Format: format, CreatedAt: job.CreatedAt}, rows: rows}
+		if err := enqueueImport(task); err != nil {
+			failImport(task.job, err.Message)
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	runImport(&job, rows)
+	result.Summary, result.Rows = reportImport(rows)
+
+	return &result, nil
+}
+
+func getImportJobHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("jobId", r)
+	if err != nil {
+		return err
+	}
+
+	job, err := repo.GetImportJobByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The import job was successfully retrieved.",
+			"job":     job,
+			"links":   importJobLinks(*oid),
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+// linhas com erro da importacao em CSV, para correcao na planilha
+func getImportJobErrorsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("jobId", r)
+	if err != nil {
+		return err
+	}
+
+	job, err := repo.GetImportJobByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	rowErrors, err := repo.GetImportRowErrors(job)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[ExportFormatCSV])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-errors.csv"`, oid.Hex()))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"row", "name", "field", "message"})
+	for _, rowErr := range rowErrors {
+		if len(rowErr.Error.Errors) == 0 {
+			writer.Write([]string{strconv.Itoa(rowErr.Row), rowErr.Name, "", errorMessage(rowErr.Error)})
+			continue
+		}
+
+		for _, field := range sortedKeys(rowErr.Error.Errors) {
+			writer.Write([]string{strconv.Itoa(rowErr.Row), rowErr.Name, field, rowErr.Error.Errors[field]})
+		}
+	}
+	writer.Flush()
+
+	return nil
+}
+
+func importJobLinks(id primitive.ObjectID) map[string]string {
+	return map[string]string{
+		"self":   "/planet/import/" + id.Hex(),
+		"errors": "/planet/import/" + id.Hex() + "/errors.csv",
+	}
+}
+
+func parseImportRows(format string, body []byte) ([]*importRow, *common.Error) {
+	var rows []*importRow
+	var err *common.Error
+
+	switch format {
+	case ImportFormatCSV:
+		rows, err = parseCSVImport(body)
+	case ImportFormatNDJSON:
+		rows, err = parseNDJSONImport(body)
+	case ImportFormatJSON:
+		rows, err = parseJSONImport(body)
+	default:
+		return nil, common.CreateBadRequestError(fmt.Sprintf("Unknown import format '%s'.", format))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, common.CreateBadRequestError("The import has no rows.")
+	}
+
+	if len(rows) > maxImportRows {
+		return nil, common.CreateRequestTooLargeError(fmt.Sprintf("An import can have at most %d rows.", maxImportRows))
+	}
+
+	return rows, nil
+}
+
+func parseCSVImport(body []byte) ([]*importRow, *common.Error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+
+	header, readErr := reader.Read()
+	if readErr != nil {
+		return nil, common.CreateGenericBadRequestError(readErr)
+	}
+
+	for i, column := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+		if !containsString(importColumns, header[i]) {
+			return nil, common.CreateFormError(map[string]string{
+				"header": fmt.Sprintf("Unknown column '%s'. Available columns: %s.", header[i], strings.Join(importColumns, ", ")),
+			})
+		}
+	}
+
+	rows := []*importRow{}
+	// numeracao das linhas como na planilha, com o cabecalho na linha 1
+	for line := 2; ; line++ {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			break
+		}
+
+		row := importRow{line: line}
+		if readErr != nil {
+			row.err = common.CreateGenericBadRequestError(readErr)
+		} else {
+			row.body, row.err = csvRecordToBody(header, record)
+		}
+
+		rows = append(rows, &row)
+	}
+
+	return rows, nil
+}
+
+// celulas vazias sao tratadas como campos nao informados
+func csvRecordToBody(header []string, record []string) (ImportRowRequestBody, *common.Error) {
+	body := ImportRowRequestBody{}
+	errors := map[string]string{}
+	location := LocationRequestBody{}
+
+	for i, value := range record {
+		if i >= len(header) {
+			break
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		switch header[i] {
+		case "id":
+			body.ID = &value
+		case "name":
+			body.Name = &value
+		case "aliases":
+			body.Aliases = utils.SplitList(value, csvListSeparator)
+		case "climate":
+			body.Climate = &value
+		case "terrain":
+			body.Terrain = &value
+		case "systemId":
+			body.System = &value
+		case "grid":
+			body.Grid = &value
+		case "tags":
+			body.Tags = utils.SplitList(value, csvListSeparator)
+		case "x", "y":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errors[header[i]] = fmt.Sprintf("The %s column must be a number.", header[i])
+			} else if header[i] == "x" {
+				location.X = &number
+			} else {
+				location.Y = &number
+			}
+		}
+	}
+
+	if location.X != nil || location.Y != nil {
+		body.Location = &location
+	}
+
+	if len(errors) > 0 {
+		return body, common.CreateFormError(errors)
+	}
+
+	return body, nil
+}
+
+func parseNDJSONImport(body []byte) ([]*importRow, *common.Error) {
+	rows := []*importRow{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLineLen)
+
+	for line := 1; scanner.Scan(); line++ {
+		content := bytes.TrimSpace(scanner.Bytes())
+		if len(content) == 0 {
+			continue
+		}
+
+		row := importRow{line: line}
+		row.err = decodeJSON(content, &row.body)
+
+		rows = append(rows, &row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, common.CreateGenericBadRequestError(err)
+	}
+
+	return rows, nil
+}
+
+// array JSON, usado pelas fixtures; cada item e uma linha
+func parseJSONImport(body []byte) ([]*importRow, *common.Error) {
+	items := []json.RawMessage{}
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, common.CreateGenericBadRequestError(err)
+	}
+
+	rows := make([]*importRow, 0, len(items))
+	for i, item := range items {
+		row := importRow{line: i + 1}
+		row.err = decodeJSON(item, &row.body)
+
+		rows = append(rows, &row)
+	}
+
+	return rows, nil
+}
+
+// decide a acao de cada linha sem gravar nada
+func planImport(rows []*importRow) *common.Error {
+	existingByID, existingByName, err := loadImportTargets(rows)
+	if err != nil {
+		return err
+	}
+
+	vocabularies := vocabularies{}
+	seenNames := map[string]int{}
+
+	for _, row := range rows {
+		if row.err != nil {
+			row.action = importActionError
+			continue
+		}
+
+		var existing *repo.Planet
+		if row.body.ID != nil {
+			oid, _ := primitive.ObjectIDFromHex(*row.body.ID)
+			if existing = existingByID[oid]; existing == nil {
+				row.err = common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", *row.body.ID))
+			}
+		} else if row.body.Name != nil {
+			existing = existingByName[utils.NormalizeTerm(*row.body.Name)]
+		}
+
+		if row.err == nil && row.body.Name != nil {
+			name := utils.NormalizeTerm(*row.body.Name)
+			if first, ok := seenNames[name]; ok {
+				row.err = common.CreateFormError(map[string]string{"name": fmt.Sprintf("Duplicate name in the import (first seen on row %d).", first)})
+			} else {
+				seenNames[name] = row.line
+			}
+		}
+
+		if row.err == nil {
+			row.err = planImportRow(row, existing, vocabularies)
+		}
+
+		if row.err != nil {
+			row.action = importActionError
+		}
+	}
+
+	return nil
+}
+
+func planImportRow(row *importRow, existing *repo.Planet, vocabularies vocabularies) *common.Error {
+	body := &row.body.PlanetRequestBody
+
+	if existing == nil {
+		if err := validatePlanet(body); err != nil {
+			return err
+		}
+	} else if err := validatePlanetPatch(body); err != nil {
+		return err
+	}
+
+	if err := vocabularies.canonicalizePlanet(body); err != nil {
+		return err
+	}
+
+	if existing == nil {
+		row.action = importActionInsert
+		row.planet = &repo.Planet{}
+		applyPlanetRequestBody(row.planet, body)
+		row.refetch = true
+		return nil
+	}
+
+	updated := *existing
+	applyPlanetRequestBody(&updated, body)
+	row.planet = &updated
+	row.refetch = !reflect.DeepEqual(existing.AllNames(), updated.AllNames())
+
+	if reflect.DeepEqual(*existing, updated) {
+		row.action = importActionSkip
+	} else {
+		row.action = importActionUpdate
+	}
+
+	return nil
+}
+
+// busca de uma vez os planetas referenciados por id ou por nome
+func loadImportTargets(rows []*importRow) (map[primitive.ObjectID]*repo.Planet, map[string]*repo.Planet, *common.Error) {
+	ids := []primitive.ObjectID{}
+	names := []string{}
+
+	for _, row := range rows {
+		if row.err != nil {
+			continue
+		}
+
+		if row.body.ID != nil {
+			oid, err := primitive.ObjectIDFromHex(*row.body.ID)
+			if err != nil {
+				row.err = common.CreateFormError(map[string]string{"id": "Planet id is not valid."})
+				continue
+			}
+			ids = append(ids, oid)
+		} else if row.body.Name != nil {
+			names = append(names, *row.body.Name)
+		}
+	}
+
+	byID := map[primitive.ObjectID]*repo.Planet{}
+	if len(ids) > 0 {
+		planets, err := repo.GetPlanetsByIDs(ids)
+		if err != nil {
+			return nil, nil, err
+		}
+		byID = planets
+	}
+
+	byName := map[string]*repo.Planet{}
+	if len(names) > 0 {
+		planets, err := repo.GetPlanetsByNames(names)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, planet := range planets {
+			byName[utils.NormalizeTerm(planet.Name)] = planet
+		}
+	}
+
+	return byID, byName, nil
+}
+
+// campos gravados na atualizacao da linha; os filmes so sao gravados quando foram consultados de novo
+func (row *importRow) fields() []string {
+	fields := row.body.fields()
+	if row.refetch {
+		fields = append(fields, "filmsAppearedIn")
+	}
+
+	return fields
+}
+
+// grava as linhas planejadas e registra o resultado no job
+func runImport(job *repo.ImportJob, rows []*importRow) {
+	job.Status = repo.ImportJobRunning
+	if err := repo.UpdateImportJob(job); err != nil {
+		failImport(job, "The import could not be started: "+errorMessage(err))
+		return
+	}
+
+	planets := []*repo.Planet{}
+	errs := []*common.Error{}
+	for _, row := range rows {
+		if row.action == importActionInsert || (row.action == importActionUpdate && row.refetch) {
+			planets = append(planets, row.planet)
+			errs = append(errs, nil)
+		}
+	}
+	enrichBulkPlanets(planets, errs)
+
+	enrichErrs := map[*repo.Planet]*common.Error{}
+	for i, planet := range planets {
+		if errs[i] != nil {
+			enrichErrs[planet] = errs[i]
+		}
+	}
+
+	inserts := []*importRow{}
+	for _, row := range rows {
+		if row.action != importActionInsert && row.action != importActionUpdate {
+			continue
+		}
+
+		if err := enrichErrs[row.planet]; err != nil {
+			row.err, row.action = err, importActionError
+			continue
+		}
+
+		if row.action == importActionInsert {
+			inserts = append(inserts, row)
+		} else if err := repo.UpdatePlanet(row.planet, row.fields()); err != nil {
+			row.err, row.action = err, importActionError
+		}
+	}
+
+	if len(inserts) > 0 {
+		pending := make([]*repo.Planet, len(inserts))
+		for i, row := range inserts {
+			pending[i] = row.planet
+		}
+
+		insertErrs, writeConcernErr := repo.CreatePlanets(pending, false)
+		for i, err := range insertErrs {
+			if err != nil {
+				inserts[i].err, inserts[i].action = err, importActionError
+			}
+		}
+		if writeConcernErr != nil {
+			job.Detail = "The rows were written, but the write concern was not satisfied: " + writeConcernErr.Detail
+		}
+	}
+	// as linhas atualizadas tambem podem ter mudado de nome ou de localizacao
+	planetsReloaded()
+	hyperspace.Invalidate()
+
+	job.Summary, _ = reportImport(rows)
+	rowErrors := []repo.ImportRowError{}
+	for _, row := range rows {
+		if row.err != nil {
+			rowErrors = append(rowErrors, repo.ImportRowError{Row: row.line, Name: rowName(row), Error: row.err})
+		}
+	}
+
+	// as linhas ja foram gravadas; sem o registro dos erros o job nao pode ficar como concluido
+	if err := repo.SaveImportRowErrors(job.ObjectID, rowErrors); err != nil {
+		failImport(job, "The rows were processed, but their errors could not be recorded: "+errorMessage(err))
+		return
+	}
+
+	finishedAt := time.Now().UTC()
+	job.Status, job.FinishedAt = repo.ImportJobCompleted, &finishedAt
+	if err := repo.UpdateImportJob(job); err != nil {
+		failImport(job, "The rows were processed, but the result could not be recorded: "+errorMessage(err))
+	}
+}
+
+func reportImport(rows []*importRow) (repo.ImportSummary, []ImportRowReport) {
+	summary := repo.ImportSummary{Total: len(rows)}
+	reports := make([]ImportRowReport, 0, len(rows))
+
+	for _, row := range rows {
+		report := ImportRowReport{Row: row.line, Action: row.action, Name: rowName(row), Error: row.err}
+		if row.err == nil && row.planet != nil && !row.planet.ObjectID.IsZero() {
+			report.ID = row.planet.ObjectID.Hex()
+		}
+
+		switch row.action {
+		case importActionInsert:
+			summary.Inserts++
+		case importActionUpdate:
+			summary.Updates++
+		case importActionSkip:
+			summary.Skips++
+		default:
+			summary.Errors++
+		}
+
+		reports = append(reports, report)
+	}
+
+	return summary, reports
+}
+
+func rowName(row *importRow) string {
+	if row.planet != nil {
+		return row.planet.Name
+	} else if row.body.Name != nil {
+		return *row.body.Name
+	}
+
+	return ""
+}
+
+func errorMessage(err *common.Error) string {
+	if err.Detail != "" {
+		return err.Message + " " + err.Detail
+	}
+
+	return err.Message
+}
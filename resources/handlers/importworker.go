@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// importacoes em segundo plano rodando ao mesmo tempo e esperando na fila
+	importWorkers    = 2
+	maxQueuedImports = 20
+
+	importHeartbeat = 30 * time.Second
+	// sem sinal nesse tempo a instancia que processava a importacao parou
+	importJobTimeout = 3 * importHeartbeat
+)
+
+type importTask struct {
+	job  *repo.ImportJob
+	rows []*importRow
+}
+
+var imports struct {
+	mu      sync.Mutex
+	queue   chan importTask
+	stopped bool
+	// importacoes na fila ou rodando nesta instancia
+	active map[primitive.ObjectID]bool
+	wg     sync.WaitGroup
+	done   chan struct{}
+}
+
+// marca como falhas as importacoes interrompidas por uma parada do servidor e
+// inicia as rotinas que processam as importacoes em segundo plano
+func startImportWorkers() error {
+	if err := failStaleImports(); err != nil {
+		return errors.New(errorMessage(err))
+	}
+
+	imports.mu.Lock()
+	defer imports.mu.Unlock()
+
+	if imports.queue != nil {
+		return nil
+	}
+
+	imports.queue = make(chan importTask, maxQueuedImports)
+	imports.active = map[primitive.ObjectID]bool{}
+	imports.done = make(chan struct{})
+	imports.stopped = false
+
+	for i := 0; i < importWorkers; i++ {
+		imports.wg.Add(1)
+		go importWorker(imports.queue)
+	}
+	go importHeartbeats(imports.done)
+
+	return nil
+}
+
+// coloca a importacao na fila; falha se a fila estiver cheia ou o servidor parando
+func enqueueImport(task importTask) *common.Error {
+	imports.mu.Lock()
+	defer imports.mu.Unlock()
+
+	if imports.queue == nil || imports.stopped {
+		return common.CreateServiceUnavailableError("The server is not accepting background imports.")
+	}
+
+	select {
+	case imports.queue <- task:
+		imports.active[task.job.ObjectID] = true
+		return nil
+	default:
+		return common.CreateServiceUnavailableError("Too many imports are waiting to be processed. Try again later.")
+	}
+}
+
+func importWorker(queue chan importTask) {
+	defer imports.wg.Done()
+
+	for task := range queue {
+		imports.mu.Lock()
+		stopped := imports.stopped
+		imports.mu.Unlock()
+
+		// com o servidor parando, as importacoes que ainda nao comecaram nao sao iniciadas
+		if stopped {
+			failImport(task.job, "The import was cancelled because the server is shutting down.")
+		} else {
+			runImport(task.job, task.rows)
+		}
+
+		imports.mu.Lock()
+		delete(imports.active, task.job.ObjectID)
+		imports.mu.Unlock()
+	}
+}
+
+func importHeartbeats(done chan struct{}) {
+	ticker := time.NewTicker(importHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		imports.mu.Lock()
+		ids := make([]primitive.ObjectID, 0, len(imports.active))
+		for id := range imports.active {
+			ids = append(ids, id)
+		}
+		imports.mu.Unlock()
+
+		if len(ids) > 0 {
+			if err := repo.TouchImportJobs(ids); err != nil {
+				log.Printf("imports: could not renew the import jobs: %s", err.Message)
+			}
+		}
+
+		// jobs que ninguem renova, de instancias que pararam ou cujo resultado nao foi gravado,
+		// nao esperam a proxima inicializacao
+		if err := failStaleImports(); err != nil {
+			log.Printf("imports: could not fail the interrupted import jobs: %s", err.Message)
+		}
+	}
+}
+
+func failStaleImports() *common.Error {
+	failed, err := repo.FailStaleImportJobs(time.Now().UTC().Add(-importJobTimeout), "The import was interrupted before finishing.")
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		log.Printf("imports: %d interrupted import jobs were marked as failed", failed)
+	}
+
+	return nil
+}
+
+// para de aceitar importacoes e espera as que estao rodando ate o fim do ctx; as que
+// passarem disso ficam sem sinal e sao marcadas como falhas por outra instancia ou na
+// proxima inicializacao
+func StopImports(ctx context.Context) {
+	imports.mu.Lock()
+	if imports.queue == nil || imports.stopped {
+		imports.mu.Unlock()
+		return
+	}
+	imports.stopped = true
+	close(imports.queue)
+	imports.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		imports.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		log.Printf("imports: stopped before the running imports finished")
+	}
+	close(imports.done)
+}
+
+func failImport(job *repo.ImportJob, detail string) {
+	finishedAt := time.Now().UTC()
+	job.Status, job.Detail, job.FinishedAt = repo.ImportJobFailed, detail, &finishedAt
+	if err := repo.UpdateImportJob(job); err != nil {
+		log.Printf("imports: could not mark the import job %s as failed: %s", job.ObjectID.Hex(), errorMessage(err))
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/hyperspace"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultHyperdriveClass = 1.0
+	maxHyperdriveClass     = 20.0
+	// horas para percorrer uma unidade de distancia com um hiperpropulsor classe 1
+	hoursPerDistanceUnit = 1.0
+)
+
+type LaneRequestBody struct {
+	Name     *string  `json:"name"`
+	From     *string  `json:"from"`
+	To       *string  `json:"to"`
+	Distance *float64 `json:"distance"`
+}
+
+type RouteHop struct {
+	Planet RouteHopPlanet `json:"planet"`
+	Lane   *repo.Lane     `json:"lane,omitempty"`
+}
+
+type RouteHopPlanet struct {
+	ID   primitive.ObjectID `json:"id"`
+	Name string             `json:"name"`
+}
+
+type Route struct {
+	From                 primitive.ObjectID `json:"from"`
+	To                   primitive.ObjectID `json:"to"`
+	Hops                 []RouteHop         `json:"hops"`
+	TotalDistance        float64            `json:"totalDistance"`
+	HyperdriveClass      float64            `json:"hyperdriveClass"`
+	EstimatedTravelHours float64            `json:"estimatedTravelHours"`
+}
+
+func initializeLane(r *mux.Router) {
+	sr := r.PathPrefix("/lane").Subrouter()
+	sr.Handle("/", appHandler(createLaneHandler)).Methods("POST")
+	sr.Handle("/", appHandler(getLanesHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(getLaneByIDHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(deleteLaneHandler)).Methods("DELETE")
+
+	r.Handle("/route", appHandler(getRouteHandler)).Methods("GET")
+}
+
+func createLaneHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	requestBody := LaneRequestBody{}
+
+	if err := extractBody(&requestBody, w, r); err != nil {
+		return err
+	}
+
+	errors := map[string]string{}
+	if requestBody.Name == nil || *requestBody.Name == "" {
+		errors["name"] = "Name field is empty or missing."
+	}
+	from := validateReference("from", requestBody.From, errors)
+	to := validateReference("to", requestBody.To, errors)
+
+	if len(errors) == 0 && from == to {
+		errors["to"] = "A lane must connect two different planets."
+	}
+
+	lane := repo.Lane{From: from, To: to}
+	if requestBody.Distance != nil {
+		if *requestBody.Distance <= 0 {
+			errors["distance"] = "Distance must be greater than zero."
+		}
+		lane.Distance = *requestBody.Distance
+	}
+
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+	lane.Name = *requestBody.Name
+
+	id, err := repo.CreateLane(&lane)
+	if err != nil {
+		return err
+	}
+	hyperspace.Invalidate()
+
+	created, err := repo.GetLaneByID(id)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The lane was successfully created.",
+			"lane":    created,
+		},
+		http.StatusCreated,
+		w,
+	)
+
+	return nil
+}
+
+func getLanesHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	lanes, err := repo.GetAllLanes()
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The lanes were successfully retrieved.",
+			"lanes":   lanes,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getLaneByIDHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	lane, err := repo.GetLaneByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The lane was successfully retrieved.",
+			"lane":    lane,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func deleteLaneHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DeleteLane(*oid); err != nil {
+		return err
+	}
+	hyperspace.Invalidate()
+
+	respondWithMessage("The lane was successfully deleted.", http.StatusOK, w)
+
+	return nil
+}
+
+func getRouteHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	query := r.URL.Query()
+	errors := map[string]string{}
+
+	fromParam, toParam := query.Get("from"), query.Get("to")
+	from := validateReference("from", &fromParam, errors)
+	to := validateReference("to", &toParam, errors)
+
+	class := defaultHyperdriveClass
+	if query.Get("class") != "" {
+		class = parseFloatQuery("class", r, false, errors)
+		if _, invalid := errors["class"]; !invalid && (class <= 0 || class > maxHyperdriveClass) {
+			errors["class"] = "The hyperdrive class must be greater than zero and at most 20."
+		}
+	}
+
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	planets, err := repo.GetPlanetsByIDs([]primitive.ObjectID{from, to})
+	if err != nil {
+		return err
+	}
+
+	for field, id := range map[string]primitive.ObjectID{"from": from, "to": to} {
+		if _, ok := planets[id]; !ok {
+			errors[field] = "Planet not found under given id (" + id.Hex() + ")."
+		}
+	}
+
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	graph, err := hyperspace.Current()
+	if err != nil {
+		return err
+	}
+
+	path, found := graph.ShortestPath(from, to)
+	if !found {
+		return common.CreateNotFoundError("There is no hyperspace route between the given planets.")
+	}
+
+	route, err := buildRoute(path, from, to, class)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The route was successfully planned.",
+			"route":   route,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func buildRoute(path *hyperspace.Path, from, to primitive.ObjectID, class float64) (*Route, *common.Error) {
+	ids := make([]primitive.ObjectID, 0, len(path.Hops))
+	for _, hop := range path.Hops {
+		ids = append(ids, hop.PlanetID)
+	}
+
+	planets, err := repo.GetPlanetsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	route := Route{
+		From:                 from,
+		To:                   to,
+		Hops:                 make([]RouteHop, 0, len(path.Hops)),
+		TotalDistance:        path.Distance,
+		HyperdriveClass:      class,
+		EstimatedTravelHours: path.Distance * class * hoursPerDistanceUnit,
+	}
+
+	for _, hop := range path.Hops {
+		planet := RouteHopPlanet{ID: hop.PlanetID}
+		if p, ok := planets[hop.PlanetID]; ok {
+			planet.Name = p.Name
+		}
+
+		route.Hops = append(route.Hops, RouteHop{Planet: planet, Lane: hop.Lane})
+	}
+
+	return &route, nil
+}
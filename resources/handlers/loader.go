@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type loaderResult struct {
+	value interface{}
+	err   *common.Error
+}
+
+// carrega recursos relacionados em lotes, com cache por requisicao; as chaves agendadas com
+// prime sao buscadas todas juntas no primeiro load, evitando uma consulta por item de uma lista
+type loader struct {
+	mu      sync.Mutex
+	batch   func(keys []string) (map[string]interface{}, *common.Error)
+	pending []string
+	cache   map[string]*loaderResult
+}
+
+func newLoader(batch func(keys []string) (map[string]interface{}, *common.Error)) *loader {
+	return &loader{batch: batch, cache: map[string]*loaderResult{}}
+}
+
+func (l *loader) prime(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := l.cache[key]; !ok {
+			l.pending = append(l.pending, key)
+		}
+	}
+}
+
+// valor da chave, ou nil quando o lote nao a encontrou
+func (l *loader) load(key string) (interface{}, *common.Error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if result, ok := l.cache[key]; ok {
+		return result.value, result.err
+	}
+
+	keys := []string{key}
+	seen := map[string]bool{key: true}
+	for _, pending := range l.pending {
+		if _, ok := l.cache[pending]; !ok && !seen[pending] {
+			seen[pending] = true
+			keys = append(keys, pending)
+		}
+	}
+	l.pending = nil
+
+	values, err := l.batch(keys)
+	for _, k := range keys {
+		l.cache[k] = &loaderResult{value: values[k], err: err}
+	}
+
+	return values[key], err
+}
+
+// loaders de uma requisicao GraphQL
+type planetLoaders struct {
+	systems      *loader
+	swapiPlanets *loader
+	films        *loader
+	residents    *loader
+
+	mu sync.Mutex
+	// planetas ja resolvidos, de onde saem os nomes buscados na SWAPI
+	planets map[string]*repo.Planet
+}
+
+func newPlanetLoaders() *planetLoaders {
+	l := &planetLoaders{planets: map[string]*repo.Planet{}}
+	l.systems = newLoader(l.loadSystems)
+	l.swapiPlanets = newLoader(l.loadSWAPIPlanets)
+	l.films = newLoader(loadSWAPIResources(func(url string) (interface{}, *common.Error) { return getSWAPIFilm(url) }))
+	l.residents = newLoader(loadSWAPIResources(func(url string) (interface{}, *common.Error) { return getSWAPIResident(url) }))
+
+	return l
+}
+
+// agenda os relacionamentos dos planetas de uma lista para serem carregados juntos
+func (l *planetLoaders) primePlanets(planets []*repo.Planet) {
+	ids := make([]string, 0, len(planets))
+	systemIDs := []string{}
+
+	l.mu.Lock()
+	for _, planet := range planets {
+		id := planet.ObjectID.Hex()
+		l.planets[id] = planet
+		ids = append(ids, id)
+		if planet.SystemID != nil {
+			systemIDs = append(systemIDs, planet.SystemID.Hex())
+		}
+	}
+	l.mu.Unlock()
+
+	l.swapiPlanets.prime(ids...)
+	l.systems.prime(systemIDs...)
+}
+
+// sistemas em uma unica consulta ao banco
+func (l *planetLoaders) loadSystems(keys []string) (map[string]interface{}, *common.Error) {
+	ids := make([]primitive.ObjectID, 0, len(keys))
+	for _, key := range keys {
+		if oid, err := primitive.ObjectIDFromHex(key); err == nil {
+			ids = append(ids, oid)
+		}
+	}
+
+	systems, err := repo.GetSystemsByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for id, system := range systems {
+		values[id.Hex()] = system
+	}
+
+	return values, nil
+}
+
+// a SWAPI nao busca varios planetas de uma vez; as buscas do lote sao feitas em paralelo e os
+// filmes e residentes encontrados sao agendados para tambem serem carregados juntos
+func (l *planetLoaders) loadSWAPIPlanets(keys []string) (map[string]interface{}, *common.Error) {
+	found := make([]*SWAPIPlanet, len(keys))
+	err := fetchSWAPIResources(keys, func(i int, key string) *common.Error {
+		l.mu.Lock()
+		planet := l.planets[key]
+		l.mu.Unlock()
+
+		if planet == nil {
+			return nil
+		}
+
+		var err *common.Error
+		found[i], err = getSWAPIPlanet(planet.AllNames())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for i, swapiPlanet := range found {
+		if swapiPlanet != nil {
+			values[keys[i]] = swapiPlanet
+			l.films.prime(swapiPlanet.Films...)
+			l.residents.prime(swapiPlanet.Residents...)
+		}
+	}
+
+	return values, nil
+}
+
+// busca cada url uma vez, mesmo que varios planetas compartilhem o filme ou o residente
+func loadSWAPIResources(get func(url string) (interface{}, *common.Error)) func(keys []string) (map[string]interface{}, *common.Error) {
+	return func(keys []string) (map[string]interface{}, *common.Error) {
+		results := make([]interface{}, len(keys))
+		err := fetchSWAPIResources(keys, func(i int, url string) *common.Error {
+			var err *common.Error
+			results[i], err = get(url)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		values := map[string]interface{}{}
+		for i, key := range keys {
+			values[key] = results[i]
+		}
+
+		return values, nil
+	}
+}
+
+func (l *planetLoaders) system(planet *repo.Planet) (*repo.System, *common.Error) {
+	if planet.SystemID == nil {
+		return nil, nil
+	}
+
+	value, err := l.systems.load(planet.SystemID.Hex())
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	return value.(*repo.System), nil
+}
+
+func (l *planetLoaders) swapiPlanet(planet *repo.Planet) (*SWAPIPlanet, *common.Error) {
+	l.mu.Lock()
+	l.planets[planet.ObjectID.Hex()] = planet
+	l.mu.Unlock()
+
+	value, err := l.swapiPlanets.load(planet.ObjectID.Hex())
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	return value.(*SWAPIPlanet), nil
+}
+
+func (l *planetLoaders) planetFilms(planet *repo.Planet) ([]*Film, *common.Error) {
+	films := []*Film{}
+	swapiPlanet, err := l.swapiPlanet(planet)
+	if err != nil || swapiPlanet == nil {
+		return films, err
+	}
+
+	for _, url := range swapiPlanet.Films {
+		value, err := l.films.load(url)
+		if err != nil {
+			return nil, err
+		}
+		films = append(films, value.(*Film))
+	}
+
+	return films, nil
+}
+
+func (l *planetLoaders) planetResidents(planet *repo.Planet) ([]*Resident, *common.Error) {
+	residents := []*Resident{}
+	swapiPlanet, err := l.swapiPlanet(planet)
+	if err != nil || swapiPlanet == nil {
+		return residents, err
+	}
+
+	for _, url := range swapiPlanet.Residents {
+		value, err := l.residents.load(url)
+		if err != nil {
+			return nil, err
+		}
+		residents = append(residents, value.(*Resident))
+	}
+
+	return residents, nil
+}
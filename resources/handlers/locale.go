@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"golang.org/x/text/language"
+)
+
+// valida as chaves do mapa de nomes como language tags e as deixa no formato canonico
+func normalizeLocalizedNames(names map[string]string) (map[string]string, string) {
+	if names == nil {
+		return nil, ""
+	}
+
+	normalized := make(map[string]string, len(names))
+	for key, name := range names {
+		tag, err := language.Parse(key)
+		if err != nil {
+			return nil, fmt.Sprintf("'%s' is not a valid language tag.", key)
+		}
+
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Sprintf("Name for language '%s' is empty.", key)
+		}
+
+		normalized[tag.String()] = name
+	}
+
+	return normalized, ""
+}
+
+// escolhe o nome de exibicao de acordo com o header Accept-Language
+func localizePlanet(planet *repo.Planet, r *http.Request) {
+	localizePlanetTo(planet, r.Header.Get("Accept-Language"))
+}
+
+// como localizePlanet, com o valor do Accept-Language; usado tambem pelo gRPC
+func localizePlanetTo(planet *repo.Planet, acceptLanguage string) {
+	planet.DisplayName = planet.Name
+
+	if len(planet.Names) == 0 {
+		return
+	}
+
+	preferred, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return
+	}
+
+	keys := make([]string, 0, len(planet.Names))
+	for key := range planet.Names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// primeiro tenta a tag exata, depois apenas o idioma base (pt-BR -> pt)
+	for _, tag := range preferred {
+		if name, ok := planet.Names[tag.String()]; ok {
+			planet.DisplayName = name
+			return
+		}
+
+		base, _ := tag.Base()
+		for _, key := range keys {
+			if keyBase, _ := language.Make(key).Base(); keyBase == base {
+				planet.DisplayName = planet.Names[key]
+				return
+			}
+		}
+	}
+}
+
+func localizePlanets(planets []*repo.Planet, r *http.Request) {
+	for _, planet := range planets {
+		localizePlanet(planet, r)
+	}
+}
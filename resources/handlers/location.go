@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+const (
+	gridColumns = 26
+	gridRows    = 99
+
+	defaultNearLimit  = 50
+	maxNearLimit      = 500
+	defaultNeighbors  = 5
+	maxNeighbors      = 100
+	geoJSONFormat     = "geojson"
+	geoJSONMediaType  = "application/geo+json"
+	maxCoordinateSize = repo.MaxCoordinate
+)
+
+// quadrantes do mapa galactico: coluna A-Z e linha 1-99, ex.: "R-16"
+var gridPattern = regexp.MustCompile(`^([A-Za-z])-?([0-9]{1,2})$`)
+
+type LocationRequestBody struct {
+	X *float64 `json:"x"`
+	Y *float64 `json:"y"`
+}
+
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   GeoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func getPlanetsNearHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	errors := map[string]string{}
+	query := repo.NearQuery{
+		X:      parseFloatQuery("x", r, true, errors),
+		Y:      parseFloatQuery("y", r, true, errors),
+		Radius: parseFloatQuery("radius", r, false, errors),
+		Limit:  int64(parseIntQuery("limit", r, defaultNearLimit, maxNearLimit, errors)),
+	}
+
+	if query.Radius < 0 {
+		errors["radius"] = "Radius must not be negative."
+	}
+
+	if !withinGalaxy(query.X) || !withinGalaxy(query.Y) {
+		errors["location"] = "Location is out of the galaxy bounds."
+	}
+
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	planets, err := repo.GetPlanetsNear(query)
+	if err != nil {
+		return err
+	}
+
+	return respondWithNearPlanets(planets, w, r)
+}
+
+func getPlanetNeighborsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	errors := map[string]string{}
+	k := parseIntQuery("k", r, defaultNeighbors, maxNeighbors, errors)
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	planet, err := repo.GetPlanetByID(*oid)
+	if err != nil {
+		return err
+	}
+
+	if planet.Location == nil {
+		return common.CreateBadRequestError("The planet has no galactic coordinates.")
+	}
+
+	planets, err := repo.GetPlanetsNear(repo.NearQuery{
+		X:       planet.Location.X,
+		Y:       planet.Location.Y,
+		Limit:   int64(k),
+		Exclude: oid,
+	})
+	if err != nil {
+		return err
+	}
+
+	return respondWithNearPlanets(planets, w, r)
+}
+
+func respondWithNearPlanets(planets []*repo.Planet, w http.ResponseWriter, r *http.Request) *common.Error {
+	localizePlanets(planets, r)
+
+	if r.URL.Query().Get("format") == geoJSONFormat {
+		w.Header().Set("Content-Type", geoJSONMediaType)
+		respond(toFeatureCollection(planets), http.StatusOK, w)
+		return nil
+	}
+
+	return respondWithPlanetList(planets, "results", "The planets were successfully retrieved.", w, r)
+}
+
+func toFeatureCollection(planets []*repo.Planet) GeoJSONFeatureCollection {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]GeoJSONFeature, 0, len(planets))}
+
+	for _, planet := range planets {
+		if planet.Location == nil {
+			continue
+		}
+
+		properties := map[string]interface{}{
+			"name":            planet.Name,
+			"displayName":     planet.DisplayName,
+			"climate":         planet.Climate,
+			"terrain":         planet.Terrain,
+			"filmsAppearedIn": planet.FilmsAppearedIn,
+			"grid":            planet.Grid,
+		}
+		if planet.Distance != nil {
+			properties["distance"] = *planet.Distance
+		}
+
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type:       "Feature",
+			ID:         planet.ObjectID.Hex(),
+			Geometry:   GeoJSONPoint{Type: "Point", Coordinates: [2]float64{planet.Location.X, planet.Location.Y}},
+			Properties: properties,
+		})
+	}
+
+	return collection
+}
+
+// os limites do indice 2d; uma coordenada fora deles faria a escrita ou a consulta falhar
+func withinGalaxy(coordinate float64) bool {
+	return coordinate >= -maxCoordinateSize && coordinate <= maxCoordinateSize
+}
+
+// valida location e grid; se ambos forem enviados, o quadrante deve conter a coordenada
+func validateLocation(planet *PlanetRequestBody, errors map[string]string) {
+	if planet.Location != nil {
+		if planet.Location.X == nil || planet.Location.Y == nil {
+			errors["location"] = "Location must have both x and y."
+			return
+		}
+
+		if !withinGalaxy(*planet.Location.X) || !withinGalaxy(*planet.Location.Y) {
+			errors["location"] = "Location is out of the galaxy bounds."
+			return
+		}
+	}
+
+	if planet.Grid == nil || *planet.Grid == "" {
+		return
+	}
+
+	grid, ok := normalizeGrid(*planet.Grid)
+	if !ok {
+		errors["grid"] = "Grid square must be a column letter and a row number, such as 'R-16'."
+		return
+	}
+
+	if planet.Location != nil && gridFor(*planet.Location.X, *planet.Location.Y) != grid {
+		errors["grid"] = "Grid square does not contain the given location."
+	}
+}
+
+// aplica as coordenadas do corpo; um grid vazio remove as coordenadas do planeta
+func applyLocation(planet *repo.Planet, requestBody *PlanetRequestBody) {
+	if requestBody.Location != nil {
+		x, y := *requestBody.Location.X, *requestBody.Location.Y
+		planet.Location = &repo.Location{X: x, Y: y}
+		planet.Grid = gridFor(x, y)
+	} else if requestBody.Grid != nil {
+		if *requestBody.Grid == "" {
+			planet.Location = nil
+			planet.Grid = ""
+		} else {
+			grid, _ := normalizeGrid(*requestBody.Grid)
+			x, y := gridCenter(grid)
+			planet.Location = &repo.Location{X: x, Y: y}
+			planet.Grid = grid
+		}
+	}
+}
+
+func normalizeGrid(grid string) (string, bool) {
+	match := gridPattern.FindStringSubmatch(strings.TrimSpace(grid))
+	if match == nil {
+		return "", false
+	}
+
+	row, _ := strconv.Atoi(match[2])
+	if row < 1 || row > gridRows {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s-%d", strings.ToUpper(match[1]), row), true
+}
+
+// quadrante que contem a coordenada, vazio quando fora do mapa
+func gridFor(x, y float64) string {
+	if x < 0 || x >= gridColumns || y < 0 || y >= gridRows {
+		return ""
+	}
+
+	return fmt.Sprintf("%c-%d", 'A'+int(x), int(y)+1)
+}
+
+func gridCenter(grid string) (float64, float64) {
+	var column rune
+	var row int
+	fmt.Sscanf(grid, "%c-%d", &column, &row)
+
+	return float64(column-'A') + 0.5, float64(row-1) + 0.5
+}
+
+func parseFloatQuery(param string, r *http.Request, required bool, errors map[string]string) float64 {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		if required {
+			errors[param] = fmt.Sprintf("The %s parameter is missing.", param)
+		}
+		return 0
+	}
+
+	// NaN e Inf sao aceitos pelo ParseFloat, mas nao pelas consultas geograficas
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		errors[param] = fmt.Sprintf("The %s parameter must be a number.", param)
+	}
+
+	return number
+}
+
+func parseIntQuery(param string, r *http.Request, defaultValue int, max int, errors map[string]string) int {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 || number > max {
+		errors[param] = fmt.Sprintf("The %s parameter must be a number between 1 and %d.", param, max)
+	}
+
+	return number
+}
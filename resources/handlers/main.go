@@ -1,9 +1,52 @@
 package handlers
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+
 	"github.com/gorilla/mux"
 )
 
-func Initialize(r *mux.Router) {
+func Initialize(r *mux.Router) error {
+	if err := Configure(); err != nil {
+		return err
+	}
+
+	if err := startImportWorkers(); err != nil {
+		return err
+	}
+
 	initializePlanet(r)
+	initializeTaxonomy(r)
+	initializeGeography(r)
+	initializeLane(r)
+	initializeTag(r)
+	initializeHypermedia(r)
+	initializeHealth(r)
+	initializeGraphQL(r)
+	return nil
+}
+
+// le as configuracoes do ambiente; usado tambem pelos comandos que nao sobem o servidor.
+// sem ADMIN_TOKEN as rotas de administrador recusam qualquer token
+func Configure() error {
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	graphiqlEnabled = os.Getenv("APP_ENV") == "development"
+
+	// um valor desconhecido, como um erro de digitacao em strict, nao pode virar lenient em silencio
+	switch mode := os.Getenv("TAXONOMY_MODE"); mode {
+	case "", TaxonomyModeLenient:
+		taxonomyMode = TaxonomyModeLenient
+	case TaxonomyModeStrict:
+		taxonomyMode = TaxonomyModeStrict
+	default:
+		return fmt.Errorf("TAXONOMY_MODE must be either '%s' or '%s', got '%s'", TaxonomyModeStrict, TaxonomyModeLenient, mode)
+	}
+
+	if size, err := strconv.ParseInt(os.Getenv("MAX_BODY_SIZE"), 10, 64); err == nil && size > 0 {
+		maxBodySize = size
+	}
+
+	return nil
 }
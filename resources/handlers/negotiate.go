@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
+)
+
+// formato de representacao; encode escreve a resposta e decode le o corpo da requisicao em v
+type Encoder struct {
+	MediaType string
+	// outros nomes aceitos para o mesmo formato
+	Aliases []string
+	Encode  func(w io.Writer, data interface{}) error
+	Decode  func(body []byte, v interface{}) *common.Error
+}
+
+var encoders []*Encoder
+
+func init() {
+	RegisterEncoder(&Encoder{MediaType: jsonMediaType, Encode: encodeJSON, Decode: decodeJSON})
+	RegisterEncoder(&Encoder{MediaType: "application/xml", Aliases: []string{"text/xml"}, Encode: encodeXML, Decode: decodeXML})
+	RegisterEncoder(&Encoder{MediaType: "application/yaml", Aliases: []string{"application/x-yaml", "text/yaml"}, Encode: encodeYAML, Decode: decodeYAML})
+	RegisterEncoder(&Encoder{MediaType: "application/msgpack", Aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, Encode: encodeMsgpack, Decode: decodeMsgpack})
+	RegisterEncoder(&Encoder{MediaType: jsonAPIMediaType, Encode: encodeJSONAPI, Decode: decodeJSONAPI})
+	RegisterEncoder(&Encoder{MediaType: halMediaType, Encode: encodeJSON, Decode: decodeJSON})
+}
+
+// registra um formato; o primeiro registrado e o padrao
+func RegisterEncoder(e *Encoder) {
+	encoders = append(encoders, e)
+}
+
+func (e *Encoder) matches(mediaType string) bool {
+	return e.MediaType == mediaType || containsString(e.Aliases, mediaType)
+}
+
+func encoderForContentType(mediaType string) *Encoder {
+	for _, e := range encoders {
+		if e.matches(mediaType) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func supportedMediaTypes() []string {
+	types := []string{}
+	for _, e := range encoders {
+		types = append(types, e.MediaType)
+	}
+
+	return types
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// faixas do header Accept, da maior para a menor preferencia
+func parseAccept(header string) []acceptRange {
+	ranges := []acceptRange{}
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	return ranges
+}
+
+func matchesRange(mediaType string, pattern string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+
+	return strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+}
+
+// formato escolhido para a resposta; sem header Accept, o padrao. Retorna nil quando
+// nenhum formato aceito e suportado
+func negotiateEncoder(r *http.Request) *Encoder {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return encoders[0]
+	}
+
+	for _, accepted := range parseAccept(header) {
+		for _, e := range encoders {
+			if matchesRange(e.MediaType, accepted.mediaType) {
+				return e
+			}
+			for _, alias := range e.Aliases {
+				if matchesRange(alias, accepted.mediaType) {
+					return e
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// 406 apenas quando o cliente nao aceita nenhum formato que a rota produz: os negociados ou
+// os produzidos diretamente pelo handler (imagens, exportacao, GeoJSON)
+func checkAcceptable(r *http.Request, produces []string) *common.Error {
+	if negotiateEncoder(r) != nil {
+		return nil
+	}
+
+	for _, accepted := range parseAccept(r.Header.Get("Accept")) {
+		for _, mediaType := range produces {
+			if matchesRange(mediaType, accepted.mediaType) || matchesRange(accepted.mediaType, mediaType) {
+				return nil
+			}
+		}
+	}
+
+	return common.CreateNotAcceptableError(fmt.Sprintf("None of the accepted media types is supported. Supported media types: %s.", strings.Join(supportedMediaTypes(), ", ")))
+}
+
+// responseWriter guarda a requisicao para que respond possa negociar o formato
+type responseWriter struct {
+	http.ResponseWriter
+	request *http.Request
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func encodeJSON(w io.Writer, data interface{}) error {
+	return json.NewEncoder(w).Encode(data)
+}
+
+// converte para mapas, listas e valores simples seguindo as tags json, para que todos os
+// formatos tenham os mesmos nomes de campos
+func toGeneric(data interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return convertNumbers(generic), nil
+}
+
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+
+	return value
+}
+
+// o inverso: valores genericos passam pelo decodificador JSON estrito
+func decodeGeneric(generic interface{}, v interface{}) *common.Error {
+	encoded, err := json.Marshal(generic)
+	if err != nil {
+		return common.CreateGenericBadRequestError(err)
+	}
+
+	return decodeJSON(encoded, v)
+}
+
+func encodeYAML(w io.Writer, data interface{}) error {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+
+	return yaml.NewEncoder(w).Encode(generic)
+}
+
+func decodeYAML(body []byte, v interface{}) *common.Error {
+	var generic interface{}
+	if err := yaml.Unmarshal(body, &generic); err != nil {
+		return common.CreateGenericBadRequestError(err)
+	}
+
+	return decodeGeneric(stringKeys(generic), v)
+}
+
+// o yaml.v2 decodifica mapas com chaves interface{}, que o JSON nao aceita
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = stringKeys(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+	}
+
+	return value
+}
+
+func encodeMsgpack(w io.Writer, data interface{}) error {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+
+	return msgpack.NewEncoder(w).Encode(generic)
+}
+
+func decodeMsgpack(body []byte, v interface{}) *common.Error {
+	var generic interface{}
+	if err := msgpack.Unmarshal(body, &generic); err != nil {
+		return common.CreateGenericBadRequestError(err)
+	}
+
+	return decodeGeneric(stringKeys(generic), v)
+}
+
+// nomes de elementos validos; outras chaves viram <entry key="...">
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// mapas viram elementos com o nome das chaves (em ordem alfabetica) e listas viram
+// elementos <item> repetidos, dentro de <response>
+func encodeXML(w io.Writer, data interface{}) error {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	if err := writeXMLElement(encoder, "response", generic); err != nil {
+		return err
+	}
+
+	return encoder.Flush()
+}
+
+func writeXMLElement(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlNamePattern.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "xml") {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedGenericKeys(v) {
+			if err := writeXMLElement(encoder, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXMLElement(encoder, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+func sortedGenericKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+type xmlNode struct {
+	name     string
+	text     string
+	children []*xmlNode
+}
+
+func decodeXML(body []byte, v interface{}) *common.Error {
+	root, err := parseXML(body)
+	if err != nil {
+		return common.CreateGenericBadRequestError(err)
+	}
+
+	return decodeGeneric(coerceXML(root, reflect.TypeOf(v)), v)
+}
+
+func parseXML(body []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	stack := []*xmlNode{}
+	var root *xmlNode
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local}
+			for _, attr := range t.Attr {
+				if t.Name.Local == "entry" && attr.Name.Local == "key" {
+					node.name = attr.Value
+				}
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			} else {
+				return nil, fmt.Errorf("the document has more than one root element")
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, io.EOF
+	}
+
+	return root, nil
+}
+
+// no XML tudo e texto; o tipo de destino decide se o texto vira numero, booleano, lista ou objeto
+func coerceXML(node *xmlNode, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	text := strings.TrimSpace(node.text)
+
+	if t == nil {
+		if len(node.children) == 0 {
+			return text
+		}
+
+		m := map[string]interface{}{}
+		for _, child := range node.children {
+			m[child.name] = coerceXML(child, nil)
+		}
+		return m
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFieldTypes(t)
+		m := map[string]interface{}{}
+		for _, child := range node.children {
+			m[child.name] = coerceXML(child, fields[child.name])
+		}
+		return m
+	case reflect.Map:
+		m := map[string]interface{}{}
+		for _, child := range node.children {
+			m[child.name] = coerceXML(child, t.Elem())
+		}
+		return m
+	case reflect.Slice:
+		items := []interface{}{}
+		for _, child := range node.children {
+			items = append(items, coerceXML(child, t.Elem()))
+		}
+		return items
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(text)
+		}
+	}
+
+	// texto que nao corresponde ao tipo segue como string e o decodificador aponta o campo
+	return text
+}
+
+// tipos dos campos pelo nome JSON, incluindo os de structs embutidos
+func jsonFieldTypes(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if field.Anonymous && name == "" {
+			for key, value := range jsonFieldTypes(field.Type) {
+				fields[key] = value
+			}
+			continue
+		}
+
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+
+	return fields
+}
@@ -1,65 +1,112 @@
 package handlers
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/autocomplete"
 	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/fuzzy"
+	"github.com/jvitoroc/b2w-star-wars/resources/hyperspace"
 	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const maxDescriptionLength = 2000
+
 type PlanetRequestBody struct {
-	Name    *string `json:"name"`
-	Climate *string `json:"climate"`
-	Terrain *string `json:"terrain"`
+	Name    *string           `json:"name"`
+	Aliases []string          `json:"aliases"`
+	Names   map[string]string `json:"names"`
+	Climate *string           `json:"climate"`
+	Terrain *string           `json:"terrain"`
+	System  *string           `json:"systemId"`
+
+	Description *string `json:"description"`
+	Language    *string `json:"language"`
+
+	Location *LocationRequestBody `json:"location"`
+	Grid     *string              `json:"grid"`
+
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
 }
 
 func initializePlanet(r *mux.Router) {
 	sr := r.PathPrefix("/planet").Subrouter()
 	sr.Handle("/", appHandler(createPlanetHandler)).Methods("POST")
+	sr.Handle("/_bulk", appHandler(bulkCreatePlanetsHandler)).Methods("POST")
+	// rotas fixas antes das rotas com {id}, que tambem as aceitariam
+	sr.Handle("/near", producing(getPlanetsNearHandler, geoJSONMediaType)).Methods("GET")
+	sr.Handle("/search", appHandler(searchPlanetsHandler)).Methods("GET")
+	sr.Handle("/suggest", appHandler(suggestPlanetsHandler)).Methods("GET")
+	sr.Handle("/stats", appHandler(getPlanetStatsHandler)).Methods("GET")
+	sr.Handle("/export", producing(exportPlanetsHandler, "text/csv", ndjsonMediaType)).Methods("GET")
+	sr.Handle("/import", appHandler(importPlanetsHandler)).Methods("POST")
+	sr.Handle("/import/{jobId:[a-z0-9]+}", appHandler(getImportJobHandler)).Methods("GET")
+	sr.Handle("/import/{jobId:[a-z0-9]+}/errors.csv", producing(getImportJobErrorsHandler, "text/csv")).Methods("GET")
 	sr.Handle("/{id:[a-z0-9]+}", appHandler(getPlanetByIDHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/neighbors", appHandler(getPlanetNeighborsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/tags/{tag}", appHandler(addPlanetTagHandler)).Methods("POST")
+	sr.Handle("/{id:[a-z0-9]+}/tags/{tag}", appHandler(removePlanetTagHandler)).Methods("DELETE")
+	sr.Handle("/{id:[a-z0-9]+}/image", appHandler(putPlanetImageHandler)).Methods("PUT")
+	sr.Handle("/{id:[a-z0-9]+}/image", producing(getPlanetImageHandler, "image/*")).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}/image", appHandler(deletePlanetImageHandler)).Methods("DELETE")
 	sr.Handle("/", appHandler(getMatchedPlanetHandler)).Queries("search", "{search}").Methods("GET")
 	sr.Handle("/", appHandler(getPlanetsHandler)).Methods("GET")
+	sr.Handle("/{id:[a-z0-9]+}", appHandler(updatePlanetHandler)).Methods("PATCH")
 	sr.Handle("/{id:[a-z0-9]+}", appHandler(deletePlanetHandler)).Methods("DELETE")
 }
 
 func createPlanetHandler(w http.ResponseWriter, r *http.Request) *common.Error {
 	requestBody := PlanetRequestBody{}
 
-	if err := extractPlanet(&requestBody, r); err != nil {
+	if err := extractPlanet(&requestBody, w, r); err != nil {
 		return err
 	}
 
-	if err := validatePlanet(&requestBody); err != nil {
+	if err := checkIncludes(r); err != nil {
 		return err
 	}
 
-	filmsAppearedIn, err := getFilmsAppearedIn(*requestBody.Name)
+	created, err := createPlanet(&requestBody)
 	if err != nil {
 		return err
 	}
+	localizePlanet(created, r)
 
-	id, err := repo.CreatePlanet(*requestBody.Name, *requestBody.Climate, *requestBody.Terrain, filmsAppearedIn)
-	if err != nil {
-		return err
+	return respondWithPlanet(created, "The planet was successfully created.", http.StatusCreated, w, r)
+}
+
+// valida o corpo, conta os filmes na SWAPI e grava o planeta; usado tambem pelo GraphQL
+func createPlanet(requestBody *PlanetRequestBody) (*repo.Planet, *common.Error) {
+	if err := validatePlanet(requestBody); err != nil {
+		return nil, err
+	}
+
+	if err := canonicalizePlanet(requestBody); err != nil {
+		return nil, err
 	}
 
-	planet, err := repo.GetPlanetByID(id)
+	planet := repo.Planet{}
+	applyPlanetRequestBody(&planet, requestBody)
+
+	filmsAppearedIn, err := getFilmsAppearedIn(planet.AllNames())
 	if err != nil {
-		return err
+		return nil, err
 	}
+	planet.FilmsAppearedIn = filmsAppearedIn
 
-	respond(
-		map[string]interface{}{
-			"message": "The planet was successfully created.",
-			"planet":  planet,
-		},
-		http.StatusCreated,
-		w,
-	)
+	id, err := repo.CreatePlanet(&planet)
+	if err != nil {
+		return nil, err
+	}
+	planet.ObjectID = id
+	planetNamesChanged(&planet)
 
-	return nil
+	return repo.GetPlanetByID(id)
 }
 
 func getPlanetByIDHandler(w http.ResponseWriter, r *http.Request) *common.Error {
@@ -70,61 +117,133 @@ func getPlanetByIDHandler(w http.ResponseWriter, r *http.Request) *common.Error
 		return err
 	}
 
-	planet, err := repo.GetPlanetByID(*oid)
+	projection, err := extractPlanetProjection(r)
 	if err != nil {
 		return err
 	}
 
-	respond(
-		map[string]interface{}{
-			"message": "The planet was successfully retrieved.",
-			"planet":  planet,
-		},
-		http.StatusOK,
-		w,
-	)
+	planet, err := repo.GetProjectedPlanetByID(*oid, projection)
+	if err != nil {
+		return err
+	}
+	localizePlanet(planet, r)
 
-	return nil
+	return respondWithPlanet(planet, "The planet was successfully retrieved.", http.StatusOK, w, r)
 }
 
 func getMatchedPlanetHandler(w http.ResponseWriter, r *http.Request) *common.Error {
-	results, err := repo.GetMatchedPlanets(map[string]string{
-		"name": r.URL.Query().Get("search"),
-	})
+	filter, err := extractPlanetFilter(r)
+	if err != nil {
+		return err
+	}
 
+	results, err := repo.GetMatchedPlanets(filter)
 	if err != nil {
 		return err
 	}
+	localizePlanets(results, r)
+	warnUnindexedFilter(filter, w)
 
-	respond(
-		map[string]interface{}{
-			"message": "The planets were successfully retrieved.",
-			"results": results,
-		},
-		http.StatusOK,
-		w,
-	)
+	if filter.Match == repo.SearchFuzzy {
+		sortByFuzzyDistance(results, filter.Search)
+	}
 
-	return nil
+	extra := map[string]interface{}{}
+	if len(results) == 0 {
+		suggestions, err := searchSuggestions(filter)
+		if err != nil {
+			return err
+		}
+		if len(suggestions) > 0 {
+			extra["suggestions"] = suggestions
+		}
+	}
+
+	return respondWithPlanetListExtra(results, "results", "The planets were successfully retrieved.", extra, w, r)
 }
 
 func getPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
-	planets, err := repo.GetAllPlanets()
+	filter, err := extractPlanetFilter(r)
+	if err != nil {
+		return err
+	}
 
+	planets, err := repo.GetMatchedPlanets(filter)
 	if err != nil {
 		return err
 	}
+	localizePlanets(planets, r)
+	warnUnindexedFilter(filter, w)
 
-	respond(
-		map[string]interface{}{
-			"message": "The planets were successfully retrieved.",
-			"planets": planets,
-		},
-		http.StatusOK,
-		w,
-	)
+	return respondWithPlanetList(planets, "planets", "The planets were successfully retrieved.", w, r)
+}
 
-	return nil
+func updatePlanetHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	id, _ := extractParam("id", r)
+	requestBody := PlanetRequestBody{}
+
+	oid, err := stringToObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := extractPlanet(&requestBody, w, r); err != nil {
+		return err
+	}
+
+	if err := checkIncludes(r); err != nil {
+		return err
+	}
+
+	updated, err := updatePlanet(*oid, &requestBody)
+	if err != nil {
+		return err
+	}
+	localizePlanet(updated, r)
+
+	return respondWithPlanet(updated, "The planet was successfully updated.", http.StatusOK, w, r)
+}
+
+// aplica os campos presentes no corpo ao planeta; usado tambem pelo GraphQL
+func updatePlanet(oid primitive.ObjectID, requestBody *PlanetRequestBody) (*repo.Planet, *common.Error) {
+	if err := validatePlanetPatch(requestBody); err != nil {
+		return nil, err
+	}
+
+	if err := canonicalizePlanet(requestBody); err != nil {
+		return nil, err
+	}
+
+	planet, err := repo.GetPlanetByID(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	applyPlanetRequestBody(planet, requestBody)
+	fields := requestBody.fields()
+
+	// a contagem de filmes so muda se algum dos nomes mudar
+	if requestBody.namesChanged() {
+		filmsAppearedIn, err := getFilmsAppearedIn(planet.AllNames())
+		if err != nil {
+			return nil, err
+		}
+		planet.FilmsAppearedIn = filmsAppearedIn
+		fields = append(fields, "filmsAppearedIn")
+	}
+
+	if err := repo.UpdatePlanet(planet, fields); err != nil {
+		return nil, err
+	}
+	planetNamesChanged(planet)
+	// as rotas medidas do planeta foram recalculadas com a nova localizacao
+	for _, field := range fields {
+		if field == "location" {
+			hyperspace.Invalidate()
+		}
+	}
+
+	return repo.GetPlanetByID(oid)
 }
 
 func deletePlanetHandler(w http.ResponseWriter, r *http.Request) *common.Error {
@@ -135,7 +254,7 @@ func deletePlanetHandler(w http.ResponseWriter, r *http.Request) *common.Error {
 		return err
 	}
 
-	if err := repo.DeletePlanet(*oid); err != nil {
+	if err := deletePlanet(*oid); err != nil {
 		return err
 	}
 
@@ -150,34 +269,186 @@ func deletePlanetHandler(w http.ResponseWriter, r *http.Request) *common.Error {
 	return nil
 }
 
-func extractPlanet(planet *PlanetRequestBody, r *http.Request) *common.Error {
-	err := json.NewDecoder(r.Body).Decode(planet)
-
-	if err != nil {
-		return common.CreateGenericBadRequestError(err)
+func deletePlanet(oid primitive.ObjectID) *common.Error {
+	if err := repo.DeletePlanet(oid); err != nil {
+		return err
 	}
+	// as rotas do planeta removido tambem foram removidas
+	hyperspace.Invalidate()
+	planetRemoved(oid)
 
 	return nil
 }
 
+func extractPlanet(planet *PlanetRequestBody, w http.ResponseWriter, r *http.Request) *common.Error {
+	return extractBody(planet, w, r)
+}
+
 func validatePlanet(planet *PlanetRequestBody) *common.Error {
+	return checkPlanetRequestBody(planet, true)
+}
+
+// valida apenas os campos presentes no corpo
+func validatePlanetPatch(planet *PlanetRequestBody) *common.Error {
+	return checkPlanetRequestBody(planet, false)
+}
+
+func checkPlanetRequestBody(planet *PlanetRequestBody, required bool) *common.Error {
 	errors := map[string]string{}
 
-	if planet.Name == nil || *planet.Name == "" {
+	if (planet.Name == nil && required) || (planet.Name != nil && *planet.Name == "") {
 		errors["name"] = "Name field is empty or missing."
 	}
 
-	if planet.Climate == nil || *planet.Climate == "" {
+	if (planet.Climate == nil && required) || (planet.Climate != nil && *planet.Climate == "") {
 		errors["climate"] = "Climate field is empty or missing."
 	}
 
-	if planet.Terrain == nil || *planet.Terrain == "" {
+	if (planet.Terrain == nil && required) || (planet.Terrain != nil && *planet.Terrain == "") {
 		errors["terrain"] = "Terrain field is empty or missing."
 	}
 
+	for i, alias := range planet.Aliases {
+		if strings.TrimSpace(alias) == "" {
+			errors["aliases"] = fmt.Sprintf("Alias at position %d is empty.", i)
+			break
+		}
+	}
+
+	if names, err := normalizeLocalizedNames(planet.Names); err != "" {
+		errors["names"] = err
+	} else {
+		planet.Names = names
+	}
+
+	if planet.Description != nil && len([]rune(*planet.Description)) > maxDescriptionLength {
+		errors["description"] = fmt.Sprintf("Description must be at most %d characters long.", maxDescriptionLength)
+	}
+
+	if planet.Language != nil && *planet.Language != "" && !containsString(repo.TextSearchLanguages, *planet.Language) {
+		errors["language"] = fmt.Sprintf("Language must be one of %s.", strings.Join(repo.TextSearchLanguages, ", "))
+	}
+
+	validateLocation(planet, errors)
+	validateTags(planet, errors)
+	validateMetadata(planet, errors)
+
+	if planet.System != nil && *planet.System != "" {
+		if _, err := primitive.ObjectIDFromHex(*planet.System); err != nil {
+			errors["systemId"] = "System id is not valid."
+		}
+	}
+
 	if len(errors) == 0 {
 		return nil
 	} else {
 		return common.CreateFormError(errors)
 	}
 }
+
+func (b *PlanetRequestBody) namesChanged() bool {
+	return b.Name != nil || b.Aliases != nil || b.Names != nil
+}
+
+// campos do documento alterados pelo corpo, os unicos gravados em uma atualizacao
+func (b *PlanetRequestBody) fields() []string {
+	fields := []string{}
+	present := []struct {
+		field   string
+		present bool
+	}{
+		{"name", b.Name != nil},
+		{"aliases", b.Aliases != nil},
+		{"names", b.Names != nil},
+		{"climate", b.Climate != nil},
+		{"terrain", b.Terrain != nil},
+		{"systemId", b.System != nil},
+		{"description", b.Description != nil},
+		{"language", b.Language != nil},
+		{"location", b.Location != nil || b.Grid != nil},
+		{"tags", b.Tags != nil},
+		{"metadata", b.Metadata != nil},
+	}
+
+	for _, p := range present {
+		if p.present {
+			fields = append(fields, p.field)
+		}
+	}
+
+	return fields
+}
+
+// copia os campos presentes no corpo para o planeta
+func applyPlanetRequestBody(planet *repo.Planet, requestBody *PlanetRequestBody) {
+	if requestBody.Name != nil {
+		planet.Name = *requestBody.Name
+	}
+
+	if requestBody.Aliases != nil {
+		planet.Aliases = requestBody.Aliases
+	}
+
+	if requestBody.Names != nil {
+		planet.Names = requestBody.Names
+	}
+
+	if requestBody.Climate != nil {
+		planet.Climate = *requestBody.Climate
+	}
+
+	if requestBody.Terrain != nil {
+		planet.Terrain = *requestBody.Terrain
+	}
+
+	if requestBody.System != nil {
+		if *requestBody.System == "" {
+			planet.SystemID = nil
+		} else {
+			oid, _ := primitive.ObjectIDFromHex(*requestBody.System)
+			planet.SystemID = &oid
+		}
+	}
+
+	if requestBody.Description != nil {
+		planet.Description = *requestBody.Description
+	}
+
+	if requestBody.Language != nil {
+		planet.Language = *requestBody.Language
+	}
+
+	if requestBody.Tags != nil {
+		planet.Tags = requestBody.Tags
+	}
+
+	if requestBody.Metadata != nil {
+		planet.Metadata = requestBody.Metadata
+	}
+
+	applyLocation(planet, requestBody)
+}
+
+// avisa o cliente quando o filtro nao pode usar nenhum indice e percorre a colecao inteira
+func warnUnindexedFilter(filter repo.PlanetFilter, w http.ResponseWriter) {
+	if fields := filter.UnindexedFields(); len(fields) > 0 {
+		w.Header().Set("Warning", fmt.Sprintf(`299 - "The filter on %s is not covered by an index and may be slow."`, strings.Join(fields, ", ")))
+	}
+}
+
+// mantem os indices de nomes em memoria, da busca aproximada e do autocompletar, em dia com o banco
+func planetNamesChanged(planet *repo.Planet) {
+	fuzzy.Update(planet)
+	autocomplete.Update(planet)
+}
+
+func planetRemoved(id primitive.ObjectID) {
+	fuzzy.Remove(id)
+	autocomplete.Remove(id)
+}
+
+// descarta os indices depois de alteracoes em lote; sao recarregados na proxima consulta
+func planetsReloaded() {
+	fuzzy.Invalidate()
+	autocomplete.Invalidate()
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+const (
+	maxTextQueryLength = 200
+	defaultTextLimit   = 20
+	maxTextLimit       = 100
+
+	// trechos da descricao: caracteres ao redor de cada termo e quantidade maxima por campo
+	snippetContext = 60
+	maxSnippets    = 3
+)
+
+type TextSearchHit struct {
+	Planet     *repo.Planet        `json:"planet"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// termos positivos da consulta; frases ficam com as palavras em ordem
+type textQuery struct {
+	phrases [][]string
+	terms   []string
+}
+
+func searchPlanetsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	errors := map[string]string{}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	language := defaultString(r.URL.Query().Get("lang"), "en")
+	limit := parseIntQuery("limit", r, defaultTextLimit, maxTextLimit, errors)
+
+	results, err := textSearchPlanets(q, language, limit, errors)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		localizePlanet(result.Planet, r)
+	}
+
+	respond(map[string]interface{}{"message": "The planets were successfully retrieved.", "results": results}, http.StatusOK, w)
+	return nil
+}
+
+// valida a consulta e busca os planetas com os trechos destacados; errors pode trazer erros
+// de outros parametros. usado tambem pelo gRPC
+func textSearchPlanets(q string, language string, limit int, errors map[string]string) ([]*TextSearchHit, *common.Error) {
+	query := parseTextQuery(q)
+	switch {
+	case q == "":
+		errors["q"] = "The search query is empty or missing."
+	case len([]rune(q)) > maxTextQueryLength:
+		errors["q"] = fmt.Sprintf("The search query must be at most %d characters long.", maxTextQueryLength)
+	case len(query.terms) == 0 && len(query.phrases) == 0:
+		errors["q"] = "The search query must have at least one term that is not negated."
+	}
+
+	if !containsString(repo.TextSearchLanguages, language) {
+		errors["lang"] = fmt.Sprintf("Language must be one of %s.", strings.Join(repo.TextSearchLanguages, ", "))
+	}
+
+	if len(errors) > 0 {
+		return nil, common.CreateFormError(errors)
+	}
+
+	hits, err := repo.SearchPlanetsText(q, language, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*TextSearchHit, len(hits))
+	for i, hit := range hits {
+		results[i] = &TextSearchHit{Planet: hit.Planet, Score: hit.Score, Highlights: highlightPlanet(hit.Planet, query)}
+	}
+
+	return results, nil
+}
+
+// separa frases entre aspas e termos, ignorando os negados com "-", que nao aparecem nos resultados
+func parseTextQuery(q string) textQuery {
+	query := textQuery{}
+
+	for i, part := range strings.Split(q, `"`) {
+		// as partes impares estao entre aspas
+		if i%2 == 1 {
+			if words := textWords(part); len(words) > 0 {
+				query.phrases = append(query.phrases, wordTexts(part, words))
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			if strings.HasPrefix(field, "-") {
+				continue
+			}
+			query.terms = append(query.terms, wordTexts(field, textWords(field))...)
+		}
+	}
+
+	return query
+}
+
+// posicoes [inicio, fim) das palavras do texto
+func textWords(text string) [][2]int {
+	words := [][2]int{}
+	start := -1
+
+	for i, c := range text {
+		isWord := unicode.IsLetter(c) || unicode.IsDigit(c)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			words = append(words, [2]int{start, i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, [2]int{start, len(text)})
+	}
+
+	return words
+}
+
+func wordTexts(text string, words [][2]int) []string {
+	texts := make([]string, len(words))
+	for i, word := range words {
+		texts[i] = strings.ToLower(text[word[0]:word[1]])
+	}
+
+	return texts
+}
+
+// aproximacao do radical usado pelo indice: as palavras batem quando compartilham um prefixo
+// de pelo menos quatro letras que cobre quase toda a menor delas (desert e deserts, arid e aridity)
+func wordsMatch(a string, b string) bool {
+	if a == b {
+		return true
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	shorter := len(ra)
+	if len(rb) < shorter {
+		shorter = len(rb)
+	}
+
+	prefix := 0
+	for prefix < shorter && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+
+	required := shorter - 2
+	if required < 4 {
+		required = 4
+	}
+
+	return prefix >= required
+}
+
+// trechos com os termos marcados em <em>, por campo
+func highlightPlanet(planet *repo.Planet, query textQuery) map[string][]string {
+	highlights := map[string][]string{}
+
+	fields := []struct {
+		name   string
+		values []string
+	}{
+		{"name", []string{planet.Name}},
+		{"aliases", planet.Aliases},
+		{"climate", []string{planet.Climate}},
+		{"terrain", []string{planet.Terrain}},
+		{"description", []string{planet.Description}},
+	}
+
+	for _, field := range fields {
+		for _, value := range field.values {
+			if snippets := highlightText(value, query); len(snippets) > 0 {
+				highlights[field.name] = append(highlights[field.name], snippets...)
+			}
+		}
+	}
+
+	return highlights
+}
+
+func highlightText(text string, query textQuery) []string {
+	words := textWords(text)
+	texts := wordTexts(text, words)
+	matched := make([]bool, len(words))
+
+	for i := range texts {
+		for _, term := range query.terms {
+			if wordsMatch(texts[i], term) {
+				matched[i] = true
+			}
+		}
+
+		for _, phrase := range query.phrases {
+			if i+len(phrase) > len(texts) {
+				continue
+			}
+
+			found := true
+			for j, word := range phrase {
+				found = found && wordsMatch(texts[i+j], word)
+			}
+			for j := 0; found && j < len(phrase); j++ {
+				matched[i+j] = true
+			}
+		}
+	}
+
+	ranges := [][2]int{}
+	for i, word := range words {
+		if !matched[i] {
+			continue
+		}
+
+		// palavras vizinhas marcadas, como as de uma frase, ficam no mesmo <em>
+		if n := len(ranges); n > 0 && strings.TrimSpace(text[ranges[n-1][1]:word[0]]) == "" {
+			ranges[n-1][1] = word[1]
+		} else {
+			ranges = append(ranges, word)
+		}
+	}
+
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	if len([]rune(text)) <= 2*snippetContext {
+		return []string{markText(text, 0, len(text), ranges)}
+	}
+
+	return snippets(text, ranges)
+}
+
+// janelas ao redor dos termos em textos longos; janelas que se sobrepoem sao unidas
+func snippets(text string, ranges [][2]int) []string {
+	windows := [][2]int{}
+	for _, r := range ranges {
+		start, end := wordBoundary(text, r[0]-snippetContext, -1), wordBoundary(text, r[1]+snippetContext, 1)
+		if n := len(windows); n > 0 && start <= windows[n-1][1] {
+			windows[n-1][1] = end
+		} else {
+			windows = append(windows, [2]int{start, end})
+		}
+	}
+
+	if len(windows) > maxSnippets {
+		windows = windows[:maxSnippets]
+	}
+
+	result := make([]string, len(windows))
+	for i, window := range windows {
+		snippet := markText(text, window[0], window[1], ranges)
+		if window[0] > 0 {
+			snippet = "…" + snippet
+		}
+		if window[1] < len(text) {
+			snippet += "…"
+		}
+		result[i] = snippet
+	}
+
+	return result
+}
+
+// posicao valida mais proxima, recuando ou avancando ate um espaco para nao cortar palavras
+func wordBoundary(text string, i int, direction int) int {
+	if i <= 0 {
+		return 0
+	}
+	if i >= len(text) {
+		return len(text)
+	}
+
+	for i > 0 && i < len(text) && text[i] != ' ' {
+		i += direction
+	}
+
+	return i
+}
+
+// o texto entre start e end escapado, com os trechos marcados em <em>
+func markText(text string, start int, end int, ranges [][2]int) string {
+	b := strings.Builder{}
+	position := start
+
+	for _, r := range ranges {
+		if r[1] <= start || r[0] >= end {
+			continue
+		}
+
+		b.WriteString(html.EscapeString(text[position:r[0]]))
+		b.WriteString("<em>" + html.EscapeString(text[r[0]:r[1]]) + "</em>")
+		position = r[1]
+	}
+
+	b.WriteString(html.EscapeString(text[position:end]))
+	return strings.TrimSpace(b.String())
+}
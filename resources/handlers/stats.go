@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+const (
+	defaultStatsTop = 10
+	maxStatsTop     = 100
+)
+
+// estatisticas dos planetas; aceita os mesmos filtros da listagem
+func getPlanetStatsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	errors := map[string]string{}
+	top := parseIntQuery("top", r, defaultStatsTop, maxStatsTop, errors)
+	if len(errors) > 0 {
+		return common.CreateFormError(errors)
+	}
+
+	filter, err := extractPlanetFilter(r)
+	if err != nil {
+		return err
+	}
+
+	stats, err := repo.GetPlanetStats(filter, top)
+	if err != nil {
+		return err
+	}
+	warnUnindexedFilter(filter, w)
+
+	respond(
+		map[string]interface{}{
+			"message": "The statistics were successfully retrieved.",
+			"stats":   stats,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
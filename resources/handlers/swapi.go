@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+)
+
+// consultas simultaneas a SWAPI ao carregar filmes e residentes
+const swapiConcurrency = 8
+
+type Film struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	EpisodeID   int    `json:"episodeId"`
+	Director    string `json:"director"`
+	ReleaseDate string `json:"releaseDate"`
+}
+
+type Resident struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	BirthYear string `json:"birthYear"`
+	Gender    string `json:"gender"`
+}
+
+type swapiFilm struct {
+	Title       string `json:"title"`
+	EpisodeID   int    `json:"episode_id"`
+	Director    string `json:"director"`
+	ReleaseDate string `json:"release_date"`
+}
+
+type swapiPerson struct {
+	Name      string `json:"name"`
+	BirthYear string `json:"birth_year"`
+	Gender    string `json:"gender"`
+}
+
+// filmes em que o planeta aparece, pela correspondencia de nomes com a SWAPI
+func getPlanetFilms(planet *repo.Planet) ([]*Film, *common.Error) {
+	swapiPlanet, err := getSWAPIPlanet(planet.AllNames())
+	if err != nil || swapiPlanet == nil {
+		return []*Film{}, err
+	}
+
+	films := make([]*Film, len(swapiPlanet.Films))
+	err = fetchSWAPIResources(swapiPlanet.Films, func(i int, resourceURL string) *common.Error {
+		var err *common.Error
+		films[i], err = getSWAPIFilm(resourceURL)
+		return err
+	})
+
+	return films, err
+}
+
+func getPlanetResidents(planet *repo.Planet) ([]*Resident, *common.Error) {
+	swapiPlanet, err := getSWAPIPlanet(planet.AllNames())
+	if err != nil || swapiPlanet == nil {
+		return []*Resident{}, err
+	}
+
+	residents := make([]*Resident, len(swapiPlanet.Residents))
+	err = fetchSWAPIResources(swapiPlanet.Residents, func(i int, resourceURL string) *common.Error {
+		var err *common.Error
+		residents[i], err = getSWAPIResident(resourceURL)
+		return err
+	})
+
+	return residents, err
+}
+
+func getSWAPIFilm(resourceURL string) (*Film, *common.Error) {
+	film := swapiFilm{}
+	if err := getSWAPIResource(resourceURL, &film); err != nil {
+		return nil, err
+	}
+
+	return &Film{ID: swapiID(resourceURL), Title: film.Title, EpisodeID: film.EpisodeID, Director: film.Director, ReleaseDate: film.ReleaseDate}, nil
+}
+
+func getSWAPIResident(resourceURL string) (*Resident, *common.Error) {
+	person := swapiPerson{}
+	if err := getSWAPIResource(resourceURL, &person); err != nil {
+		return nil, err
+	}
+
+	return &Resident{ID: swapiID(resourceURL), Name: person.Name, BirthYear: person.BirthYear, Gender: person.Gender}, nil
+}
+
+// executa fn para cada url com concorrencia limitada e retorna o primeiro erro
+func fetchSWAPIResources(urls []string, fn func(i int, resourceURL string) *common.Error) *common.Error {
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, swapiConcurrency)
+	errs := make([]*common.Error, len(urls))
+
+	for i, resourceURL := range urls {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, resourceURL string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			errs[i] = fn(i, resourceURL)
+		}(i, resourceURL)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getSWAPIResource(resourceURL string, v interface{}) *common.Error {
+	// as urls vem da propria SWAPI; qualquer outro host e ignorado
+	if parsed, err := url.Parse(resourceURL); err != nil || parsed.Host != "swapi.dev" {
+		return common.CreateGenericInternalError(fmt.Errorf("unexpected SWAPI url '%s'", resourceURL))
+	}
+
+	resp, err := http.Get(resourceURL)
+	if err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return common.CreateFailedDependencyError(fmt.Sprintf("SWAPI answered %d for %s.", resp.StatusCode, resourceURL))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
+// ".../api/films/1/" -> "1"
+func swapiID(resourceURL string) string {
+	parts := strings.Split(strings.TrimSuffix(resourceURL, "/"), "/")
+	return parts[len(parts)-1]
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxTags             = repo.MaxTags
+	maxMetadataEntries  = 50
+	maxMetadataValueLen = 1000
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func initializeTag(r *mux.Router) {
+	r.Handle("/tags", appHandler(getTagsHandler)).Methods("GET")
+}
+
+func addPlanetTagHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	return changePlanetTag(w, r, repo.AddPlanetTag, "The tag was successfully added.")
+}
+
+func removePlanetTagHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	return changePlanetTag(w, r, repo.RemovePlanetTag, "The tag was successfully removed.")
+}
+
+func changePlanetTag(w http.ResponseWriter, r *http.Request, change func(primitive.ObjectID, string) *common.Error, message string) *common.Error {
+	oid, err := extractObjectID("id", r)
+	if err != nil {
+		return err
+	}
+
+	param, _ := extractParam("tag", r)
+	tag, ok := normalizeTag(param)
+	if !ok {
+		return common.CreateBadRequestError(fmt.Sprintf("'%s' is not a valid tag.", param))
+	}
+
+	if err := change(*oid, tag); err != nil {
+		return err
+	}
+
+	planet, err := repo.GetPlanetByID(*oid)
+	if err != nil {
+		return err
+	}
+	localizePlanet(planet, r)
+
+	respond(
+		map[string]interface{}{
+			"message": message,
+			"planet":  planet,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func getTagsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	tags, err := repo.GetTagUsage()
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The tags were successfully retrieved.",
+			"tags":    tags,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+// filtros de listagem: ?search=, ?tag=a&tag=b e ?tagMatch=any|all
+func extractPlanetFilter(r *http.Request) (repo.PlanetFilter, *common.Error) {
+	query := r.URL.Query()
+	filter := repo.PlanetFilter{}
+
+	filter.Search = query.Get("search")
+	filter.Match = query.Get("match")
+	if err := repo.CheckSearch(filter.Search, filter.Match); err != nil {
+		return filter, err
+	}
+
+	// expressoes regulares podem ser caras e ficam restritas aos administradores
+	if filter.Match == repo.SearchRegex {
+		if err := checkAdmin(r); err != nil {
+			return filter, err
+		}
+	}
+
+	for _, tag := range query["tag"] {
+		normalized, ok := normalizeTag(tag)
+		if !ok {
+			return filter, common.CreateFormError(map[string]string{"tag": fmt.Sprintf("'%s' is not a valid tag.", tag)})
+		}
+		filter.Tags = appendUnique(filter.Tags, normalized)
+	}
+
+	switch query.Get("tagMatch") {
+	case "", "any":
+	case "all":
+		filter.AllTags = true
+	default:
+		return filter, common.CreateFormError(map[string]string{"tagMatch": "Tag match must be either 'any' or 'all'."})
+	}
+
+	conditions, err := repo.ParsePlanetConditions(query)
+	if err != nil {
+		return filter, err
+	}
+	filter.Conditions = conditions
+
+	if filter.Match == repo.SearchFuzzy && filter.Search != "" {
+		if filter.IDs, err = fuzzyPlanetIDs(filter.Search); err != nil {
+			return filter, err
+		}
+	}
+
+	projection, err := extractPlanetProjection(r)
+	if err != nil {
+		return filter, err
+	}
+	filter.Projection = projection
+
+	return filter, nil
+}
+
+// filtro da listagem recebido fora da query string, pelo GraphQL ou pelo gRPC
+type planetFilterParams struct {
+	Search     string
+	Match      string
+	Tags       []string
+	AllTags    bool
+	Conditions []planetConditionInput
+}
+
+type planetConditionInput struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// as mesmas validacoes de extractPlanetFilter; authorization e o valor do header Authorization,
+// exigido nas buscas por expressao regular
+func newPlanetFilter(params planetFilterParams, authorization string) (repo.PlanetFilter, *common.Error) {
+	filter := repo.PlanetFilter{Search: params.Search, Match: params.Match, AllTags: params.AllTags}
+	if err := repo.CheckSearch(filter.Search, filter.Match); err != nil {
+		return filter, err
+	}
+
+	if filter.Match == repo.SearchRegex {
+		if err := checkAdminAuthorization(authorization); err != nil {
+			return filter, err
+		}
+	}
+
+	for _, tag := range params.Tags {
+		normalized, ok := normalizeTag(tag)
+		if !ok {
+			return filter, common.CreateFormError(map[string]string{"tags": fmt.Sprintf("'%s' is not a valid tag.", tag)})
+		}
+		filter.Tags = appendUnique(filter.Tags, normalized)
+	}
+
+	errors := map[string]string{}
+	for i, c := range params.Conditions {
+		condition, err := repo.NewPlanetCondition(c.Field, c.Operator, c.Value)
+		if err != "" {
+			errors[fmt.Sprintf("conditions[%d]", i)] = err
+			continue
+		}
+		filter.Conditions = append(filter.Conditions, *condition)
+	}
+
+	if len(errors) > 0 {
+		return filter, common.CreateFormError(errors)
+	}
+
+	if filter.Match == repo.SearchFuzzy && filter.Search != "" {
+		ids, err := fuzzyPlanetIDs(filter.Search)
+		if err != nil {
+			return filter, err
+		}
+		filter.IDs = ids
+	}
+
+	return filter, nil
+}
+
+func normalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return tag, tagPattern.MatchString(tag)
+}
+
+func validateTags(planet *PlanetRequestBody, errors map[string]string) {
+	if planet.Tags == nil {
+		return
+	}
+
+	if len(planet.Tags) > maxTags {
+		errors["tags"] = fmt.Sprintf("A planet can have at most %d tags.", maxTags)
+		return
+	}
+
+	tags := make([]string, 0, len(planet.Tags))
+	for _, tag := range planet.Tags {
+		normalized, ok := normalizeTag(tag)
+		if !ok {
+			errors["tags"] = fmt.Sprintf("'%s' is not a valid tag. Use lowercase letters, digits, '-' and '_'.", tag)
+			return
+		}
+		tags = appendUnique(tags, normalized)
+	}
+
+	planet.Tags = tags
+}
+
+func validateMetadata(planet *PlanetRequestBody, errors map[string]string) {
+	if len(planet.Metadata) > maxMetadataEntries {
+		errors["metadata"] = fmt.Sprintf("Metadata can have at most %d entries.", maxMetadataEntries)
+		return
+	}
+
+	for key, value := range planet.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			errors["metadata"] = fmt.Sprintf("'%s' is not a valid metadata key. Use letters, digits, '-' and '_'.", key)
+			return
+		}
+
+		if len(value) > maxMetadataValueLen {
+			errors["metadata"] = fmt.Sprintf("Metadata value for '%s' is longer than %d characters.", key, maxMetadataValueLen)
+			return
+		}
+	}
+}
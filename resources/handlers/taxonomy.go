@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+)
+
+const (
+	TaxonomyModeStrict  = "strict"
+	TaxonomyModeLenient = "lenient"
+)
+
+var taxonomyMode = TaxonomyModeLenient
+
+type TaxonomyTermRequestBody struct {
+	Term     *string  `json:"term"`
+	Synonyms []string `json:"synonyms"`
+}
+
+func initializeTaxonomy(r *mux.Router) {
+	sr := r.PathPrefix("/taxonomy/{kind:climate|terrain}").Subrouter()
+	sr.Handle("", appHandler(getTaxonomyTermsHandler)).Methods("GET")
+	sr.Handle("", adminOnly(createTaxonomyTermHandler)).Methods("POST")
+	sr.Handle("/{term}", adminOnly(updateTaxonomyTermHandler)).Methods("PUT")
+	sr.Handle("/{term}", adminOnly(deleteTaxonomyTermHandler)).Methods("DELETE")
+}
+
+func getTaxonomyTermsHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	kind, _ := extractParam("kind", r)
+
+	terms, err := repo.GetTaxonomyTerms(kind)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The terms were successfully retrieved.",
+			"terms":   terms,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func createTaxonomyTermHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	kind, _ := extractParam("kind", r)
+	requestBody := TaxonomyTermRequestBody{}
+
+	if err := extractBody(&requestBody, w, r); err != nil {
+		return err
+	}
+
+	if requestBody.Term == nil || strings.TrimSpace(*requestBody.Term) == "" {
+		return common.CreateFormError(map[string]string{"term": "Term field is empty or missing."})
+	}
+
+	if _, err := repo.CreateTaxonomyTerm(kind, *requestBody.Term, requestBody.Synonyms); err != nil {
+		return err
+	}
+
+	term, err := repo.GetTaxonomyTerm(kind, *requestBody.Term)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The term was successfully created.",
+			"term":    term,
+		},
+		http.StatusCreated,
+		w,
+	)
+
+	return nil
+}
+
+func updateTaxonomyTermHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	kind, _ := extractParam("kind", r)
+	name, _ := extractParam("term", r)
+	requestBody := TaxonomyTermRequestBody{}
+
+	if err := extractBody(&requestBody, w, r); err != nil {
+		return err
+	}
+
+	if err := repo.UpdateTaxonomyTermSynonyms(kind, name, requestBody.Synonyms); err != nil {
+		return err
+	}
+
+	term, err := repo.GetTaxonomyTerm(kind, name)
+	if err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The term was successfully updated.",
+			"term":    term,
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+func deleteTaxonomyTermHandler(w http.ResponseWriter, r *http.Request) *common.Error {
+	kind, _ := extractParam("kind", r)
+	term, _ := extractParam("term", r)
+
+	if err := repo.DeleteTaxonomyTerm(kind, term); err != nil {
+		return err
+	}
+
+	respond(
+		map[string]interface{}{
+			"message": "The term was successfully deleted.",
+		},
+		http.StatusOK,
+		w,
+	)
+
+	return nil
+}
+
+// vocabularios carregados sob demanda, reaproveitados entre varios planetas
+type vocabularies map[string]*repo.Vocabulary
+
+func (v vocabularies) get(kind string) (*repo.Vocabulary, *common.Error) {
+	if vocabulary, ok := v[kind]; ok {
+		return vocabulary, nil
+	}
+
+	vocabulary, err := repo.GetVocabulary(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	v[kind] = vocabulary
+	return vocabulary, nil
+}
+
+// substitui climate e terrain pelos termos canonicos do vocabulario
+func canonicalizePlanet(planet *PlanetRequestBody) *common.Error {
+	return vocabularies{}.canonicalizePlanet(planet)
+}
+
+func (v vocabularies) canonicalizePlanet(planet *PlanetRequestBody) *common.Error {
+	errors := map[string]string{}
+
+	if err := v.canonicalizeTerms(repo.TaxonomyClimate, planet.Climate, errors); err != nil {
+		return err
+	}
+
+	if err := v.canonicalizeTerms(repo.TaxonomyTerrain, planet.Terrain, errors); err != nil {
+		return err
+	}
+
+	if len(errors) == 0 {
+		return nil
+	} else {
+		return common.CreateFormError(errors)
+	}
+}
+
+func (v vocabularies) canonicalizeTerms(kind string, value *string, errors map[string]string) *common.Error {
+	if value == nil {
+		return nil
+	}
+
+	vocabulary, err := v.get(kind)
+	if err != nil {
+		return err
+	}
+
+	// enquanto o vocabulario nao for cadastrado, qualquer valor e aceito
+	if vocabulary.Empty() {
+		return nil
+	}
+
+	terms := []string{}
+	rejected := []string{}
+
+	for _, term := range utils.SplitTerms(*value) {
+		if canonical, ok := vocabulary.Canonical(term); ok {
+			terms = appendUnique(terms, canonical)
+		} else if taxonomyMode == TaxonomyModeStrict {
+			rejected = append(rejected, describeRejectedTerm(term, vocabulary))
+		} else {
+			terms = appendUnique(terms, term)
+		}
+	}
+
+	if len(rejected) > 0 {
+		errors[kind] = fmt.Sprintf("Unknown %s term(s): %s.", kind, strings.Join(rejected, "; "))
+		return nil
+	}
+
+	*value = strings.Join(terms, ", ")
+	return nil
+}
+
+func describeRejectedTerm(term string, vocabulary *repo.Vocabulary) string {
+	suggestions := vocabulary.Suggest(term, 2)
+	if len(suggestions) == 0 {
+		return fmt.Sprintf("'%s'", term)
+	}
+
+	return fmt.Sprintf("'%s' (did you mean %s?)", term, strings.Join(suggestions, ", "))
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
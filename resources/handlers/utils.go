@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -12,8 +15,9 @@ import (
 )
 
 type SWAPIPlanet struct {
-	Name  string   `json:"name"`
-	Films []string `json:"films"`
+	Name      string   `json:"name"`
+	Films     []string `json:"films"`
+	Residents []string `json:"residents"`
 }
 
 type SWAPISearchResult struct {
@@ -23,14 +27,55 @@ type SWAPISearchResult struct {
 type appHandler func(http.ResponseWriter, *http.Request) *common.Error
 
 func (fn appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if err := fn(w, r); err != nil {
-		respondWithError(*err, w)
+	serveAppHandler(fn, nil, w, r)
+}
+
+// handler que tambem escreve tipos fora dos formatos negociados
+type producingHandler struct {
+	handler    appHandler
+	mediaTypes []string
+}
+
+func producing(fn appHandler, mediaTypes ...string) http.Handler {
+	return producingHandler{handler: fn, mediaTypes: mediaTypes}
+}
+
+func (h producingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveAppHandler(h.handler, h.mediaTypes, w, r)
+}
+
+func serveAppHandler(fn appHandler, produces []string, w http.ResponseWriter, r *http.Request) {
+	rw := &responseWriter{ResponseWriter: w, request: r}
+
+	// rejeita antes de executar o handler, para nao gravar nada que o cliente nao pode receber
+	if err := checkAcceptable(r, produces); err != nil {
+		respondWithError(*err, rw)
+		return
+	}
+
+	if err := fn(rw, r); err != nil {
+		respondWithError(*err, rw)
 	}
 }
 
+// codifica data no formato negociado pelo header Accept; se o handler ja definiu o
+// Content-Type (GeoJSON, por exemplo), usa JSON
 func respond(data interface{}, statusCode int, w http.ResponseWriter) {
+	encoder := encoders[0]
+	if rw, ok := w.(*responseWriter); ok && w.Header().Get("Content-Type") == "" {
+		if negotiated := negotiateEncoder(rw.request); negotiated != nil {
+			encoder = negotiated
+		}
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", encoder.MediaType)
+	}
+
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(data)
+	if err := encoder.Encode(w, data); err != nil {
+		log.Printf("could not encode the response as %s: %s", encoder.MediaType, err)
+	}
 }
 
 func respondWithMessage(message string, statusCode int, w http.ResponseWriter) {
@@ -41,28 +86,53 @@ func respondWithError(err common.Error, w http.ResponseWriter) {
 	respond(err, err.Code, w)
 }
 
-func getFilmsAppearedIn(planetName string) (int, *common.Error) {
+// procura o planeta na SWAPI por cada um dos nomes ate encontrar uma correspondencia exata
+func getFilmsAppearedIn(planetNames []string) (int, *common.Error) {
+	planet, err := getSWAPIPlanet(planetNames)
+	if err != nil || planet == nil {
+		return 0, err
+	}
+
+	return len(planet.Films), nil
+}
+
+// o primeiro planeta da SWAPI com algum dos nomes; nil quando nenhum corresponde
+func getSWAPIPlanet(planetNames []string) (*SWAPIPlanet, *common.Error) {
+	for _, planetName := range planetNames {
+		planet, err := searchSWAPIPlanet(planetName)
+		if err != nil {
+			return nil, err
+		}
+
+		if planet != nil {
+			return planet, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func searchSWAPIPlanet(planetName string) (*SWAPIPlanet, *common.Error) {
 	planetName = strings.Trim(strings.ToLower(planetName), "\n\r ")
 
-	resp, err := http.Get("https://swapi.dev/api/planets?search=" + planetName)
+	resp, err := http.Get("https://swapi.dev/api/planets?search=" + url.QueryEscape(planetName))
 	if err != nil {
-		return 0, common.CreateGenericInternalError(err)
+		return nil, common.CreateGenericInternalError(err)
 	}
+	defer resp.Body.Close()
 
 	var result SWAPISearchResult
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, common.CreateGenericInternalError(err)
+		return nil, common.CreateGenericInternalError(err)
 	}
 
-	if resCount := len(result.Results); resCount > 0 {
-		for i := 0; i < resCount; i++ {
-			if strings.Trim(strings.ToLower(result.Results[i].Name), " ") == planetName {
-				return len(result.Results[i].Films), nil
-			}
+	for i := range result.Results {
+		if strings.Trim(strings.ToLower(result.Results[i].Name), " ") == planetName {
+			return &result.Results[i], nil
 		}
 	}
 
-	return 0, nil
+	return nil, nil
 }
 
 func stringToObjectID(id string) (*primitive.ObjectID, *common.Error) {
@@ -75,12 +145,27 @@ func stringToObjectID(id string) (*primitive.ObjectID, *common.Error) {
 	return &oid, nil
 }
 
+func extractObjectID(param string, r *http.Request) (*primitive.ObjectID, *common.Error) {
+	id, _ := extractParam(param, r)
+	return stringToObjectID(id)
+}
+
 func extractParam(param string, r *http.Request) (string, bool) {
 	value, ok := mux.Vars(r)[param]
 
 	return value, ok
 }
 
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
 func extractParamInt(param string, r *http.Request) (int, bool) {
 	if value, ok := extractParam(param, r); ok {
 		if value, err := strconv.Atoi(value); err == nil {
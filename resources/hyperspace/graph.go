@@ -0,0 +1,135 @@
+package hyperspace
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type edge struct {
+	to   primitive.ObjectID
+	lane *repo.Lane
+}
+
+// grafo nao direcionado das rotas do hiperespaco
+type Graph struct {
+	edges map[primitive.ObjectID][]edge
+}
+
+// parada de um caminho; a primeira parada nao possui rota
+type Hop struct {
+	PlanetID primitive.ObjectID
+	Lane     *repo.Lane
+}
+
+type Path struct {
+	Hops     []Hop
+	Distance float64
+}
+
+var (
+	mu      sync.Mutex
+	current *Graph
+)
+
+func NewGraph(lanes []*repo.Lane) *Graph {
+	g := Graph{edges: map[primitive.ObjectID][]edge{}}
+
+	for _, lane := range lanes {
+		g.edges[lane.From] = append(g.edges[lane.From], edge{to: lane.To, lane: lane})
+		g.edges[lane.To] = append(g.edges[lane.To], edge{to: lane.From, lane: lane})
+	}
+
+	return &g
+}
+
+// grafo em memoria, carregado do banco na primeira consulta apos uma alteracao
+func Current() (*Graph, *common.Error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		lanes, err := repo.GetAllLanes()
+		if err != nil {
+			return nil, err
+		}
+		current = NewGraph(lanes)
+	}
+
+	return current, nil
+}
+
+// descarta o grafo em memoria; deve ser chamado sempre que as rotas mudarem
+func Invalidate() {
+	mu.Lock()
+	current = nil
+	mu.Unlock()
+}
+
+// menor caminho entre dois planetas (Dijkstra)
+func (g *Graph) ShortestPath(from, to primitive.ObjectID) (*Path, bool) {
+	distances := map[primitive.ObjectID]float64{from: 0}
+	previous := map[primitive.ObjectID]edge{}
+	visited := map[primitive.ObjectID]bool{}
+	queue := &priorityQueue{{planetID: from, distance: 0}}
+
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(queueItem)
+		if visited[item.planetID] {
+			continue
+		}
+		visited[item.planetID] = true
+
+		if item.planetID == to {
+			return buildPath(from, to, previous, item.distance), true
+		}
+
+		for _, e := range g.edges[item.planetID] {
+			distance := item.distance + e.lane.Distance
+			if known, ok := distances[e.to]; !ok || distance < known {
+				distances[e.to] = distance
+				previous[e.to] = edge{to: item.planetID, lane: e.lane}
+				heap.Push(queue, queueItem{planetID: e.to, distance: distance})
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func buildPath(from, to primitive.ObjectID, previous map[primitive.ObjectID]edge, distance float64) *Path {
+	hops := []Hop{}
+
+	for planetID := to; planetID != from; planetID = previous[planetID].to {
+		hops = append(hops, Hop{PlanetID: planetID, Lane: previous[planetID].lane})
+	}
+	hops = append(hops, Hop{PlanetID: from})
+
+	// o caminho foi montado do destino para a origem
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+
+	return &Path{Hops: hops, Distance: distance}
+}
+
+type queueItem struct {
+	planetID primitive.ObjectID
+	distance float64
+}
+
+type priorityQueue []queueItem
+
+func (q priorityQueue) Len() int            { return len(q) }
+func (q priorityQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q priorityQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *priorityQueue) Push(x interface{}) { *q = append(*q, x.(queueItem)) }
+func (q *priorityQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
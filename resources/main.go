@@ -2,12 +2,26 @@ package resources
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/jvitoroc/b2w-star-wars/resources/autocomplete"
 	"github.com/jvitoroc/b2w-star-wars/resources/handlers"
 	"github.com/jvitoroc/b2w-star-wars/resources/repo"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func Initialize(r *mux.Router, db *mongo.Client, databaseName string) {
-	repo.Initialize(db, databaseName)
-	handlers.Initialize(r)
+// prepara o banco e as rotas; os repositorios ja devem ter sido inicializados e as migracoes
+// aplicadas, para que o validador, os indices e o autocompletar vejam os dados migrados
+func Initialize(r *mux.Router) error {
+	if err := repo.EnsurePlanetsValidator(); err != nil {
+		return err
+	}
+
+	if err := repo.CreateIndexes(); err != nil {
+		return err
+	}
+
+	// o autocompletar responde da memoria desde a primeira requisicao
+	if err := autocomplete.Load(); err != nil {
+		return err
+	}
+
+	return handlers.Initialize(r)
 }
@@ -0,0 +1,128 @@
+package memindex
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/resources/repo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// estrutura em memoria montada a partir dos planetas do banco
+type Index interface {
+	Update(planet *repo.Planet)
+	Remove(id primitive.ObjectID)
+}
+
+// guarda o indice atual: carrega do banco na primeira consulta, carrega de novo quando passa de
+// maxAge e aplica as alteracoes de planetas feitas por esta instancia
+type Holder struct {
+	name   string
+	maxAge time.Duration
+	load   func() (Index, *common.Error)
+	// recarrega em segundo plano, respondendo com o indice antigo enquanto isso
+	background bool
+
+	mu       sync.Mutex
+	current  Index
+	loadedAt time.Time
+	// incrementada por Invalidate; uma recarga iniciada antes dela e descartada
+	generation int
+	refreshing bool
+	// alteracoes feitas durante a recarga em segundo plano, aplicadas tambem no indice novo
+	pending []func(Index)
+}
+
+func NewHolder(name string, maxAge time.Duration, background bool, load func() (Index, *common.Error)) *Holder {
+	return &Holder{name: name, maxAge: maxAge, background: background, load: load}
+}
+
+// carrega o indice na hora, substituindo o atual
+func (h *Holder) Load() *common.Error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.loadLocked()
+}
+
+func (h *Holder) loadLocked() *common.Error {
+	ix, err := h.load()
+	if err != nil {
+		return err
+	}
+
+	h.current, h.loadedAt = ix, time.Now()
+	return nil
+}
+
+func (h *Holder) Current() (Index, *common.Error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stale := h.current != nil && time.Since(h.loadedAt) > h.maxAge
+	if h.current == nil || (stale && !h.background) {
+		if err := h.loadLocked(); err != nil {
+			return nil, err
+		}
+	} else if stale && !h.refreshing {
+		h.refreshing = true
+		go h.refresh(h.generation)
+	}
+
+	return h.current, nil
+}
+
+func (h *Holder) refresh(generation int) {
+	ix, err := h.load()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pending := h.pending
+	h.refreshing, h.pending = false, nil
+
+	if err != nil {
+		log.Printf("%s: could not reload the planet names: %s", h.name, err.Message)
+		return
+	} else if generation != h.generation {
+		return
+	}
+
+	// a leitura do banco pode ter acontecido antes dessas alteracoes
+	for _, change := range pending {
+		change(ix)
+	}
+	h.current, h.loadedAt = ix, time.Now()
+}
+
+// descarta o indice; a proxima consulta carrega de novo
+func (h *Holder) Invalidate() {
+	h.mu.Lock()
+	h.current = nil
+	h.generation++
+	h.mu.Unlock()
+}
+
+func (h *Holder) Update(planet *repo.Planet) {
+	h.apply(func(ix Index) { ix.Update(planet) })
+}
+
+func (h *Holder) Remove(id primitive.ObjectID) {
+	h.apply(func(ix Index) { ix.Remove(id) })
+}
+
+// aplica a alteracao no indice atual, se carregado, e a guarda enquanto houver uma recarga
+func (h *Holder) apply(change func(Index)) {
+	h.mu.Lock()
+	ix := h.current
+	if h.refreshing {
+		h.pending = append(h.pending, change)
+	}
+	h.mu.Unlock()
+
+	if ix != nil {
+		change(ix)
+	}
+}
@@ -0,0 +1,277 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package planetpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// PlanetServiceClient is the client API for PlanetService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PlanetServiceClient interface {
+	Create(ctx context.Context, in *CreatePlanetRequest, opts ...grpc.CallOption) (*Planet, error)
+	Get(ctx context.Context, in *GetPlanetRequest, opts ...grpc.CallOption) (*Planet, error)
+	// os planetas sao enviados conforme saem do banco, na ordem de criacao
+	List(ctx context.Context, in *ListPlanetsRequest, opts ...grpc.CallOption) (PlanetService_ListClient, error)
+	// busca textual, como GET /planet/search
+	Search(ctx context.Context, in *SearchPlanetsRequest, opts ...grpc.CallOption) (*SearchPlanetsResponse, error)
+	Delete(ctx context.Context, in *DeletePlanetRequest, opts ...grpc.CallOption) (*DeletePlanetResponse, error)
+}
+
+type planetServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPlanetServiceClient(cc grpc.ClientConnInterface) PlanetServiceClient {
+	return &planetServiceClient{cc}
+}
+
+func (c *planetServiceClient) Create(ctx context.Context, in *CreatePlanetRequest, opts ...grpc.CallOption) (*Planet, error) {
+	out := new(Planet)
+	err := c.cc.Invoke(ctx, "/planets.v1.PlanetService/Create", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planetServiceClient) Get(ctx context.Context, in *GetPlanetRequest, opts ...grpc.CallOption) (*Planet, error) {
+	out := new(Planet)
+	err := c.cc.Invoke(ctx, "/planets.v1.PlanetService/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planetServiceClient) List(ctx context.Context, in *ListPlanetsRequest, opts ...grpc.CallOption) (PlanetService_ListClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PlanetService_ServiceDesc.Streams[0], "/planets.v1.PlanetService/List", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &planetServiceListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PlanetService_ListClient interface {
+	Recv() (*Planet, error)
+	grpc.ClientStream
+}
+
+type planetServiceListClient struct {
+	grpc.ClientStream
+}
+
+func (x *planetServiceListClient) Recv() (*Planet, error) {
+	m := new(Planet)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *planetServiceClient) Search(ctx context.Context, in *SearchPlanetsRequest, opts ...grpc.CallOption) (*SearchPlanetsResponse, error) {
+	out := new(SearchPlanetsResponse)
+	err := c.cc.Invoke(ctx, "/planets.v1.PlanetService/Search", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planetServiceClient) Delete(ctx context.Context, in *DeletePlanetRequest, opts ...grpc.CallOption) (*DeletePlanetResponse, error) {
+	out := new(DeletePlanetResponse)
+	err := c.cc.Invoke(ctx, "/planets.v1.PlanetService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PlanetServiceServer is the server API for PlanetService service.
+// All implementations must embed UnimplementedPlanetServiceServer
+// for forward compatibility
+type PlanetServiceServer interface {
+	Create(context.Context, *CreatePlanetRequest) (*Planet, error)
+	Get(context.Context, *GetPlanetRequest) (*Planet, error)
+	// os planetas sao enviados conforme saem do banco, na ordem de criacao
+	List(*ListPlanetsRequest, PlanetService_ListServer) error
+	// busca textual, como GET /planet/search
+	Search(context.Context, *SearchPlanetsRequest) (*SearchPlanetsResponse, error)
+	Delete(context.Context, *DeletePlanetRequest) (*DeletePlanetResponse, error)
+	mustEmbedUnimplementedPlanetServiceServer()
+}
+
+// UnimplementedPlanetServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedPlanetServiceServer struct {
+}
+
+func (UnimplementedPlanetServiceServer) Create(context.Context, *CreatePlanetRequest) (*Planet, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedPlanetServiceServer) Get(context.Context, *GetPlanetRequest) (*Planet, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedPlanetServiceServer) List(*ListPlanetsRequest, PlanetService_ListServer) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedPlanetServiceServer) Search(context.Context, *SearchPlanetsRequest) (*SearchPlanetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedPlanetServiceServer) Delete(context.Context, *DeletePlanetRequest) (*DeletePlanetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedPlanetServiceServer) mustEmbedUnimplementedPlanetServiceServer() {}
+
+// UnsafePlanetServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PlanetServiceServer will
+// result in compilation errors.
+type UnsafePlanetServiceServer interface {
+	mustEmbedUnimplementedPlanetServiceServer()
+}
+
+func RegisterPlanetServiceServer(s grpc.ServiceRegistrar, srv PlanetServiceServer) {
+	s.RegisterService(&PlanetService_ServiceDesc, srv)
+}
+
+func _PlanetService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreatePlanetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanetServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/planets.v1.PlanetService/Create",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanetServiceServer).Create(ctx, req.(*CreatePlanetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanetService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlanetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanetServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/planets.v1.PlanetService/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanetServiceServer).Get(ctx, req.(*GetPlanetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanetService_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListPlanetsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PlanetServiceServer).List(m, &planetServiceListServer{stream})
+}
+
+type PlanetService_ListServer interface {
+	Send(*Planet) error
+	grpc.ServerStream
+}
+
+type planetServiceListServer struct {
+	grpc.ServerStream
+}
+
+func (x *planetServiceListServer) Send(m *Planet) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PlanetService_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchPlanetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanetServiceServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/planets.v1.PlanetService/Search",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanetServiceServer).Search(ctx, req.(*SearchPlanetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanetService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeletePlanetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanetServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/planets.v1.PlanetService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanetServiceServer).Delete(ctx, req.(*DeletePlanetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PlanetService_ServiceDesc is the grpc.ServiceDesc for PlanetService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PlanetService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "planets.v1.PlanetService",
+	HandlerType: (*PlanetServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _PlanetService_Create_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _PlanetService_Get_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _PlanetService_Search_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _PlanetService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "List",
+			Handler:       _PlanetService_List_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "planet.proto",
+}
@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"errors"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// insere os planetas com um unico InsertMany e retorna o erro de cada um (nil quando inserido);
+// no modo ordenado, nada e inserido apos o primeiro erro. O segundo retorno e a falha do write
+// concern: os planetas sem erro foram gravados, mas a confirmacao pedida nao veio
+func CreatePlanets(planets []*Planet, ordered bool) ([]*common.Error, *common.Error) {
+	errs := make([]*common.Error, len(planets))
+
+	if err := checkPlanetsSystems(planets, errs); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs, nil
+	}
+
+	if ordered {
+		common.SkipAfterFirstError(errs)
+	}
+
+	documents := []interface{}{}
+	indexes := []int{}
+	for i, planet := range planets {
+		if errs[i] == nil {
+			planet.ObjectID = primitive.NewObjectID()
+			planet.setSearchNames()
+			documents = append(documents, planet)
+			indexes = append(indexes, i)
+		}
+	}
+
+	if len(documents) == 0 {
+		return errs, nil
+	}
+
+	ctx, cancel := utils.WithTimeout(30)
+	defer cancel()
+	_, err := planetsCollection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(ordered))
+
+	var writeConcernErr *common.Error
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		if bulkErr.WriteConcernError != nil {
+			writeConcernErr = common.CreateGenericInternalError(errors.New(bulkErr.WriteConcernError.Message))
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			i := indexes[writeErr.Index]
+			if writeErr.Code == errDocumentValidationFailure {
+				errs[i] = planetValidationError(planets[i])
+			} else {
+				errs[i] = common.CreateGenericInternalError(errors.New(writeErr.Message))
+			}
+		}
+	} else if err != nil {
+		for _, i := range indexes {
+			errs[i] = common.CreateGenericInternalError(err)
+		}
+	}
+
+	if ordered {
+		common.SkipAfterFirstError(errs)
+	}
+
+	return errs, writeConcernErr
+}
+
+// marca os planetas com sistemas inexistentes; consulta todos os sistemas de uma vez
+func checkPlanetsSystems(planets []*Planet, errs []*common.Error) *common.Error {
+	ids := []primitive.ObjectID{}
+	for _, planet := range planets {
+		if planet.SystemID != nil {
+			ids = append(ids, *planet.SystemID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	existing, err := findDocumentIDs(systemsCollection, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return err
+	}
+
+	found := map[primitive.ObjectID]bool{}
+	for _, id := range existing {
+		found[id] = true
+	}
+
+	for i, planet := range planets {
+		if planet.SystemID != nil && !found[*planet.SystemID] {
+			errs[i] = common.CreateFormError(map[string]string{"systemId": "System not found under given id (" + planet.SystemID.Hex() + ")."})
+		}
+	}
+
+	return nil
+}
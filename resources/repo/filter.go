@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tempo maximo das consultas com expressoes regulares
+const regexMaxTime = 2 * time.Second
+
+// filtros aceitos pelas listagens de planetas
+type PlanetFilter struct {
+	// termo buscado no nome, nos apelidos e nos nomes localizados
+	Search string
+	// como o termo e comparado, SearchContains quando vazio; ver CheckSearch
+	Match string
+	Tags  []string
+	// exige todas as tags em vez de qualquer uma delas
+	AllTags bool
+	// condicoes da linguagem de filtros; ver ParsePlanetConditions
+	Conditions []PlanetCondition
+	// restringe aos planetas informados; nil nao restringe
+	IDs []primitive.ObjectID
+
+	// campos retornados; nil retorna os documentos inteiros
+	Projection *PlanetProjection
+
+	// paginacao pela ordem dos ids; Limit 0 retorna todos os planetas
+	Skip  int64
+	Limit int64
+}
+
+func (f *PlanetFilter) toBSON() bson.D {
+	filter := bson.D{}
+
+	// na busca aproximada os planetas encontrados chegam em IDs
+	if f.Search != "" && f.Match != SearchFuzzy {
+		filter = append(filter, searchToBSON(f.Search, f.Match))
+	}
+
+	if len(f.Tags) > 0 {
+		operator := "$in"
+		if f.AllTags {
+			operator = "$all"
+		}
+		filter = append(filter, bson.E{Key: "tags", Value: bson.D{{Key: operator, Value: f.Tags}}})
+	}
+
+	if f.IDs != nil {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$in", Value: f.IDs}}})
+	}
+
+	return combineFilters(filter, conditionsToBSON(f.Conditions))
+}
+
+// junta os filtros; campos repetidos, como tags nos dois filtros, exigem $and
+func combineFilters(filter bson.D, other bson.D) bson.D {
+	keys := map[string]bool{}
+	for _, e := range filter {
+		keys[e.Key] = true
+	}
+
+	duplicated := false
+	for _, e := range other {
+		duplicated = duplicated || keys[e.Key]
+	}
+
+	if !duplicated {
+		return append(filter, other...)
+	}
+
+	clauses := bson.A{}
+	for _, e := range append(filter, other...) {
+		clauses = append(clauses, bson.D{e})
+	}
+
+	return bson.D{{Key: "$and", Value: clauses}}
+}
+
+// campos filtrados sem indice quando nenhuma parte do filtro pode usar um indice
+func (f *PlanetFilter) UnindexedFields() []string {
+	indexedSearch := f.Search != "" && (f.Match == SearchPrefix || f.Match == SearchExact)
+	if len(f.Tags) > 0 || f.IDs != nil || indexedSearch {
+		return nil
+	}
+
+	fields := unindexedConditionFields(f.Conditions)
+	if len(f.Conditions) > 0 && len(fields) == 0 {
+		return nil
+	}
+
+	if f.Search != "" {
+		fields = appendField(fields, "name")
+	}
+
+	return fields
+}
+
+func (f *PlanetFilter) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if f.Projection != nil {
+		opts.SetProjection(f.Projection.toBSON())
+	}
+	// expressoes de administradores ainda podem ser lentas
+	if f.Search != "" && f.Match == SearchRegex {
+		opts.SetMaxTime(regexMaxTime)
+	}
+	if f.Skip > 0 || f.Limit > 0 {
+		opts.SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(f.Skip).SetLimit(f.Limit)
+	}
+
+	return opts
+}
+
+func (f *PlanetFilter) countOptions() *options.CountOptions {
+	opts := options.Count()
+	if f.Search != "" && f.Match == SearchRegex {
+		opts.SetMaxTime(regexMaxTime)
+	}
+
+	return opts
+}
@@ -0,0 +1,304 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// hierarquia da galaxia: regiao > setor > sistema > planeta
+
+type Region struct {
+	ObjectID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name     string             `json:"name" bson:"name"`
+	// marcado durante a remocao; impede que novos filhos sejam criados
+	Deleting bool `json:"-" bson:"deleting,omitempty"`
+}
+
+type Sector struct {
+	ObjectID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name     string             `json:"name" bson:"name"`
+	RegionID primitive.ObjectID `json:"regionId" bson:"regionId"`
+	Deleting bool               `json:"-" bson:"deleting,omitempty"`
+}
+
+type System struct {
+	ObjectID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name     string             `json:"name" bson:"name"`
+	SectorID primitive.ObjectID `json:"sectorId" bson:"sectorId"`
+	Deleting bool               `json:"-" bson:"deleting,omitempty"`
+}
+
+func CreateRegion(region *Region) (primitive.ObjectID, *common.Error) {
+	region.ObjectID = primitive.NilObjectID
+	region.Deleting = false
+	return insertDocument(regionsCollection, region)
+}
+
+func GetRegionByID(id primitive.ObjectID) (*Region, *common.Error) {
+	region := Region{}
+	if err := findDocumentByID(regionsCollection, id, &region, fmt.Sprintf("Region not found under given id (%s).", id)); err != nil {
+		return nil, err
+	}
+
+	return &region, nil
+}
+
+func GetAllRegions() ([]*Region, *common.Error) {
+	regions := make([]*Region, 0)
+	if err := findDocuments(regionsCollection, bson.D{}, &regions); err != nil {
+		return nil, err
+	}
+
+	return regions, nil
+}
+
+func DeleteRegion(id primitive.ObjectID) *common.Error {
+	return deleteParent(regionsCollection, id, fmt.Sprintf("Region not found under given id (%s).", id),
+		sectorsCollection, "regionId", "region", "sectors")
+}
+
+// regioes em remocao nao aceitam novos setores
+func checkSectorRegion(id primitive.ObjectID) *common.Error {
+	region, err := GetRegionByID(id)
+	if err != nil {
+		return err
+	}
+
+	if region.Deleting {
+		return common.CreateNotFoundError(fmt.Sprintf("Region is being deleted (%s).", id))
+	}
+
+	return nil
+}
+
+func CreateSector(sector *Sector) (primitive.ObjectID, *common.Error) {
+	sector.ObjectID = primitive.NilObjectID
+	sector.Deleting = false
+	return insertChild(sectorsCollection, sector, "regionId", func() *common.Error {
+		return checkSectorRegion(sector.RegionID)
+	})
+}
+
+func GetSectorByID(id primitive.ObjectID) (*Sector, *common.Error) {
+	sector := Sector{}
+	if err := findDocumentByID(sectorsCollection, id, &sector, fmt.Sprintf("Sector not found under given id (%s).", id)); err != nil {
+		return nil, err
+	}
+
+	return &sector, nil
+}
+
+func GetSectors(regionID *primitive.ObjectID) ([]*Sector, *common.Error) {
+	sectors := make([]*Sector, 0)
+	filter := bson.D{}
+	if regionID != nil {
+		filter = append(filter, bson.E{Key: "regionId", Value: *regionID})
+	}
+
+	if err := findDocuments(sectorsCollection, filter, &sectors); err != nil {
+		return nil, err
+	}
+
+	return sectors, nil
+}
+
+func DeleteSector(id primitive.ObjectID) *common.Error {
+	return deleteParent(sectorsCollection, id, fmt.Sprintf("Sector not found under given id (%s).", id),
+		systemsCollection, "sectorId", "sector", "systems")
+}
+
+// setores em remocao nao aceitam novos sistemas
+func checkSystemSector(id primitive.ObjectID) *common.Error {
+	sector, err := GetSectorByID(id)
+	if err != nil {
+		return err
+	}
+
+	if sector.Deleting {
+		return common.CreateNotFoundError(fmt.Sprintf("Sector is being deleted (%s).", id))
+	}
+
+	return nil
+}
+
+func CreateSystem(system *System) (primitive.ObjectID, *common.Error) {
+	system.ObjectID = primitive.NilObjectID
+	system.Deleting = false
+	return insertChild(systemsCollection, system, "sectorId", func() *common.Error {
+		return checkSystemSector(system.SectorID)
+	})
+}
+
+func GetSystemByID(id primitive.ObjectID) (*System, *common.Error) {
+	system := System{}
+	if err := findDocumentByID(systemsCollection, id, &system, fmt.Sprintf("System not found under given id (%s).", id)); err != nil {
+		return nil, err
+	}
+
+	return &system, nil
+}
+
+// sistemas indexados pelo id; ids inexistentes sao ignorados
+func GetSystemsByIDs(ids []primitive.ObjectID) (map[primitive.ObjectID]*System, *common.Error) {
+	systems := make([]*System, 0)
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if err := findDocuments(systemsCollection, filter, &systems); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]*System, len(systems))
+	for _, system := range systems {
+		byID[system.ObjectID] = system
+	}
+
+	return byID, nil
+}
+
+func GetSystems(sectorID *primitive.ObjectID) ([]*System, *common.Error) {
+	systems := make([]*System, 0)
+	filter := bson.D{}
+	if sectorID != nil {
+		filter = append(filter, bson.E{Key: "sectorId", Value: *sectorID})
+	}
+
+	if err := findDocuments(systemsCollection, filter, &systems); err != nil {
+		return nil, err
+	}
+
+	return systems, nil
+}
+
+func DeleteSystem(id primitive.ObjectID) *common.Error {
+	return deleteParent(systemsCollection, id, fmt.Sprintf("System not found under given id (%s).", id),
+		planetsCollection, "systemId", "system", "planets")
+}
+
+func GetPlanetsInSystem(id primitive.ObjectID) ([]*Planet, *common.Error) {
+	if _, err := GetSystemByID(id); err != nil {
+		return nil, err
+	}
+
+	return getPlanetsInSystems([]primitive.ObjectID{id})
+}
+
+func GetPlanetsInSector(id primitive.ObjectID) ([]*Planet, *common.Error) {
+	if _, err := GetSectorByID(id); err != nil {
+		return nil, err
+	}
+
+	systemIDs, err := findDocumentIDs(systemsCollection, bson.D{{Key: "sectorId", Value: id}})
+	if err != nil {
+		return nil, err
+	}
+
+	return getPlanetsInSystems(systemIDs)
+}
+
+func GetPlanetsInRegion(id primitive.ObjectID) ([]*Planet, *common.Error) {
+	if _, err := GetRegionByID(id); err != nil {
+		return nil, err
+	}
+
+	sectorIDs, err := findDocumentIDs(sectorsCollection, bson.D{{Key: "regionId", Value: id}})
+	if err != nil {
+		return nil, err
+	}
+
+	systemIDs, err := findDocumentIDs(systemsCollection, bson.D{{Key: "sectorId", Value: bson.D{{Key: "$in", Value: sectorIDs}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	return getPlanetsInSystems(systemIDs)
+}
+
+func getPlanetsInSystems(systemIDs []primitive.ObjectID) ([]*Planet, *common.Error) {
+	planets := make([]*Planet, 0)
+	if len(systemIDs) == 0 {
+		return planets, nil
+	}
+
+	filter := bson.D{{Key: "systemId", Value: bson.D{{Key: "$in", Value: systemIDs}}}}
+	if err := findDocuments(planetsCollection, filter, &planets); err != nil {
+		return nil, err
+	}
+
+	return planets, nil
+}
+
+// um pai nao pode ser removido enquanto possuir filhos. o pai e marcado antes da contagem,
+// assim um filho criado ao mesmo tempo falha na conferencia do pai (ver insertChild)
+func deleteParent(parents *mongo.Collection, id primitive.ObjectID, notFound string, children *mongo.Collection, field string, parent string, childrenName string) *common.Error {
+	if err := setDeleting(parents, id, true, notFound); err != nil {
+		return err
+	}
+
+	count, err := countDocuments(children, bson.D{{Key: field, Value: id}})
+	if err == nil && count > 0 {
+		err = common.CreateConflictError(fmt.Sprintf("The %s still has %d %s and cannot be deleted.", parent, count, childrenName))
+	}
+
+	if err != nil {
+		if unmarkErr := setDeleting(parents, id, false, notFound); unmarkErr != nil {
+			return unmarkErr
+		}
+		return err
+	}
+
+	return deleteDocumentByID(parents, id, notFound)
+}
+
+func setDeleting(collection *mongo.Collection, id primitive.ObjectID, deleting bool, notFound string) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "deleting", Value: ""}}}}
+	if deleting {
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "deleting", Value: true}}}}
+	}
+
+	res, err := collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update)
+	if err != nil {
+		return common.CreateGenericInternalError(err)
+	} else if res.MatchedCount == 0 {
+		return common.CreateNotFoundError(notFound)
+	}
+
+	return nil
+}
+
+// o pai e conferido antes e depois da insercao; se a remocao do pai comecou nesse meio tempo,
+// a contagem de deleteParent pode nao ter visto o filho, entao a insercao e desfeita
+func insertChild(children *mongo.Collection, child interface{}, field string, checkParent func() *common.Error) (primitive.ObjectID, *common.Error) {
+	if err := checkParent(); err != nil {
+		return primitive.ObjectID{}, referenceError(field, err)
+	}
+
+	id, err := insertDocument(children, child)
+	if err != nil {
+		return primitive.ObjectID{}, err
+	}
+
+	if err := checkParent(); err != nil {
+		if deleteErr := deleteDocumentByID(children, id, ""); deleteErr != nil {
+			return primitive.ObjectID{}, deleteErr
+		}
+		return primitive.ObjectID{}, referenceError(field, err)
+	}
+
+	return id, nil
+}
+
+// referencias inexistentes sao erros do formulario, nao do recurso solicitado
+func referenceError(field string, err *common.Error) *common.Error {
+	if err.Code == common.ENOTFOUND {
+		return common.CreateFormError(map[string]string{field: err.Message})
+	}
+
+	return err
+}
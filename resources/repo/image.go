@@ -0,0 +1,200 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ImageOriginal = "original"
+	ImageThumb    = "thumb"
+)
+
+// dados da imagem do planeta; os arquivos ficam no GridFS (bucket "images")
+type PlanetImage struct {
+	ContentType      string    `json:"contentType" bson:"contentType"`
+	ThumbContentType string    `json:"-" bson:"thumbContentType"`
+	Width            int       `json:"width" bson:"width"`
+	Height           int       `json:"height" bson:"height"`
+	Size             int64     `json:"size" bson:"size"`
+	Checksum         string    `json:"-" bson:"checksum"`
+	UpdatedAt        time.Time `json:"updatedAt" bson:"updatedAt"`
+	// cada envio grava arquivos novos; vazio nas imagens enviadas antes das versoes
+	Version string `json:"-" bson:"version,omitempty"`
+}
+
+type ImageFile struct {
+	Data        []byte
+	ContentType string
+}
+
+// substitui a imagem do planeta pelos arquivos informados; os arquivos novos sao gravados
+// antes da troca, entao uma falha no envio mantem a imagem anterior
+func SavePlanetImage(id primitive.ObjectID, image *PlanetImage, original ImageFile, thumb ImageFile) *common.Error {
+	if _, err := GetPlanetByID(id); err != nil {
+		return err
+	}
+
+	bucket, err := imagesBucket()
+	if err != nil {
+		return err
+	}
+
+	image.Version = primitive.NewObjectID().Hex()
+	for size, file := range map[string]ImageFile{ImageOriginal: original, ImageThumb: thumb} {
+		opts := options.GridFSUpload().SetMetadata(bson.D{
+			{Key: "planetId", Value: id},
+			{Key: "contentType", Value: file.ContentType},
+		})
+
+		fileID := imageFileID(id, image.Version, size)
+		if uploadErr := bucket.UploadFromStreamWithID(fileID, fileID, bytes.NewReader(file.Data), opts); uploadErr != nil {
+			deleteImageFiles(id, image)
+			return common.CreateGenericInternalError(uploadErr)
+		}
+	}
+
+	previous, err := replacePlanetImage(id, bson.D{{Key: "$set", Value: bson.D{{Key: "image", Value: image}}}})
+	if err != nil {
+		deleteImageFiles(id, image)
+		return err
+	}
+
+	if previous != nil {
+		if err := deleteImageFiles(id, previous); err != nil {
+			log.Printf("could not delete the previous image files of planet %s: %s", id.Hex(), err.Message)
+		}
+	}
+
+	return nil
+}
+
+// abre a imagem do planeta no tamanho informado
+func OpenPlanetImage(id primitive.ObjectID, image *PlanetImage, size string) (*gridfs.DownloadStream, *common.Error) {
+	bucket, err := imagesBucket()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, openErr := bucket.OpenDownloadStream(imageFileID(id, image.Version, size))
+	if openErr != nil {
+		if errors.Is(openErr, gridfs.ErrFileNotFound) {
+			return nil, common.CreateNotFoundError(fmt.Sprintf("Image not found for given planet id (%s).", id))
+		}
+		return nil, common.CreateGenericInternalError(openErr)
+	}
+
+	return stream, nil
+}
+
+func DeletePlanetImage(id primitive.ObjectID) *common.Error {
+	previous, err := replacePlanetImage(id, bson.D{{Key: "$unset", Value: bson.D{{Key: "image", Value: ""}}}})
+	if err != nil {
+		return err
+	} else if previous == nil {
+		return nil
+	}
+
+	return deleteImageFiles(id, previous)
+}
+
+// altera a imagem do planeta e devolve a imagem anterior, nil se nao havia
+func replacePlanetImage(id primitive.ObjectID, update bson.D) (*PlanetImage, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: id}}
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.D{{Key: "image", Value: 1}}).
+		SetReturnDocument(options.Before)
+
+	var previous struct {
+		Image *PlanetImage `bson:"image"`
+	}
+	err := planetsCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", id))
+	} else if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return previous.Image, nil
+}
+
+// remove os arquivos de uma versao da imagem, se existirem
+func deleteImageFiles(id primitive.ObjectID, image *PlanetImage) *common.Error {
+	bucket, err := imagesBucket()
+	if err != nil {
+		return err
+	}
+
+	for _, size := range []string{ImageOriginal, ImageThumb} {
+		if err := bucket.Delete(imageFileID(id, image.Version, size)); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return common.CreateGenericInternalError(err)
+		}
+	}
+
+	return nil
+}
+
+// remove todos os arquivos de imagem do planeta, inclusive os de envios interrompidos
+func deletePlanetImages(id primitive.ObjectID) *common.Error {
+	bucket, err := imagesBucket()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := utils.WithTimeout(30)
+	defer cancel()
+	cur, findErr := bucket.Find(bson.D{{Key: "metadata.planetId", Value: id}})
+	if findErr != nil {
+		return common.CreateGenericInternalError(findErr)
+	}
+
+	files := []struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	if err := cur.All(ctx, &files); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	for _, file := range files {
+		if err := bucket.Delete(file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return common.CreateGenericInternalError(err)
+		}
+	}
+
+	return nil
+}
+
+func imagesBucket() (*gridfs.Bucket, *common.Error) {
+	bucket, err := gridfs.NewBucket(database, options.GridFSBucket().SetName("images"))
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	bucket.SetReadDeadline(deadline)
+	bucket.SetWriteDeadline(deadline)
+
+	return bucket, nil
+}
+
+func imageFileID(id primitive.ObjectID, version string, size string) string {
+	if version == "" {
+		return id.Hex() + "/" + size
+	}
+
+	return id.Hex() + "/" + version + "/" + size
+}
@@ -0,0 +1,204 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+)
+
+type ImportSummary struct {
+	Total   int `json:"total" bson:"total"`
+	Inserts int `json:"inserts" bson:"inserts"`
+	Updates int `json:"updates" bson:"updates"`
+	Skips   int `json:"skips" bson:"skips"`
+	Errors  int `json:"errors" bson:"errors"`
+}
+
+// linha com erro de uma importacao; fica na colecao importErrors, fora do documento do job,
+// que com ate 50000 linhas passaria do limite de 16MB
+type ImportRowError struct {
+	JobID primitive.ObjectID `json:"-" bson:"jobId"`
+	Row   int                `json:"row" bson:"row"`
+	Name  string             `json:"name,omitempty" bson:"name,omitempty"`
+	Error *common.Error      `json:"error" bson:"error"`
+}
+
+// execucao de uma importacao; guardada para consulta do andamento e download dos erros
+type ImportJob struct {
+	ObjectID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Status   string             `json:"status" bson:"status"`
+	Format   string             `json:"format" bson:"format"`
+	Summary  ImportSummary      `json:"summary" bson:"summary"`
+	// so nos jobs gravados antes da colecao importErrors
+	Errors     []ImportRowError `json:"-" bson:"errors,omitempty"`
+	Detail     string           `json:"detail,omitempty" bson:"detail,omitempty"`
+	CreatedAt  time.Time        `json:"createdAt" bson:"createdAt"`
+	FinishedAt *time.Time       `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	// renovado pela instancia enquanto a importacao espera ou roda
+	HeartbeatAt time.Time `json:"-" bson:"heartbeatAt"`
+}
+
+func CreateImportJob(job *ImportJob) (primitive.ObjectID, *common.Error) {
+	job.ObjectID = primitive.NilObjectID
+	job.CreatedAt = time.Now().UTC()
+	job.HeartbeatAt = job.CreatedAt
+
+	id, err := insertDocument(importJobsCollection, job)
+	if err != nil {
+		return id, err
+	}
+	job.ObjectID = id
+
+	return id, nil
+}
+
+func GetImportJobByID(id primitive.ObjectID) (*ImportJob, *common.Error) {
+	job := ImportJob{}
+	if err := findDocumentByID(importJobsCollection, id, &job, fmt.Sprintf("Import job not found under given id (%s).", id)); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func UpdateImportJob(job *ImportJob) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: job.ObjectID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: job.Status},
+		{Key: "summary", Value: job.Summary},
+		{Key: "detail", Value: job.Detail},
+		{Key: "finishedAt", Value: job.FinishedAt},
+		{Key: "heartbeatAt", Value: time.Now().UTC()},
+	}}}
+
+	if _, err := importJobsCollection.UpdateOne(ctx, filter, update); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
+// grava as linhas com erro da importacao, em lotes
+func SaveImportRowErrors(jobID primitive.ObjectID, rowErrors []ImportRowError) *common.Error {
+	const batchSize = 1000
+
+	for start := 0; start < len(rowErrors); start += batchSize {
+		end := start + batchSize
+		if end > len(rowErrors) {
+			end = len(rowErrors)
+		}
+
+		documents := make([]interface{}, 0, end-start)
+		for _, rowErr := range rowErrors[start:end] {
+			rowErr.JobID = jobID
+			documents = append(documents, rowErr)
+		}
+
+		ctx, cancel := utils.WithTimeout(30)
+		_, err := importErrorsCollection.InsertMany(ctx, documents)
+		cancel()
+		if err != nil {
+			return common.CreateGenericInternalError(err)
+		}
+	}
+
+	return nil
+}
+
+// linhas com erro da importacao, na ordem do arquivo
+func GetImportRowErrors(job *ImportJob) ([]ImportRowError, *common.Error) {
+	if len(job.Errors) > 0 {
+		return job.Errors, nil
+	}
+
+	ctx, cancel := utils.WithTimeout(30)
+	defer cancel()
+	rowErrors := make([]ImportRowError, 0)
+	filter := bson.D{{Key: "jobId", Value: job.ObjectID}}
+	opts := options.Find().SetSort(bson.D{{Key: "row", Value: 1}})
+
+	cur, err := importErrorsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	if err := cur.All(ctx, &rowErrors); err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return rowErrors, nil
+}
+
+// avisa que as importacoes ainda estao com esta instancia
+func TouchImportJobs(ids []primitive.ObjectID) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "heartbeatAt", Value: time.Now().UTC()}}}}
+
+	if _, err := importJobsCollection.UpdateMany(ctx, filter, update); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
+// marca como falhas as importacoes pendentes ou em andamento sem sinal desde before; a
+// instancia que as processava parou no meio
+func FailStaleImportJobs(before time.Time, detail string) (int64, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{
+		{Key: "status", Value: bson.D{{Key: "$in", Value: []string{ImportJobPending, ImportJobRunning}}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "heartbeatAt", Value: bson.D{{Key: "$lt", Value: before}}}},
+			bson.D{{Key: "heartbeatAt", Value: bson.D{{Key: "$exists", Value: false}}}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: ImportJobFailed},
+		{Key: "detail", Value: detail},
+		{Key: "finishedAt", Value: time.Now().UTC()},
+	}}}
+
+	res, err := importJobsCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, common.CreateGenericInternalError(err)
+	}
+
+	return res.ModifiedCount, nil
+}
+
+// planetas cujo nome coincide com algum dos nomes informados, sem diferenciar maiusculas
+func GetPlanetsByNames(names []string) ([]*Planet, *common.Error) {
+	ctx, cancel := utils.WithTimeout(30)
+	defer cancel()
+	planets := make([]*Planet, 0)
+	filter := bson.D{{Key: "name", Value: bson.D{{Key: "$in", Value: names}}}}
+	opts := options.Find().SetCollation(&options.Collation{Locale: "en", Strength: 2})
+
+	cur, err := planetsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	if err := cur.All(ctx, &planets); err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return planets, nil
+}
@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indices da colecao de planetas; tambem usados para avisar sobre filtros sem indice
+var planetIndexes = []mongo.IndexModel{
+	// o padrao do indice 2d e [-180, 180); o limite superior e exclusivo, por isso o +1
+	{Keys: bson.D{{Key: "location", Value: "2d"}}, Options: options.Index().SetName(locationIndexName).SetMin(-MaxCoordinate).SetMax(MaxCoordinate + 1)},
+	{Keys: bson.D{{Key: "systemId", Value: 1}}, Options: options.Index().SetName("systemId_1")},
+	{Keys: bson.D{{Key: "tags", Value: 1}}, Options: options.Index().SetName("tags_1")},
+	{Keys: bson.D{{Key: "searchKeys", Value: 1}}, Options: options.Index().SetName("searchKeys_1")},
+	{
+		Keys: bson.D{
+			{Key: "name", Value: "text"},
+			{Key: "aliases", Value: "text"},
+			{Key: "climate", Value: "text"},
+			{Key: "terrain", Value: "text"},
+			{Key: "description", Value: "text"},
+		},
+		// cada planeta e processado no idioma do campo language, ingles por padrao
+		Options: options.Index().SetName("planets_text").
+			SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "aliases", Value: 5}, {Key: "climate", Value: 2}, {Key: "terrain", Value: 2}}).
+			SetDefaultLanguage("english").
+			SetLanguageOverride("language"),
+	},
+}
+
+// cria os indices utilizados pelas consultas, caso ainda nao existam
+func CreateIndexes() error {
+	ctx, cancel := utils.WithTimeout(30)
+	defer cancel()
+
+	_, err := planetsCollection.Indexes().CreateMany(ctx, planetIndexes)
+	if isIndexOptionsConflict(err) {
+		// o indice 2d criado antes dos limites da galaxia usa os limites padrao; e recriado
+		if _, err := planetsCollection.Indexes().DropOne(ctx, locationIndexName); err != nil {
+			return err
+		}
+		_, err = planetsCollection.Indexes().CreateMany(ctx, planetIndexes)
+	}
+	if err != nil {
+		return err
+	}
+
+	// termos gravados antes do campo keys ficam fora do indice ate a migracao taxonomy_keys
+	_, err = taxonomyCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "kind", Value: 1}, {Key: "keys", Value: 1}},
+		Options: options.Index().SetName("kind_1_keys_1").SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "keys", Value: bson.D{{Key: "$exists", Value: true}}}}),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = lanesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "from", Value: 1}}, Options: options.Index().SetName("from_1")},
+		{Keys: bson.D{{Key: "to", Value: 1}}, Options: options.Index().SetName("to_1")},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = importErrorsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "jobId", Value: 1}, {Key: "row", Value: 1}},
+		Options: options.Index().SetName("jobId_1_row_1"),
+	})
+
+	return err
+}
+
+// campos que podem ser consultados por um indice: o _id e o primeiro campo de cada indice
+// comum; os indices 2d e textual so atendem os proprios operadores
+func indexedPlanetFields() map[string]bool {
+	fields := map[string]bool{"_id": true}
+	for _, index := range planetIndexes {
+		if keys, ok := index.Keys.(bson.D); ok && len(keys) > 0 && keys[0].Value == 1 {
+			fields[keys[0].Key] = true
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rota do hiperespaco entre dois planetas, percorrivel nos dois sentidos
+type Lane struct {
+	ObjectID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name     string             `json:"name" bson:"name"`
+	From     primitive.ObjectID `json:"from" bson:"from"`
+	To       primitive.ObjectID `json:"to" bson:"to"`
+	Distance float64            `json:"distance" bson:"distance"`
+	// distancia calculada pelas coordenadas; acompanha as mudancas de localizacao dos planetas
+	Measured bool `json:"-" bson:"measured"`
+}
+
+// cria a rota; sem distancia informada, usa a distancia entre as coordenadas dos planetas
+func CreateLane(lane *Lane) (primitive.ObjectID, *common.Error) {
+	from, err := GetPlanetByID(lane.From)
+	if err != nil {
+		return primitive.ObjectID{}, referenceError("from", err)
+	}
+
+	to, err := GetPlanetByID(lane.To)
+	if err != nil {
+		return primitive.ObjectID{}, referenceError("to", err)
+	}
+
+	lane.Measured = lane.Distance == 0
+	if lane.Measured {
+		if from.Location == nil || to.Location == nil {
+			return primitive.ObjectID{}, common.CreateFormError(map[string]string{
+				"distance": "Distance is required when one of the planets has no coordinates.",
+			})
+		}
+		lane.Distance = laneDistance(from, to)
+	}
+
+	lane.ObjectID = primitive.NilObjectID
+	return insertDocument(lanesCollection, lane)
+}
+
+func GetLaneByID(id primitive.ObjectID) (*Lane, *common.Error) {
+	lane := Lane{}
+	if err := findDocumentByID(lanesCollection, id, &lane, fmt.Sprintf("Lane not found under given id (%s).", id)); err != nil {
+		return nil, err
+	}
+
+	return &lane, nil
+}
+
+func GetAllLanes() ([]*Lane, *common.Error) {
+	lanes := make([]*Lane, 0)
+	if err := findDocuments(lanesCollection, bson.D{}, &lanes); err != nil {
+		return nil, err
+	}
+
+	return lanes, nil
+}
+
+func DeleteLane(id primitive.ObjectID) *common.Error {
+	return deleteDocumentByID(lanesCollection, id, fmt.Sprintf("Lane not found under given id (%s).", id))
+}
+
+// recalcula as rotas medidas do planeta com a localizacao nova; sem coordenadas, as rotas
+// mantem a ultima distancia calculada
+func updatePlanetLanes(planet *Planet) *common.Error {
+	if planet.Location == nil {
+		return nil
+	}
+
+	lanes := make([]*Lane, 0)
+	filter := bson.D{
+		{Key: "measured", Value: true},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "from", Value: planet.ObjectID}},
+			bson.D{{Key: "to", Value: planet.ObjectID}},
+		}},
+	}
+	if err := findDocuments(lanesCollection, filter, &lanes); err != nil {
+		return err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(lanes))
+	for _, lane := range lanes {
+		ids = append(ids, laneOtherEnd(lane, planet.ObjectID))
+	}
+
+	others, err := GetPlanetsByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	for _, lane := range lanes {
+		other, ok := others[laneOtherEnd(lane, planet.ObjectID)]
+		if !ok || other.Location == nil {
+			continue
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "distance", Value: laneDistance(planet, other)}}}}
+		if _, err := lanesCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: lane.ObjectID}}, update); err != nil {
+			return common.CreateGenericInternalError(err)
+		}
+	}
+
+	return nil
+}
+
+func laneOtherEnd(lane *Lane, planetID primitive.ObjectID) primitive.ObjectID {
+	if lane.From == planetID {
+		return lane.To
+	}
+
+	return lane.From
+}
+
+func laneDistance(from *Planet, to *Planet) float64 {
+	return math.Hypot(from.Location.X-to.Location.X, from.Location.Y-to.Location.Y)
+}
+
+// remove as rotas que partem ou chegam no planeta
+func deletePlanetLanes(planetID primitive.ObjectID) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "from", Value: planetID}},
+		bson.D{{Key: "to", Value: planetID}},
+	}}}
+
+	if _, err := lanesCollection.DeleteMany(ctx, filter); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
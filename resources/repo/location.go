@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const locationIndexName = "location_2d"
+
+// limite das coordenadas x e y, nos dois sentidos; o indice 2d e criado com esses limites
+const MaxCoordinate = 1e6
+
+// coordenadas galacticas no formato legado do indice 2d (x antes de y)
+type Location struct {
+	X float64 `json:"x" bson:"x"`
+	Y float64 `json:"y" bson:"y"`
+}
+
+type NearQuery struct {
+	X      float64
+	Y      float64
+	Radius float64 // 0 para nao limitar a distancia
+	Limit  int64
+	// planeta a ser ignorado, usado na busca de vizinhos
+	Exclude *primitive.ObjectID
+}
+
+// planetas ordenados pela distancia ate o ponto informado, com a distancia preenchida
+func GetPlanetsNear(query NearQuery) ([]*Planet, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	planets := make([]*Planet, 0)
+
+	geoNear := bson.D{
+		{Key: "near", Value: bson.A{query.X, query.Y}},
+		{Key: "distanceField", Value: "distance"},
+		{Key: "key", Value: "location"},
+	}
+
+	if query.Radius > 0 {
+		geoNear = append(geoNear, bson.E{Key: "maxDistance", Value: query.Radius})
+	}
+
+	if query.Exclude != nil {
+		geoNear = append(geoNear, bson.E{Key: "query", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "$ne", Value: *query.Exclude}}}}})
+	}
+
+	pipeline := bson.A{bson.D{{Key: "$geoNear", Value: geoNear}}}
+	if query.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: query.Limit}})
+	}
+
+	cur, err := planetsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	if err := cur.All(ctx, &planets); err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return planets, nil
+}
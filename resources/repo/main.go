@@ -1,13 +1,42 @@
 package repo
 
 import (
+	"github.com/jvitoroc/b2w-star-wars/utils"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var planetsCollection *mongo.Collection
+var taxonomyCollection *mongo.Collection
+var regionsCollection *mongo.Collection
+var sectorsCollection *mongo.Collection
+var systemsCollection *mongo.Collection
+var lanesCollection *mongo.Collection
+var importJobsCollection *mongo.Collection
+var importErrorsCollection *mongo.Collection
+var migrationsCollection *mongo.Collection
 var db *mongo.Client
+var database *mongo.Database
 
-func Initialize(_db *mongo.Client, databaseName string) {
+func Initialize(_db *mongo.Client, databaseName string) error {
 	db = _db
+	database = db.Database(databaseName)
 	planetsCollection = db.Database(databaseName).Collection("planets")
+	taxonomyCollection = db.Database(databaseName).Collection("taxonomy")
+	regionsCollection = db.Database(databaseName).Collection("regions")
+	sectorsCollection = db.Database(databaseName).Collection("sectors")
+	systemsCollection = db.Database(databaseName).Collection("systems")
+	lanesCollection = db.Database(databaseName).Collection("lanes")
+	importJobsCollection = db.Database(databaseName).Collection("importJobs")
+	importErrorsCollection = db.Database(databaseName).Collection("importErrors")
+	migrationsCollection = db.Database(databaseName).Collection("schema_migrations")
+
+	return nil
+}
+
+// verifica se o servidor do banco responde
+func Ping() error {
+	ctx, cancel := utils.WithTimeout(2)
+	defer cancel()
+	return db.Ping(ctx, readpref.PrimaryPreferred())
 }
@@ -0,0 +1,282 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	migrationLockID = "lock"
+	// um lock mais antigo que isso e considerado abandonado (instancia que caiu no meio)
+	migrationLockTTL = 10 * time.Minute
+	// tempo maximo de cada passo de uma migracao
+	migrationTimeout = 60
+)
+
+// migracao versionada; Down desfaz o que Up fez. Sem Down a migracao e irreversivel e o
+// MigrateDown para nela
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context) error
+	Down    func(ctx context.Context) error
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// resumo exibido no /readyz
+type MigrationState struct {
+	Current int  `json:"current"`
+	Latest  int  `json:"latest"`
+	Pending int  `json:"pending"`
+	Locked  bool `json:"locked"`
+}
+
+type appliedMigration struct {
+	ID        string    `bson:"_id"`
+	Version   int       `bson:"version"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+type migrationLock struct {
+	ID       string    `bson:"_id"`
+	Owner    string    `bson:"owner"`
+	LockedAt time.Time `bson:"lockedAt"`
+}
+
+func migrationDocumentID(version int) string {
+	return fmt.Sprintf("v%04d", version)
+}
+
+// migracoes registradas, em ordem de versao
+func sortedMigrations() []Migration {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+func appliedMigrations() (map[int]appliedMigration, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	cur, err := migrationsCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$ne", Value: migrationLockID}}}})
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	documents := []appliedMigration{}
+	if err := cur.All(ctx, &documents); err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	applied := make(map[int]appliedMigration, len(documents))
+	for _, document := range documents {
+		applied[document.Version] = document
+	}
+
+	return applied, nil
+}
+
+func GetMigrationsStatus() ([]*MigrationStatus, *common.Error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*MigrationStatus{}
+	for _, migration := range sortedMigrations() {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if document, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &document.AppliedAt
+		}
+		statuses = append(statuses, &status)
+	}
+
+	return statuses, nil
+}
+
+func GetMigrationState() (*MigrationState, *common.Error) {
+	statuses, err := GetMigrationsStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	state := MigrationState{}
+	for _, status := range statuses {
+		state.Latest = status.Version
+		if status.Applied {
+			state.Current = status.Version
+		} else {
+			state.Pending++
+		}
+	}
+
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	count, countErr := migrationsCollection.CountDocuments(ctx, bson.D{{Key: "_id", Value: migrationLockID}})
+	if countErr != nil {
+		return nil, common.CreateGenericInternalError(countErr)
+	}
+	state.Locked = count > 0
+
+	return &state, nil
+}
+
+// aplica as migracoes pendentes em ordem e retorna as que foram aplicadas
+func MigrateUp() ([]*MigrationStatus, *common.Error) {
+	owner, err := acquireMigrationLock()
+	if err != nil {
+		return nil, err
+	}
+	defer releaseMigrationLock(owner)
+
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []*MigrationStatus{}
+	for _, migration := range sortedMigrations() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := runMigrationStep(migration, migration.Up); err != nil {
+			return done, err
+		}
+
+		now := time.Now().UTC()
+		document := appliedMigration{ID: migrationDocumentID(migration.Version), Version: migration.Version, Name: migration.Name, AppliedAt: now}
+		if err := insertMigrationDocument(&document); err != nil {
+			return done, err
+		}
+
+		done = append(done, &MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: true, AppliedAt: &now})
+	}
+
+	return done, nil
+}
+
+// desfaz a ultima migracao aplicada; retorna nil se nenhuma estiver aplicada
+func MigrateDown() (*MigrationStatus, *common.Error) {
+	owner, err := acquireMigrationLock()
+	if err != nil {
+		return nil, err
+	}
+	defer releaseMigrationLock(owner)
+
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := sortedMigrations()
+	for i := len(sorted) - 1; i >= 0; i-- {
+		migration := sorted[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if migration.Down == nil {
+			return nil, common.CreateBadRequestError(fmt.Sprintf("Migration %d (%s) is irreversible and cannot be reverted.", migration.Version, migration.Name))
+		}
+
+		if err := runMigrationStep(migration, migration.Down); err != nil {
+			return nil, err
+		}
+
+		if err := deleteMigrationDocument(migration.Version); err != nil {
+			return nil, err
+		}
+
+		return &MigrationStatus{Version: migration.Version, Name: migration.Name}, nil
+	}
+
+	return nil, nil
+}
+
+func runMigrationStep(migration Migration, step func(ctx context.Context) error) *common.Error {
+	ctx, cancel := utils.WithTimeout(migrationTimeout)
+	defer cancel()
+
+	if err := step(ctx); err != nil {
+		return common.CreateGenericInternalError(fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err))
+	}
+
+	return nil
+}
+
+func insertMigrationDocument(document *appliedMigration) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	if _, err := migrationsCollection.InsertOne(ctx, document); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
+func deleteMigrationDocument(version int) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	if _, err := migrationsCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: migrationDocumentID(version)}}); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
+// o lock e um documento com _id fixo; a chave unica do _id garante que so uma instancia o cria
+func acquireMigrationLock() (string, *common.Error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), primitive.NewObjectID().Hex())
+	now := time.Now().UTC()
+
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+
+	_, err := migrationsCollection.InsertOne(ctx, migrationLock{ID: migrationLockID, Owner: owner, LockedAt: now})
+	if err == nil {
+		return owner, nil
+	} else if !isDuplicateKeyError(err) {
+		return "", common.CreateGenericInternalError(err)
+	}
+
+	// assume o lock apenas se ele estiver abandonado
+	filter := bson.D{
+		{Key: "_id", Value: migrationLockID},
+		{Key: "lockedAt", Value: bson.D{{Key: "$lt", Value: now.Add(-migrationLockTTL)}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "owner", Value: owner}, {Key: "lockedAt", Value: now}}}}
+	err = migrationsCollection.FindOneAndUpdate(ctx, filter, update).Err()
+	if err == nil {
+		return owner, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", common.CreateGenericInternalError(err)
+	}
+
+	return "", common.CreateConflictError("The migrations are locked by another instance.")
+}
+
+func releaseMigrationLock(owner string) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	migrationsCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: migrationLockID}, {Key: "owner", Value: owner}})
+}
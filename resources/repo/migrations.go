@@ -0,0 +1,161 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// novas migracoes entram no fim da lista com a proxima versao; versoes aplicadas nunca mudam
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "planets_default_tags",
+		Up: func(ctx context.Context) error {
+			filter := bson.D{{Key: "tags", Value: bson.D{{Key: "$exists", Value: false}}}}
+			_, err := planetsCollection.UpdateMany(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "tags", Value: bson.A{}}}}})
+			return err
+		},
+		Down: func(ctx context.Context) error {
+			filter := bson.D{{Key: "tags", Value: bson.D{{Key: "$size", Value: 0}}}}
+			_, err := planetsCollection.UpdateMany(ctx, filter, bson.D{{Key: "$unset", Value: bson.D{{Key: "tags", Value: ""}}}})
+			return err
+		},
+	},
+	{
+		Version: 2,
+		Name:    "planets_search_names",
+		// planetas gravados antes dos apelidos nao tem searchNames
+		Up: func(ctx context.Context) error {
+			filter := bson.D{{Key: "searchNames", Value: bson.D{{Key: "$exists", Value: false}}}}
+			cur, err := planetsCollection.Find(ctx, filter)
+			if err != nil {
+				return err
+			}
+			defer cur.Close(ctx)
+
+			for cur.Next(ctx) {
+				var planet Planet
+				if err := cur.Decode(&planet); err != nil {
+					return err
+				}
+
+				update := bson.D{{Key: "$set", Value: bson.D{{Key: "searchNames", Value: planet.AllNames()}}}}
+				if _, err := planetsCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: planet.ObjectID}}, update); err != nil {
+					return err
+				}
+			}
+
+			return cur.Err()
+		},
+		// irreversivel: os valores preenchidos sao os mesmos que a API grava hoje, e nao da para
+		// separa-los dos gravados depois
+	},
+	{
+		Version: 3,
+		Name:    "planets_search_keys",
+		// nomes normalizados usados pelas buscas prefix, exact e contains
+		Up: func(ctx context.Context) error {
+			filter := bson.D{{Key: "searchKeys", Value: bson.D{{Key: "$exists", Value: false}}}}
+			cur, err := planetsCollection.Find(ctx, filter)
+			if err != nil {
+				return err
+			}
+			defer cur.Close(ctx)
+
+			for cur.Next(ctx) {
+				var planet Planet
+				if err := cur.Decode(&planet); err != nil {
+					return err
+				}
+
+				planet.setSearchNames()
+				update := bson.D{{Key: "$set", Value: bson.D{{Key: "searchKeys", Value: planet.SearchKeys}}}}
+				if _, err := planetsCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: planet.ObjectID}}, update); err != nil {
+					return err
+				}
+			}
+
+			return cur.Err()
+		},
+		// irreversivel: as buscas contains, prefix e exact leem searchKeys, e remove-lo faria essas
+		// buscas nao encontrarem nada
+	},
+	{
+		Version: 4,
+		Name:    "taxonomy_keys",
+		// termo e sinonimos no campo coberto pelo indice unico
+		Up: func(ctx context.Context) error {
+			filter := bson.D{{Key: "keys", Value: bson.D{{Key: "$exists", Value: false}}}}
+			cur, err := taxonomyCollection.Find(ctx, filter)
+			if err != nil {
+				return err
+			}
+			defer cur.Close(ctx)
+
+			for cur.Next(ctx) {
+				var term TaxonomyTerm
+				if err := cur.Decode(&term); err != nil {
+					return err
+				}
+
+				update := bson.D{{Key: "$set", Value: bson.D{{Key: "keys", Value: taxonomyKeys(term.Term, term.Synonyms)}}}}
+				if _, err := taxonomyCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: term.ObjectID}}, update); err != nil {
+					return err
+				}
+			}
+
+			return cur.Err()
+		},
+		// as consultas nao leem keys; sem ele os termos apenas saem do indice unico
+		Down: func(ctx context.Context) error {
+			_, err := taxonomyCollection.UpdateMany(ctx, bson.D{}, bson.D{{Key: "$unset", Value: bson.D{{Key: "keys", Value: ""}}}})
+			return err
+		},
+	},
+	{
+		Version: 5,
+		Name:    "lanes_measured",
+		// rotas cuja distancia e a das coordenadas atuais foram calculadas na criacao
+		Up: func(ctx context.Context) error {
+			filter := bson.D{{Key: "measured", Value: bson.D{{Key: "$exists", Value: false}}}}
+			cur, err := lanesCollection.Find(ctx, filter)
+			if err != nil {
+				return err
+			}
+			defer cur.Close(ctx)
+
+			for cur.Next(ctx) {
+				var lane Lane
+				if err := cur.Decode(&lane); err != nil {
+					return err
+				}
+
+				planets, findErr := GetPlanetsByIDs([]primitive.ObjectID{lane.From, lane.To})
+				if findErr != nil {
+					return errors.New(findErr.Message + " " + findErr.Detail)
+				}
+
+				from, to := planets[lane.From], planets[lane.To]
+				if from == nil || to == nil || from.Location == nil || to.Location == nil ||
+					math.Abs(laneDistance(from, to)-lane.Distance) > 1e-9 {
+					continue
+				}
+
+				update := bson.D{{Key: "$set", Value: bson.D{{Key: "measured", Value: true}}}}
+				if _, err := lanesCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: lane.ObjectID}}, update); err != nil {
+					return err
+				}
+			}
+
+			return cur.Err()
+		},
+		Down: func(ctx context.Context) error {
+			_, err := lanesCollection.UpdateMany(ctx, bson.D{}, bson.D{{Key: "$unset", Value: bson.D{{Key: "measured", Value: ""}}}})
+			return err
+		},
+	},
+}
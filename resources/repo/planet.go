@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -9,39 +10,215 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Planet struct {
-	ObjectID        primitive.ObjectID `json:"id" bson:"_id"`
-	Name            string             `json:"name"`
-	Climate         string             `json:"climate"`
-	Terrain         string             `json:"terrain"`
-	FilmsAppearedIn int                `json:"filmsAppearedIn"`
+	ObjectID    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name        string             `json:"name" bson:"name" schema:"required,minLength=1,maxLength=100"`
+	DisplayName string             `json:"displayName,omitempty" bson:"-"`
+	Aliases     []string           `json:"aliases,omitempty" bson:"aliases" schema:"maxItems=50,minLength=1,maxLength=100"`
+	Names       map[string]string  `json:"names,omitempty" bson:"names" schema:"maxItems=50,minLength=1,maxLength=100"`
+	Climate     string             `json:"climate" bson:"climate" schema:"required,minLength=1,maxLength=200"`
+	Terrain     string             `json:"terrain" bson:"terrain" schema:"required,minLength=1,maxLength=200"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty" schema:"maxLength=2000"`
+	// idioma da descricao, usado pelo indice textual; os mesmos de TextSearchLanguages
+	Language        string              `json:"language,omitempty" bson:"language,omitempty" schema:"enum=en|pt"`
+	FilmsAppearedIn int                 `json:"filmsAppearedIn" bson:"filmsAppearedIn" schema:"required,minimum=0"`
+	SystemID        *primitive.ObjectID `json:"systemId,omitempty" bson:"systemId,omitempty"`
+	Location        *Location           `json:"location,omitempty" bson:"location,omitempty"`
+	Grid            string              `json:"grid,omitempty" bson:"grid,omitempty" schema:"maxLength=4"`
+	Tags            []string            `json:"tags,omitempty" bson:"tags" schema:"maxItems=50,minLength=1,maxLength=50"`
+	Metadata        map[string]string   `json:"metadata,omitempty" bson:"metadata" schema:"maxItems=50,maxLength=1000"`
+	Image           *PlanetImage        `json:"image,omitempty" bson:"image,omitempty"`
+
+	// preenchido apenas em buscas por proximidade
+	Distance *float64 `json:"distance,omitempty" bson:"distance,omitempty"`
+
+	// nome, apelidos e nomes localizados, usados na busca
+	SearchNames []string `json:"-" bson:"searchNames"`
+	// os mesmos nomes normalizados, para as buscas que usam o indice
+	SearchKeys []string `json:"-" bson:"searchKeys"`
+}
+
+// todos os nomes pelos quais o planeta e conhecido, sem repeticoes
+func (p *Planet) AllNames() []string {
+	seen := map[string]bool{}
+	names := []string{}
+
+	add := func(name string) {
+		if key := utils.NormalizeTerm(name); key != "" && !seen[key] {
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+
+	add(p.Name)
+	for _, alias := range p.Aliases {
+		add(alias)
+	}
+	for _, name := range p.Names {
+		add(name)
+	}
+
+	return names
+}
+
+func (p *Planet) setSearchNames() {
+	p.SearchNames = p.AllNames()
+	p.SearchKeys = make([]string, len(p.SearchNames))
+	for i, name := range p.SearchNames {
+		p.SearchKeys[i] = utils.NormalizeTerm(name)
+	}
 }
 
-func CreatePlanet(name string, climate string, terrain string, filmsAppearedIn int) (primitive.ObjectID, *common.Error) {
+func CreatePlanet(planet *Planet) (primitive.ObjectID, *common.Error) {
+	if err := checkPlanetSystem(planet); err != nil {
+		return primitive.ObjectID{}, err
+	}
+
 	ctx, cancel := utils.WithTimeout(5)
 	defer cancel()
-	res, err := planetsCollection.InsertOne(ctx, bson.D{
-		{Key: "name", Value: name},
-		{Key: "climate", Value: climate},
-		{Key: "terrain", Value: terrain},
-		{Key: "filmsAppearedIn", Value: filmsAppearedIn},
-	})
+	planet.ObjectID = primitive.NilObjectID
+	planet.setSearchNames()
+	res, err := planetsCollection.InsertOne(ctx, planet)
 
 	if err != nil {
-		return primitive.ObjectID{}, common.CreateGenericInternalError(err)
+		return primitive.ObjectID{}, planetWriteError(err, planet)
 	} else {
 		return res.InsertedID.(primitive.ObjectID), nil
 	}
 }
 
+// grava apenas os campos informados (nomes do bson), para nao desfazer alteracoes feitas ao mesmo
+// tempo nos demais, como as tags de POST /planet/{id}/tags/{tag}; campos opcionais vazios sao removidos
+func UpdatePlanet(planet *Planet, fields []string) *common.Error {
+	set := bson.D{}
+	unset := bson.D{}
+	namesChanged, locationChanged := false, false
+
+	for _, field := range fields {
+		switch field {
+		case "name":
+			set = append(set, bson.E{Key: field, Value: planet.Name})
+			namesChanged = true
+		case "aliases":
+			set = append(set, bson.E{Key: field, Value: planet.Aliases})
+			namesChanged = true
+		case "names":
+			set = append(set, bson.E{Key: field, Value: planet.Names})
+			namesChanged = true
+		case "climate":
+			set = append(set, bson.E{Key: field, Value: planet.Climate})
+		case "terrain":
+			set = append(set, bson.E{Key: field, Value: planet.Terrain})
+		case "filmsAppearedIn":
+			set = append(set, bson.E{Key: field, Value: planet.FilmsAppearedIn})
+		case "tags":
+			set = append(set, bson.E{Key: field, Value: planet.Tags})
+		case "metadata":
+			set = append(set, bson.E{Key: field, Value: planet.Metadata})
+		case "systemId":
+			if planet.SystemID == nil {
+				unset = append(unset, bson.E{Key: field, Value: ""})
+				break
+			}
+			if err := checkPlanetSystem(planet); err != nil {
+				return err
+			}
+			set = append(set, bson.E{Key: field, Value: *planet.SystemID})
+		case "location":
+			locationChanged = true
+			if planet.Location != nil {
+				set = append(set, bson.E{Key: "location", Value: planet.Location}, bson.E{Key: "grid", Value: planet.Grid})
+			} else {
+				unset = append(unset, bson.E{Key: "location", Value: ""}, bson.E{Key: "grid", Value: ""})
+			}
+		case "description", "language":
+			value := planet.Description
+			if field == "language" {
+				value = planet.Language
+			}
+			if value != "" {
+				set = append(set, bson.E{Key: field, Value: value})
+			} else {
+				unset = append(unset, bson.E{Key: field, Value: ""})
+			}
+		}
+	}
+
+	if namesChanged {
+		planet.setSearchNames()
+		set = append(set, bson.E{Key: "searchNames", Value: planet.SearchNames}, bson.E{Key: "searchKeys", Value: planet.SearchKeys})
+	}
+
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+
+	// nada a gravar; apenas confirma que o planeta existe
+	filter := bson.D{{Key: "_id", Value: planet.ObjectID}}
+	if len(update) == 0 {
+		if count, err := countDocuments(planetsCollection, filter); err != nil {
+			return err
+		} else if count == 0 {
+			return common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", planet.ObjectID))
+		}
+		return nil
+	}
+
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	res, err := planetsCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return planetWriteError(err, planet)
+	} else if res.MatchedCount == 0 {
+		return common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", planet.ObjectID))
+	}
+
+	if locationChanged {
+		return updatePlanetLanes(planet)
+	}
+
+	return nil
+}
+
+// atualiza apenas a quantidade de filmes, usado na ressincronizacao com a SWAPI
+func SetPlanetFilms(id primitive.ObjectID, filmsAppearedIn int) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "filmsAppearedIn", Value: filmsAppearedIn}}}}
+	res, err := planetsCollection.UpdateOne(ctx, filter, update)
+
+	if err != nil {
+		return planetWriteError(err, nil)
+	} else if res.MatchedCount == 0 {
+		return common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", id))
+	}
+
+	return nil
+}
+
 func GetPlanetByID(id primitive.ObjectID) (*Planet, *common.Error) {
+	return GetProjectedPlanetByID(id, nil)
+}
+
+// o planeta apenas com os campos da projecao
+func GetProjectedPlanetByID(id primitive.ObjectID, projection *PlanetProjection) (*Planet, *common.Error) {
 	ctx, cancel := utils.WithTimeout(5)
 	defer cancel()
 	planet := Planet{}
 	filter := bson.D{{Key: "_id", Value: id}}
-	err := planetsCollection.FindOne(ctx, filter).Decode(&planet)
+	opts := options.FindOne()
+	if projection != nil {
+		opts.SetProjection(projection.toBSON())
+	}
+	err := planetsCollection.FindOne(ctx, filter, opts).Decode(&planet)
 
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -53,21 +230,29 @@ func GetPlanetByID(id primitive.ObjectID) (*Planet, *common.Error) {
 	return &planet, nil
 }
 
-func GetMatchedPlanets(criteria map[string]string) ([]*Planet, *common.Error) {
-	ctx, cancel := utils.WithTimeout(5)
-	defer cancel()
+// planetas indexados pelo id; ids inexistentes sao ignorados
+func GetPlanetsByIDs(ids []primitive.ObjectID) (map[primitive.ObjectID]*Planet, *common.Error) {
 	planets := make([]*Planet, 0)
-	filter := bson.D{}
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if err := findDocuments(planetsCollection, filter, &planets); err != nil {
+		return nil, err
+	}
 
-	if criteria != nil {
-		for k, v := range criteria {
-			if v != "" {
-				filter = append(filter, bson.E{Key: k, Value: primitive.Regex{Pattern: v, Options: "i"}})
-			}
-		}
+	byID := make(map[primitive.ObjectID]*Planet, len(planets))
+	for _, planet := range planets {
+		byID[planet.ObjectID] = planet
 	}
 
-	cur, err := planetsCollection.Find(ctx, filter)
+	return byID, nil
+}
+
+func GetMatchedPlanets(planetFilter PlanetFilter) ([]*Planet, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	planets := make([]*Planet, 0)
+	filter := planetFilter.toBSON()
+
+	cur, err := planetsCollection.Find(ctx, filter, planetFilter.findOptions())
 	if err != nil {
 		return nil, common.CreateGenericInternalError(err)
 	}
@@ -86,8 +271,67 @@ func GetMatchedPlanets(criteria map[string]string) ([]*Planet, *common.Error) {
 	return planets, nil
 }
 
+// quantidade de planetas que atendem ao filtro, sem considerar a paginacao
+func CountPlanets(planetFilter PlanetFilter) (int64, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+
+	count, err := planetsCollection.CountDocuments(ctx, planetFilter.toBSON(), planetFilter.countOptions())
+	if err != nil {
+		return 0, common.CreateGenericInternalError(err)
+	}
+
+	return count, nil
+}
+
+// percorre os planetas direto do cursor, sem carregar o resultado inteiro em memoria
+func StreamPlanets(ctx context.Context, planetFilter PlanetFilter, fn func(*Planet) error) *common.Error {
+	opts := planetFilter.findOptions().SetBatchSize(500).SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	cur, err := planetsCollection.Find(ctx, planetFilter.toBSON(), opts)
+	if err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+	defer cur.Close(context.Background())
+
+	for cur.Next(ctx) {
+		var planet Planet
+		if err := cur.Decode(&planet); err != nil {
+			return common.CreateGenericInternalError(err)
+		}
+
+		if err := fn(&planet); err != nil {
+			return common.CreateGenericInternalError(err)
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
 func GetAllPlanets() ([]*Planet, *common.Error) {
-	return GetMatchedPlanets(nil)
+	return GetMatchedPlanets(PlanetFilter{})
+}
+
+func checkPlanetSystem(planet *Planet) *common.Error {
+	if planet.SystemID == nil {
+		return nil
+	}
+
+	system, err := GetSystemByID(*planet.SystemID)
+	if err != nil {
+		return referenceError("systemId", err)
+	}
+
+	// sistemas em remocao nao aceitam novos planetas
+	if system.Deleting {
+		return referenceError("systemId", common.CreateNotFoundError(fmt.Sprintf("System is being deleted (%s).", system.ObjectID)))
+	}
+
+	return nil
 }
 
 func DeletePlanet(id primitive.ObjectID) *common.Error {
@@ -96,11 +340,15 @@ func DeletePlanet(id primitive.ObjectID) *common.Error {
 	filter := bson.D{{Key: "_id", Value: id}}
 	res, err := planetsCollection.DeleteOne(ctx, filter)
 
-	if res.DeletedCount == 0 && err == nil {
-		return common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", id))
-	} else if err != nil {
+	if err != nil {
 		return common.CreateGenericInternalError(err)
+	} else if res.DeletedCount == 0 {
+		return common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", id))
 	}
 
-	return nil
+	if err := deletePlanetImages(id); err != nil {
+		return err
+	}
+
+	return deletePlanetLanes(id)
 }
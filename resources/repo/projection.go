@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// campos de planeta que podem ser pedidos em fields e exclude, pelo nome usado nas
+// respostas, com os campos do documento necessarios para preenche-los
+var planetFields = planetProjectionFields()
+
+func planetProjectionFields() map[string][]string {
+	fields := map[string][]string{}
+	t := reflect.TypeOf(Planet{})
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		bsonName, _ := parseBSONTag(field)
+		if jsonName == "-" || bsonName == "-" {
+			continue
+		}
+		fields[jsonName] = []string{bsonName}
+	}
+
+	// o id e sempre retornado
+	delete(fields, "id")
+	// a distancia so existe nas buscas por proximidade
+	delete(fields, "distance")
+	// o nome de exibicao e calculado a partir do nome e dos nomes localizados
+	fields["displayName"] = []string{"name", "names"}
+
+	return fields
+}
+
+// campos retornados nas leituras de planetas; nil retorna o documento inteiro
+type PlanetProjection struct {
+	fields  map[string]bool
+	exclude bool
+}
+
+// fields e exclude usam os nomes das respostas e nao podem ser combinados; o id e sempre retornado
+func NewPlanetProjection(fields []string, exclude []string) (*PlanetProjection, *common.Error) {
+	if len(fields) > 0 && len(exclude) > 0 {
+		return nil, common.CreateBadRequestError("The fields and exclude parameters cannot be used together.")
+	}
+
+	names := fields
+	projection := &PlanetProjection{fields: map[string]bool{}}
+	if len(exclude) > 0 {
+		names = exclude
+		projection.exclude = true
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	for _, name := range names {
+		if name == "id" {
+			if projection.exclude {
+				return nil, common.CreateBadRequestError("The field 'id' is always returned and cannot be excluded.")
+			}
+			continue
+		}
+
+		if _, ok := planetFields[name]; !ok {
+			return nil, common.CreateBadRequestError(fmt.Sprintf("Unknown field '%s'. Available fields: %s.", name, strings.Join(PlanetFieldNames(), ", ")))
+		}
+		projection.fields[name] = true
+	}
+
+	return projection, nil
+}
+
+func PlanetFieldNames() []string {
+	names := []string{"id"}
+	for name := range planetFields {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	return names
+}
+
+// indica se o campo faz parte da resposta
+func (p *PlanetProjection) Has(field string) bool {
+	if p == nil || field == "id" {
+		return true
+	}
+
+	return p.fields[field] != p.exclude
+}
+
+// copia da projecao que tambem carrega os campos informados, sem altera-los na resposta;
+// usada quando o servidor precisa de campos que o cliente nao pediu
+func (p *PlanetProjection) With(fields ...string) *PlanetProjection {
+	if p == nil {
+		return nil
+	}
+
+	copied := &PlanetProjection{fields: map[string]bool{}, exclude: p.exclude}
+	for field := range p.fields {
+		copied.fields[field] = true
+	}
+
+	for _, field := range fields {
+		if p.exclude {
+			delete(copied.fields, field)
+		} else {
+			copied.fields[field] = true
+		}
+	}
+
+	return copied
+}
+
+func (p *PlanetProjection) toBSON() bson.D {
+	if p.exclude {
+		// um campo do documento so e removido se nenhum campo retornado depender dele
+		needed := map[string]bool{}
+		for name, docFields := range planetFields {
+			if !p.fields[name] {
+				for _, docField := range docFields {
+					needed[docField] = true
+				}
+			}
+		}
+
+		projection := bson.D{}
+		for _, name := range sortedFieldNames(p.fields) {
+			for _, docField := range planetFields[name] {
+				if !needed[docField] {
+					projection = append(projection, bson.E{Key: docField, Value: 0})
+				}
+			}
+		}
+
+		return projection
+	}
+
+	included := map[string]bool{}
+	projection := bson.D{{Key: "_id", Value: 1}}
+	for _, name := range sortedFieldNames(p.fields) {
+		for _, docField := range planetFields[name] {
+			if !included[docField] {
+				included[docField] = true
+				projection = append(projection, bson.E{Key: docField, Value: 1})
+			}
+		}
+	}
+
+	return projection
+}
+
+func sortedFieldNames(fields map[string]bool) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,280 @@
+package repo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// operadores da linguagem de filtros, como em ?climate[in]=arid,temperate
+const (
+	OperatorEq     = "eq"
+	OperatorNe     = "ne"
+	OperatorIn     = "in"
+	OperatorNin    = "nin"
+	OperatorGt     = "gt"
+	OperatorGte    = "gte"
+	OperatorLt     = "lt"
+	OperatorLte    = "lte"
+	OperatorPrefix = "prefix"
+	OperatorExists = "exists"
+)
+
+// quantidade maxima de valores em in e nin
+const maxConditionValues = 100
+
+type valueKind int
+
+const (
+	stringValue valueKind = iota
+	intValue
+	objectIDValue
+)
+
+// campo que pode ser filtrado, pelo nome usado nas respostas
+type filterableField struct {
+	bsonName  string
+	kind      valueKind
+	operators []string
+	// valores sempre gravados em minusculas; prefix compara sem $options i e pode usar o indice
+	lowercase bool
+	// termos separados por virgula, como "arid, temperate"; in e nin comparam cada termo
+	tokenized bool
+}
+
+var (
+	stringOperators   = []string{OperatorEq, OperatorNe, OperatorIn, OperatorNin, OperatorPrefix, OperatorExists}
+	intOperators      = []string{OperatorEq, OperatorNe, OperatorIn, OperatorNin, OperatorGt, OperatorGte, OperatorLt, OperatorLte, OperatorExists}
+	objectIDOperators = []string{OperatorEq, OperatorNe, OperatorIn, OperatorNin, OperatorExists}
+)
+
+var filterableFields = map[string]filterableField{
+	"id":              {bsonName: "_id", kind: objectIDValue, operators: objectIDOperators},
+	"name":            {bsonName: "name", kind: stringValue, operators: stringOperators},
+	"climate":         {bsonName: "climate", kind: stringValue, operators: stringOperators, tokenized: true},
+	"terrain":         {bsonName: "terrain", kind: stringValue, operators: stringOperators, tokenized: true},
+	"grid":            {bsonName: "grid", kind: stringValue, operators: stringOperators},
+	"tags":            {bsonName: "tags", kind: stringValue, operators: stringOperators, lowercase: true},
+	"filmsAppearedIn": {bsonName: "filmsAppearedIn", kind: intValue, operators: intOperators},
+	"systemId":        {bsonName: "systemId", kind: objectIDValue, operators: objectIDOperators},
+}
+
+var conditionParamPattern = regexp.MustCompile(`^([A-Za-z]+)\[([a-z]+)\]$`)
+
+// condicao sobre um campo de planeta; Value ja esta no tipo do campo
+// (uma lista em in e nin, bool em exists)
+type PlanetCondition struct {
+	Field    string
+	Operator string
+	Value    interface{}
+}
+
+// interpreta os parametros no formato campo[operador]=valor; os demais parametros sao ignorados.
+// os erros sao indexados pelo parametro
+func ParsePlanetConditions(params map[string][]string) ([]PlanetCondition, *common.Error) {
+	conditions := []PlanetCondition{}
+	errors := map[string]string{}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		match := conditionParamPattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+
+		if len(params[key]) > 1 {
+			errors[key] = "The filter can be specified only once."
+			continue
+		}
+
+		condition, err := NewPlanetCondition(match[1], match[2], params[key][0])
+		if err != "" {
+			errors[key] = err
+			continue
+		}
+		conditions = append(conditions, *condition)
+	}
+
+	if len(errors) > 0 {
+		return nil, common.CreateFormError(errors)
+	}
+
+	return conditions, nil
+}
+
+// valida o campo e o operador e converte o valor; retorna a mensagem de erro quando invalido
+func NewPlanetCondition(field string, operator string, value string) (*PlanetCondition, string) {
+	filterable, ok := filterableFields[field]
+	if !ok {
+		return nil, fmt.Sprintf("Unknown filter field '%s'. Available fields: %s.", field, strings.Join(FilterableFieldNames(), ", "))
+	}
+
+	if !containsOperator(filterable.operators, operator) {
+		return nil, fmt.Sprintf("Operator '%s' is not supported for '%s'. Available operators: %s.", operator, field, strings.Join(filterable.operators, ", "))
+	}
+
+	condition := &PlanetCondition{Field: field, Operator: operator}
+
+	switch operator {
+	case OperatorExists:
+		exists, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Sprintf("'%s' is not a boolean.", value)
+		}
+		condition.Value = exists
+	case OperatorIn, OperatorNin:
+		values := strings.Split(value, ",")
+		if len(values) > maxConditionValues {
+			return nil, fmt.Sprintf("At most %d values are allowed.", maxConditionValues)
+		}
+
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			converted, err := convertConditionValue(filterable.kind, strings.TrimSpace(v))
+			if err != "" {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		condition.Value = list
+	case OperatorPrefix:
+		if value == "" {
+			return nil, "The prefix must not be empty."
+		}
+		condition.Value = value
+	default:
+		converted, err := convertConditionValue(filterable.kind, value)
+		if err != "" {
+			return nil, err
+		}
+		condition.Value = converted
+	}
+
+	return condition, ""
+}
+
+func FilterableFieldNames() []string {
+	names := make([]string, 0, len(filterableFields))
+	for name := range filterableFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func convertConditionValue(kind valueKind, value string) (interface{}, string) {
+	switch kind {
+	case intValue:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Sprintf("'%s' is not an integer.", value)
+		}
+		return n, ""
+	case objectIDValue:
+		oid, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return nil, fmt.Sprintf("'%s' is not a valid id.", value)
+		}
+		return oid, ""
+	}
+
+	return value, ""
+}
+
+func containsOperator(operators []string, operator string) bool {
+	for _, o := range operators {
+		if o == operator {
+			return true
+		}
+	}
+
+	return false
+}
+
+// as condicoes de um mesmo campo ficam no mesmo documento, como {filmsAppearedIn: {$gte: 2, $lte: 5}}
+func conditionsToBSON(conditions []PlanetCondition) bson.D {
+	filter := bson.D{}
+	byField := map[string]int{}
+
+	for _, condition := range conditions {
+		field := filterableFields[condition.Field].bsonName
+		i, ok := byField[field]
+		if !ok {
+			i = len(filter)
+			byField[field] = i
+			filter = append(filter, bson.E{Key: field, Value: bson.D{}})
+		}
+
+		operators := filter[i].Value.(bson.D)
+		if condition.Operator == OperatorPrefix && filterableFields[condition.Field].lowercase {
+			operators = append(operators, bson.E{Key: "$regex", Value: "^" + regexp.QuoteMeta(strings.ToLower(condition.Value.(string)))})
+		} else if condition.Operator == OperatorPrefix {
+			operators = append(operators,
+				bson.E{Key: "$regex", Value: "^" + regexp.QuoteMeta(condition.Value.(string))},
+				bson.E{Key: "$options", Value: "i"},
+			)
+		} else if (condition.Operator == OperatorIn || condition.Operator == OperatorNin) && filterableFields[condition.Field].tokenized {
+			operators = append(operators, bson.E{Key: "$" + condition.Operator, Value: termPatterns(condition.Value.([]interface{}))})
+		} else {
+			operators = append(operators, bson.E{Key: "$" + condition.Operator, Value: condition.Value})
+		}
+		filter[i].Value = operators
+	}
+
+	return filter
+}
+
+// um termo da lista separada por virgulas, sem diferenciar maiusculas, como nas estatisticas
+func termPatterns(values []interface{}) bson.A {
+	patterns := bson.A{}
+	for _, value := range values {
+		pattern := `(^|,)\s*` + regexp.QuoteMeta(value.(string)) + `\s*(,|$)`
+		patterns = append(patterns, primitive.Regex{Pattern: pattern, Options: "i"})
+	}
+
+	return patterns
+}
+
+// campos filtrados que nao podem usar um indice; vazio quando alguma condicao usa um indice,
+// pois basta uma para o servidor nao percorrer a colecao inteira
+func unindexedConditionFields(conditions []PlanetCondition) []string {
+	indexed := indexedPlanetFields()
+	fields := []string{}
+
+	for _, condition := range conditions {
+		// negacoes, exists=false e prefixos sem diferenciar maiusculas (que percorrem o indice
+		// inteiro) nao se beneficiam do indice
+		selective := condition.Operator != OperatorNe && condition.Operator != OperatorNin &&
+			!(condition.Operator == OperatorExists && condition.Value == false) &&
+			!(condition.Operator == OperatorPrefix && !filterableFields[condition.Field].lowercase)
+
+		if selective && indexed[filterableFields[condition.Field].bsonName] {
+			return nil
+		}
+		fields = appendField(fields, condition.Field)
+	}
+
+	return fields
+}
+
+func appendField(fields []string, field string) []string {
+	for _, f := range fields {
+		if f == field {
+			return fields
+		}
+	}
+
+	return append(fields, field)
+}
@@ -0,0 +1,358 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// codigos de erro do servidor
+	errDocumentValidationFailure = 121
+	errNamespaceNotFound         = 26
+)
+
+var objectIDType = reflect.TypeOf(primitive.ObjectID{})
+var timeType = reflect.TypeOf(time.Time{})
+
+// esquema derivado de um struct pelas tags bson e schema, por exemplo
+// `schema:"required,minLength=1,maxLength=100"`; em arrays e mapas, minLength e maxLength
+// valem para cada item e maxItems limita a quantidade de itens. enum=a|b restringe os valores
+type schemaNode struct {
+	bsonTypes []string
+	nullable  bool
+	// strings vazias nao sao gravadas e nao sao conferidas
+	omitEmpty bool
+
+	minLength int
+	maxLength int
+	maxItems  int
+	minimum   *float64
+	enum      []string
+
+	items  *schemaNode // arrays
+	values *schemaNode // mapas
+	fields []schemaField
+}
+
+type schemaField struct {
+	name     string
+	index    int
+	required bool
+	node     *schemaNode
+}
+
+var planetSchema = newSchema(reflect.TypeOf(Planet{}), "")
+
+func newSchema(t reflect.Type, tag string) *schemaNode {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	node := &schemaNode{minLength: -1, maxLength: -1, maxItems: -1}
+	applySchemaTag(node, tag)
+
+	switch {
+	case t == objectIDType:
+		node.bsonTypes = []string{"objectId"}
+	case t == timeType:
+		node.bsonTypes = []string{"date"}
+	case t.Kind() == reflect.String:
+		node.bsonTypes = []string{"string"}
+	case t.Kind() == reflect.Bool:
+		node.bsonTypes = []string{"bool"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		node.bsonTypes = []string{"int", "long"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		node.bsonTypes = []string{"double"}
+	case t.Kind() == reflect.Slice:
+		node.bsonTypes = []string{"array"}
+		node.items = newSchema(t.Elem(), "")
+		node.items.minLength, node.items.maxLength = node.minLength, node.maxLength
+	case t.Kind() == reflect.Map:
+		node.bsonTypes = []string{"object"}
+		node.values = newSchema(t.Elem(), "")
+		node.values.minLength, node.values.maxLength = node.minLength, node.maxLength
+	case t.Kind() == reflect.Struct:
+		node.bsonTypes = []string{"object"}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts := parseBSONTag(field)
+			if name == "-" {
+				continue
+			}
+
+			f := schemaField{name: name, index: i, node: newSchema(field.Type, field.Tag.Get("schema"))}
+			omitempty := strings.Contains(opts, "omitempty")
+			f.required = strings.Contains(","+field.Tag.Get("schema")+",", ",required,")
+			// slices, mapas e ponteiros sem omitempty sao gravados como null quando nil
+			kind := field.Type.Kind()
+			f.node.nullable = !omitempty && (kind == reflect.Slice || kind == reflect.Map || kind == reflect.Ptr)
+			f.node.omitEmpty = omitempty
+			node.fields = append(node.fields, f)
+		}
+	}
+
+	return node
+}
+
+func parseBSONTag(field reflect.StructField) (string, string) {
+	tag := field.Tag.Get("bson")
+	name, opts := tag, ""
+	if i := strings.Index(tag, ","); i >= 0 {
+		name, opts = tag[:i], tag[i+1:]
+	}
+
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+
+	return name, opts
+}
+
+func applySchemaTag(node *schemaNode, tag string) {
+	for _, option := range strings.Split(tag, ",") {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		if parts[0] == "enum" {
+			node.enum = strings.Split(parts[1], "|")
+			continue
+		}
+
+		value, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid schema option '%s'", option))
+		}
+
+		switch parts[0] {
+		case "minLength":
+			node.minLength = int(value)
+		case "maxLength":
+			node.maxLength = int(value)
+		case "maxItems":
+			node.maxItems = int(value)
+		case "minimum":
+			node.minimum = &value
+		default:
+			panic(fmt.Sprintf("unknown schema option '%s'", parts[0]))
+		}
+	}
+}
+
+// documento $jsonSchema equivalente
+func (n *schemaNode) toBSON() bson.D {
+	types := bson.A{}
+	for _, t := range n.bsonTypes {
+		types = append(types, t)
+	}
+	if n.nullable {
+		types = append(types, "null")
+	}
+
+	schema := bson.D{}
+	if len(types) == 1 {
+		schema = append(schema, bson.E{Key: "bsonType", Value: types[0]})
+	} else {
+		schema = append(schema, bson.E{Key: "bsonType", Value: types})
+	}
+
+	if n.minLength >= 0 && n.items == nil && n.values == nil {
+		schema = append(schema, bson.E{Key: "minLength", Value: n.minLength})
+	}
+	if n.maxLength >= 0 && n.items == nil && n.values == nil {
+		schema = append(schema, bson.E{Key: "maxLength", Value: n.maxLength})
+	}
+	if n.minimum != nil {
+		schema = append(schema, bson.E{Key: "minimum", Value: *n.minimum})
+	}
+	if len(n.enum) > 0 {
+		enum := bson.A{}
+		for _, value := range n.enum {
+			enum = append(enum, value)
+		}
+		schema = append(schema, bson.E{Key: "enum", Value: enum})
+	}
+
+	switch {
+	case n.items != nil:
+		schema = append(schema, bson.E{Key: "items", Value: n.items.toBSON()})
+		if n.maxItems >= 0 {
+			schema = append(schema, bson.E{Key: "maxItems", Value: n.maxItems})
+		}
+	case n.values != nil:
+		schema = append(schema, bson.E{Key: "additionalProperties", Value: n.values.toBSON()})
+		if n.maxItems >= 0 {
+			schema = append(schema, bson.E{Key: "maxProperties", Value: n.maxItems})
+		}
+	case len(n.fields) > 0:
+		required := bson.A{}
+		properties := bson.D{}
+		for _, field := range n.fields {
+			if field.required {
+				required = append(required, field.name)
+			}
+			properties = append(properties, bson.E{Key: field.name, Value: field.node.toBSON()})
+		}
+
+		if len(required) > 0 {
+			schema = append(schema, bson.E{Key: "required", Value: required})
+		}
+		schema = append(schema, bson.E{Key: "properties", Value: properties})
+	}
+
+	return schema
+}
+
+// confere o valor contra o esquema; as chaves do resultado sao os caminhos dos campos
+func (n *schemaNode) check(v reflect.Value, path string, errors map[string]string) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case len(n.fields) > 0:
+		for _, field := range n.fields {
+			fieldPath := field.name
+			if path != "" {
+				fieldPath = path + "." + field.name
+			}
+			field.node.check(v.Field(field.index), fieldPath, errors)
+		}
+	case n.items != nil:
+		if n.maxItems >= 0 && v.Len() > n.maxItems {
+			errors[path] = fmt.Sprintf("Field '%s' can have at most %d items.", path, n.maxItems)
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			n.items.check(v.Index(i), path, errors)
+		}
+	case n.values != nil:
+		if n.maxItems >= 0 && v.Len() > n.maxItems {
+			errors[path] = fmt.Sprintf("Field '%s' can have at most %d entries.", path, n.maxItems)
+			return
+		}
+		for _, key := range v.MapKeys() {
+			n.values.check(v.MapIndex(key), path, errors)
+		}
+	case v.Kind() == reflect.String:
+		if n.omitEmpty && v.String() == "" {
+			return
+		}
+
+		length := len([]rune(v.String()))
+		if len(n.enum) > 0 && !containsValue(n.enum, v.String()) {
+			errors[path] = fmt.Sprintf("Field '%s' must be one of %s.", path, strings.Join(n.enum, ", "))
+		} else if n.minLength >= 0 && length < n.minLength {
+			errors[path] = fmt.Sprintf("Field '%s' must be at least %d characters long.", path, n.minLength)
+		} else if n.maxLength >= 0 && length > n.maxLength {
+			errors[path] = fmt.Sprintf("Field '%s' must be at most %d characters long.", path, n.maxLength)
+		}
+	case n.minimum != nil:
+		value := 0.0
+		if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+			value = v.Float()
+		} else {
+			value = float64(v.Int())
+		}
+		if value < *n.minimum {
+			errors[path] = fmt.Sprintf("Field '%s' must be greater than or equal to %v.", path, *n.minimum)
+		}
+	}
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cria a colecao de planetas com o validador ou atualiza o validador de uma colecao existente;
+// o nivel moderate nao bloqueia atualizacoes de documentos antigos que ja eram invalidos
+func EnsurePlanetsValidator() error {
+	ctx, cancel := utils.WithTimeout(10)
+	defer cancel()
+	validator := bson.D{{Key: "$jsonSchema", Value: planetSchema.toBSON()}}
+
+	err := database.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: planetsCollection.Name()},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == errNamespaceNotFound {
+		err = database.RunCommand(ctx, bson.D{
+			{Key: "create", Value: planetsCollection.Name()},
+			{Key: "validator", Value: validator},
+			{Key: "validationLevel", Value: "moderate"},
+			{Key: "validationAction", Value: "error"},
+		}).Err()
+	}
+
+	return err
+}
+
+func isValidationError(err error) bool {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.WriteErrors {
+			if e.Code == errDocumentValidationFailure {
+				return true
+			}
+		}
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		for _, e := range bulkErr.WriteErrors {
+			if e.Code == errDocumentValidationFailure {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// traduz a rejeicao do validador em erros por campo; como o servidor nao informa o campo,
+// o planeta e conferido contra o mesmo esquema
+func planetWriteError(err error, planet *Planet) *common.Error {
+	if !isValidationError(err) {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return planetValidationError(planet)
+}
+
+func planetValidationError(planet *Planet) *common.Error {
+	errs := map[string]string{}
+	if planet != nil {
+		planetSchema.check(reflect.ValueOf(planet), "", errs)
+	}
+
+	if len(errs) == 0 {
+		errs["planet"] = "The planet does not satisfy the collection schema."
+	}
+
+	return common.CreateFormError(errs)
+}
@@ -0,0 +1,152 @@
+package repo
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// modos de busca por nome; o termo so e interpretado como expressao regular no modo regex
+const (
+	SearchContains = "contains"
+	SearchPrefix   = "prefix"
+	SearchExact    = "exact"
+	SearchRegex    = "regex"
+	// resolvida fora do banco, pelo indice de trigramas do pacote fuzzy
+	SearchFuzzy = "fuzzy"
+)
+
+var SearchModes = []string{SearchContains, SearchPrefix, SearchExact, SearchRegex, SearchFuzzy}
+
+const (
+	maxRegexLength = 100
+	maxRegexNodes  = 50
+	maxRegexRepeat = 100
+)
+
+// valida o modo e, no modo regex, o tamanho e a complexidade da expressao; a expressao precisa
+// seguir a sintaxe RE2, que e aceita tambem pelo MongoDB
+func CheckSearch(term string, mode string) *common.Error {
+	switch mode {
+	case "", SearchContains, SearchPrefix, SearchExact, SearchFuzzy:
+		return nil
+	case SearchRegex:
+	default:
+		return common.CreateFormError(map[string]string{"match": "Match must be one of contains, prefix, exact, regex or fuzzy."})
+	}
+
+	if len([]rune(term)) > maxRegexLength {
+		return common.CreateFormError(map[string]string{"search": fmt.Sprintf("The pattern must be at most %d characters long.", maxRegexLength)})
+	}
+
+	re, err := syntax.Parse(term, syntax.Perl)
+	if err != nil {
+		return common.CreateFormError(map[string]string{"search": fmt.Sprintf("The pattern is not a valid regular expression: %s.", err.Error())})
+	}
+
+	if message := checkRegexComplexity(re, false, new(int)); message != "" {
+		return common.CreateFormError(map[string]string{"search": message})
+	}
+
+	return nil
+}
+
+// rejeita quantificadores aninhados, como (a+)+, que levam a backtracking exponencial,
+// repeticoes grandes e expressoes com muitos nos
+func checkRegexComplexity(re *syntax.Regexp, repeated bool, nodes *int) string {
+	*nodes++
+	if *nodes > maxRegexNodes {
+		return fmt.Sprintf("The pattern must have at most %d elements.", maxRegexNodes)
+	}
+
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		if repeated {
+			return "The pattern must not contain nested quantifiers."
+		}
+		if re.Op == syntax.OpRepeat && re.Max > maxRegexRepeat {
+			return fmt.Sprintf("Repetitions must be at most %d.", maxRegexRepeat)
+		}
+		repeated = true
+	}
+
+	for _, sub := range re.Sub {
+		if message := checkRegexComplexity(sub, repeated, nodes); message != "" {
+			return message
+		}
+	}
+
+	return ""
+}
+
+// contains, prefix e exact comparam o termo escapado com os nomes normalizados; prefix e exact
+// usam o indice searchKeys_1. regex mantem a busca sem distincao de maiusculas nos nomes originais
+func searchToBSON(term string, mode string) bson.E {
+	key := utils.NormalizeTerm(term)
+
+	switch mode {
+	case SearchPrefix:
+		return bson.E{Key: "searchKeys", Value: primitive.Regex{Pattern: "^" + regexp.QuoteMeta(key)}}
+	case SearchExact:
+		return bson.E{Key: "searchKeys", Value: key}
+	case SearchRegex:
+		regex := primitive.Regex{Pattern: term, Options: "i"}
+		return bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: regex}},
+			bson.D{{Key: "searchNames", Value: regex}},
+		}}
+	}
+
+	return bson.E{Key: "searchKeys", Value: primitive.Regex{Pattern: regexp.QuoteMeta(key)}}
+}
+
+// idiomas da busca textual, pelos codigos aceitos pelo MongoDB
+var TextSearchLanguages = []string{"en", "pt"}
+
+type TextSearchHit struct {
+	Planet *Planet
+	Score  float64
+}
+
+// busca no indice planets_text, ordenada pela relevancia; query aceita frases entre aspas e
+// termos negados com "-". language define a reducao dos termos ao radical (en ou pt)
+func SearchPlanetsText(query string, language string, limit int64) ([]*TextSearchHit, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+
+	filter := bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: query}, {Key: "$language", Value: language}}}}
+	score := bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}}
+	opts := options.Find().SetProjection(score).SetSort(score).SetLimit(limit)
+
+	cur, err := planetsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+	defer cur.Close(ctx)
+
+	hits := []*TextSearchHit{}
+	for cur.Next(ctx) {
+		var result struct {
+			Planet `bson:",inline"`
+			Score  float64 `bson:"score"`
+		}
+		if err := cur.Decode(&result); err != nil {
+			return nil, common.CreateGenericInternalError(err)
+		}
+
+		planet := result.Planet
+		hits = append(hits, &TextSearchHit{Planet: &planet, Score: result.Score})
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PlanetStats struct {
+	Total    int64        `json:"total"`
+	Climates []*TermCount `json:"climates"`
+	Terrains []*TermCount `json:"terrains"`
+	// quantidade de planetas por numero de filmes, do menor para o maior
+	Films      []*FilmsCount `json:"filmsAppearedIn"`
+	TopByFilms []*PlanetRank `json:"topByFilms"`
+	// quantidade de planetas criados por dia (UTC), pela data do id
+	CreatedPerDay []*DayCount `json:"createdPerDay"`
+}
+
+type TermCount struct {
+	Term  string `json:"term" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+type FilmsCount struct {
+	FilmsAppearedIn int   `json:"filmsAppearedIn" bson:"_id"`
+	Count           int64 `json:"count" bson:"count"`
+}
+
+type PlanetRank struct {
+	ObjectID        primitive.ObjectID `json:"id" bson:"_id"`
+	Name            string             `json:"name" bson:"name"`
+	FilmsAppearedIn int                `json:"filmsAppearedIn" bson:"filmsAppearedIn"`
+}
+
+type DayCount struct {
+	Day   string `json:"day" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// resultado do $facet; cada campo e uma lista, mesmo a contagem total
+type planetStatsFacets struct {
+	Total []struct {
+		Count int64 `bson:"count"`
+	} `bson:"total"`
+	Climates      []*TermCount  `bson:"climates"`
+	Terrains      []*TermCount  `bson:"terrains"`
+	Films         []*FilmsCount `bson:"films"`
+	TopByFilms    []*PlanetRank `bson:"topByFilms"`
+	CreatedPerDay []*DayCount   `bson:"createdPerDay"`
+}
+
+// estatisticas dos planetas que atendem ao filtro, calculadas em uma unica agregacao;
+// top e a quantidade de planetas no ranking por filmes
+func GetPlanetStats(filter PlanetFilter, top int) (*PlanetStats, *common.Error) {
+	ctx, cancel := utils.WithTimeout(10)
+	defer cancel()
+
+	facets := bson.D{
+		{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+		{Key: "climates", Value: termCountPipeline("$climate")},
+		{Key: "terrains", Value: termCountPipeline("$terrain")},
+		{Key: "films", Value: bson.A{
+			bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$filmsAppearedIn"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		}},
+		{Key: "topByFilms", Value: bson.A{
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "filmsAppearedIn", Value: -1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}}},
+			bson.D{{Key: "$limit", Value: top}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "name", Value: 1}, {Key: "filmsAppearedIn", Value: 1}}}},
+		}},
+		{Key: "createdPerDay", Value: bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{
+					{Key: "format", Value: "%Y-%m-%d"},
+					{Key: "date", Value: bson.D{{Key: "$toDate", Value: "$_id"}}},
+				}}}},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		}},
+	}
+
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: filter.toBSON()}},
+		bson.D{{Key: "$facet", Value: facets}},
+	}
+
+	opts := options.Aggregate()
+	if filter.Search != "" && filter.Match == SearchRegex {
+		opts.SetMaxTime(regexMaxTime)
+	}
+
+	cur, err := planetsCollection.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	results := []*planetStatsFacets{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	result := results[0]
+	stats := &PlanetStats{
+		Climates:      result.Climates,
+		Terrains:      result.Terrains,
+		Films:         result.Films,
+		TopByFilms:    result.TopByFilms,
+		CreatedPerDay: result.CreatedPerDay,
+	}
+
+	// $count nao gera documento quando nenhum planeta atende ao filtro
+	if len(result.Total) > 0 {
+		stats.Total = result.Total[0].Count
+	}
+
+	// listas vazias em vez de null no json
+	if stats.Climates == nil {
+		stats.Climates = []*TermCount{}
+	}
+	if stats.Terrains == nil {
+		stats.Terrains = []*TermCount{}
+	}
+	if stats.Films == nil {
+		stats.Films = []*FilmsCount{}
+	}
+	if stats.TopByFilms == nil {
+		stats.TopByFilms = []*PlanetRank{}
+	}
+	if stats.CreatedPerDay == nil {
+		stats.CreatedPerDay = []*DayCount{}
+	}
+
+	return stats, nil
+}
+
+// quantidade de planetas por termo de um campo separado por virgulas, como "arid, temperate";
+// os termos sao comparados em minusculas
+func termCountPipeline(field string) bson.A {
+	return bson.A{
+		bson.D{{Key: "$project", Value: bson.D{{Key: "terms", Value: bson.D{{Key: "$split", Value: bson.A{field, ","}}}}}}},
+		bson.D{{Key: "$unwind", Value: "$terms"}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "term", Value: bson.D{{Key: "$toLower", Value: bson.D{{Key: "$trim", Value: bson.D{{Key: "input", Value: "$terms"}}}}}}}}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "term", Value: bson.D{{Key: "$ne", Value: ""}}}}}},
+		// um planeta conta uma vez por termo, mesmo que o termo se repita no campo
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "term", Value: "$term"}, {Key: "planet", Value: "$_id"}}}}}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$_id.term"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+}
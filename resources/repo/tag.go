@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TagUsage struct {
+	Tag   string `json:"tag" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// quantidade maxima de tags de um planeta; o mesmo limite do validador da colecao
+const MaxTags = 50
+
+func AddPlanetTag(id primitive.ObjectID, tag string) *common.Error {
+	// so casa com planetas abaixo do limite ou que ja tem a tag, para que duas adicoes
+	// simultaneas nao passem do limite
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: fmt.Sprintf("tags.%d", MaxTags-1), Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "tags", Value: tag}},
+		}},
+	}
+
+	matched, err := updatePlanetTags(filter, bson.D{{Key: "$addToSet", Value: bson.D{{Key: "tags", Value: tag}}}})
+	if err != nil || matched {
+		return err
+	}
+
+	// o planeta pode nao existir ou estar no limite
+	count, err := countDocuments(planetsCollection, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	} else if count == 0 {
+		return common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", id))
+	}
+
+	return common.CreateFormError(map[string]string{"tags": fmt.Sprintf("A planet can have at most %d tags.", MaxTags)})
+}
+
+func RemovePlanetTag(id primitive.ObjectID, tag string) *common.Error {
+	matched, err := updatePlanetTags(bson.D{{Key: "_id", Value: id}}, bson.D{{Key: "$pull", Value: bson.D{{Key: "tags", Value: tag}}}})
+	if err == nil && !matched {
+		return common.CreateNotFoundError(fmt.Sprintf("Planet not found under given id (%s).", id))
+	}
+
+	return err
+}
+
+func updatePlanetTags(filter bson.D, update bson.D) (bool, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	res, err := planetsCollection.UpdateOne(ctx, filter, update)
+
+	if err != nil {
+		return false, planetWriteError(err, nil)
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+// quantidade de planetas por tag, das mais usadas para as menos usadas
+func GetTagUsage() ([]*TagUsage, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	usage := make([]*TagUsage, 0)
+	pipeline := bson.A{
+		bson.D{{Key: "$unwind", Value: "$tags"}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$tags"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cur, err := planetsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	if err := cur.All(ctx, &usage); err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return usage, nil
+}
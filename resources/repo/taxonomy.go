@@ -0,0 +1,242 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TaxonomyClimate = "climate"
+	TaxonomyTerrain = "terrain"
+)
+
+type TaxonomyTerm struct {
+	ObjectID primitive.ObjectID `json:"id" bson:"_id"`
+	Kind     string             `json:"kind"`
+	Term     string             `json:"term"`
+	Synonyms []string           `json:"synonyms"`
+	// termo e sinonimos, usado apenas pelo indice unico
+	Keys []string `json:"-" bson:"keys,omitempty"`
+}
+
+// vocabulario de um tipo (climate ou terrain), indexado por termo e sinonimos
+type Vocabulary struct {
+	Terms     []string
+	canonical map[string]string
+}
+
+// retorna o termo canonico para o valor informado, caso exista
+func (v *Vocabulary) Canonical(value string) (string, bool) {
+	term, ok := v.canonical[utils.NormalizeTerm(value)]
+	return term, ok
+}
+
+// retorna os termos mais proximos do valor informado
+func (v *Vocabulary) Suggest(value string, maxDistance int) []string {
+	value = utils.NormalizeTerm(value)
+	seen := map[string]bool{}
+	suggestions := []string{}
+
+	for key, term := range v.canonical {
+		if !seen[term] && utils.Levenshtein(key, value) <= maxDistance {
+			seen[term] = true
+			suggestions = append(suggestions, term)
+		}
+	}
+
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+func (v *Vocabulary) Empty() bool {
+	return len(v.Terms) == 0
+}
+
+func CreateTaxonomyTerm(kind string, term string, synonyms []string) (primitive.ObjectID, *common.Error) {
+	term = utils.NormalizeTerm(term)
+	synonyms = normalizeSynonyms(term, synonyms)
+
+	if err := checkTaxonomyConflict(kind, primitive.NilObjectID, append([]string{term}, synonyms...)); err != nil {
+		return primitive.ObjectID{}, err
+	}
+
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	res, err := taxonomyCollection.InsertOne(ctx, bson.D{
+		{Key: "kind", Value: kind},
+		{Key: "term", Value: term},
+		{Key: "synonyms", Value: synonyms},
+		{Key: "keys", Value: taxonomyKeys(term, synonyms)},
+	})
+
+	if err != nil {
+		return primitive.ObjectID{}, taxonomyWriteError(err, kind)
+	} else {
+		return res.InsertedID.(primitive.ObjectID), nil
+	}
+}
+
+func GetTaxonomyTerm(kind string, term string) (*TaxonomyTerm, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	taxonomyTerm := TaxonomyTerm{}
+	filter := bson.D{{Key: "kind", Value: kind}, {Key: "term", Value: utils.NormalizeTerm(term)}}
+	err := taxonomyCollection.FindOne(ctx, filter).Decode(&taxonomyTerm)
+
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, common.CreateNotFoundError(fmt.Sprintf("Term not found under given %s (%s).", kind, term))
+		}
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	return &taxonomyTerm, nil
+}
+
+func GetTaxonomyTerms(kind string) ([]*TaxonomyTerm, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	terms := make([]*TaxonomyTerm, 0)
+	filter := bson.D{{Key: "kind", Value: kind}}
+	opts := options.Find().SetSort(bson.D{{Key: "term", Value: 1}})
+
+	cur, err := taxonomyCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, common.CreateGenericInternalError(err)
+	}
+
+	for cur.Next(ctx) {
+		var term TaxonomyTerm
+		err := cur.Decode(&term)
+
+		if err != nil {
+			return nil, common.CreateGenericInternalError(err)
+		}
+
+		terms = append(terms, &term)
+	}
+
+	return terms, nil
+}
+
+func UpdateTaxonomyTermSynonyms(kind string, term string, synonyms []string) *common.Error {
+	existing, err := GetTaxonomyTerm(kind, term)
+	if err != nil {
+		return err
+	}
+
+	synonyms = normalizeSynonyms(existing.Term, synonyms)
+	if err := checkTaxonomyConflict(kind, existing.ObjectID, synonyms); err != nil {
+		return err
+	}
+
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: existing.ObjectID}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "synonyms", Value: synonyms}, {Key: "keys", Value: taxonomyKeys(existing.Term, synonyms)}}}}
+
+	if _, err := taxonomyCollection.UpdateOne(ctx, filter, update); err != nil {
+		return taxonomyWriteError(err, kind)
+	}
+
+	return nil
+}
+
+func DeleteTaxonomyTerm(kind string, term string) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "kind", Value: kind}, {Key: "term", Value: utils.NormalizeTerm(term)}}
+	res, err := taxonomyCollection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return common.CreateGenericInternalError(err)
+	} else if res.DeletedCount == 0 {
+		return common.CreateNotFoundError(fmt.Sprintf("Term not found under given %s (%s).", kind, term))
+	}
+
+	return nil
+}
+
+func GetVocabulary(kind string) (*Vocabulary, *common.Error) {
+	terms, err := GetTaxonomyTerms(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	vocabulary := Vocabulary{Terms: make([]string, 0, len(terms)), canonical: map[string]string{}}
+	for _, term := range terms {
+		vocabulary.Terms = append(vocabulary.Terms, term.Term)
+		vocabulary.canonical[term.Term] = term.Term
+		for _, synonym := range term.Synonyms {
+			vocabulary.canonical[synonym] = term.Term
+		}
+	}
+
+	return &vocabulary, nil
+}
+
+// um termo ou sinonimo nao pode estar associado a mais de um termo canonico
+func checkTaxonomyConflict(kind string, ignore primitive.ObjectID, values []string) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{
+		{Key: "kind", Value: kind},
+		{Key: "_id", Value: bson.D{{Key: "$ne", Value: ignore}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "term", Value: bson.D{{Key: "$in", Value: values}}}},
+			bson.D{{Key: "synonyms", Value: bson.D{{Key: "$in", Value: values}}}},
+		}},
+	}
+
+	count, err := taxonomyCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	if count > 0 {
+		return taxonomyConflictError(kind)
+	}
+
+	return nil
+}
+
+// o termo e os sinonimos em um unico campo; o indice unico em kind e keys impede que duas
+// escritas simultaneas registrem o mesmo valor, o que a consulta acima nao garante
+func taxonomyKeys(term string, synonyms []string) []string {
+	return append([]string{term}, synonyms...)
+}
+
+func taxonomyWriteError(err error, kind string) *common.Error {
+	if isDuplicateKeyError(err) {
+		return taxonomyConflictError(kind)
+	}
+
+	return common.CreateGenericInternalError(err)
+}
+
+func taxonomyConflictError(kind string) *common.Error {
+	return common.CreateConflictError(fmt.Sprintf("The term or one of its synonyms is already registered as a %s.", kind))
+}
+
+func normalizeSynonyms(term string, synonyms []string) []string {
+	seen := map[string]bool{term: true}
+	normalized := make([]string, 0, len(synonyms))
+
+	for _, synonym := range synonyms {
+		synonym = utils.NormalizeTerm(synonym)
+		if synonym != "" && !seen[synonym] {
+			seen[synonym] = true
+			normalized = append(normalized, synonym)
+		}
+	}
+
+	return normalized
+}
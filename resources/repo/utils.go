@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"errors"
+
+	"github.com/jvitoroc/b2w-star-wars/resources/common"
+	"github.com/jvitoroc/b2w-star-wars/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func insertDocument(collection *mongo.Collection, document interface{}) (primitive.ObjectID, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	res, err := collection.InsertOne(ctx, document)
+
+	if err != nil {
+		return primitive.ObjectID{}, common.CreateGenericInternalError(err)
+	} else {
+		return res.InsertedID.(primitive.ObjectID), nil
+	}
+}
+
+func findDocumentByID(collection *mongo.Collection, id primitive.ObjectID, v interface{}, notFound string) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: id}}
+	err := collection.FindOne(ctx, filter).Decode(v)
+
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return common.CreateNotFoundError(notFound)
+		}
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
+// decodifica todos os documentos encontrados no slice apontado por v
+func findDocuments(collection *mongo.Collection, filter interface{}, v interface{}) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	if err := cur.All(ctx, v); err != nil {
+		return common.CreateGenericInternalError(err)
+	}
+
+	return nil
+}
+
+func findDocumentIDs(collection *mongo.Collection, filter interface{}) ([]primitive.ObjectID, *common.Error) {
+	documents := []struct {
+		ObjectID primitive.ObjectID `bson:"_id"`
+	}{}
+
+	if err := findDocuments(collection, filter, &documents); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(documents))
+	for _, document := range documents {
+		ids = append(ids, document.ObjectID)
+	}
+
+	return ids, nil
+}
+
+func countDocuments(collection *mongo.Collection, filter interface{}) (int64, *common.Error) {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	count, err := collection.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return 0, common.CreateGenericInternalError(err)
+	}
+
+	return count, nil
+}
+
+func deleteDocumentByID(collection *mongo.Collection, id primitive.ObjectID, notFound string) *common.Error {
+	ctx, cancel := utils.WithTimeout(5)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: id}}
+	res, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return common.CreateGenericInternalError(err)
+	} else if res.DeletedCount == 0 {
+		return common.CreateNotFoundError(notFound)
+	}
+
+	return nil
+}
+
+// E11000, violacao de indice unico
+func isDuplicateKeyError(err error) bool {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.WriteErrors {
+			if e.Code == 11000 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IndexOptionsConflict, ja existe um indice com o mesmo nome e outras opcoes
+func isIndexOptionsConflict(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 85
+}
@@ -0,0 +1,67 @@
+package utils
+
+import "strings"
+
+// normaliza um termo para comparacoes (minusculo e sem espacos nas pontas)
+func NormalizeTerm(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// separa valores como "grasslands, mountains" em termos individuais
+func SplitTerms(s string) []string {
+	return SplitList(s, ",")
+}
+
+// separa uma lista com o separador informado, ignorando itens vazios
+func SplitList(s string, separator string) []string {
+	items := []string{}
+
+	for _, item := range strings.Split(s, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// distancia de edicao entre duas strings, por runa; a troca de duas letras vizinhas, um erro de
+// digitacao comum, conta como uma edicao (Damerau-Levenshtein com alinhamento otimo)
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	beforePrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && beforePrev[j-2]+1 < curr[j] {
+				curr[j] = beforePrev[j-2] + 1
+			}
+		}
+		beforePrev, prev, curr = prev, curr, beforePrev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}